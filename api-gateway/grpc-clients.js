@@ -1,5 +1,6 @@
 const grpc = require('@grpc/grpc-js');
 const protoLoader = require('@grpc/proto-loader');
+const fs = require('fs');
 const path = require('path');
 
 // Load proto files
@@ -23,22 +24,38 @@ const protoDescriptor = grpc.loadPackageDefinition(packageDefinition);
 const USER_SERVICE_URL = process.env.USER_SERVICE_URL || 'localhost:50051';
 const ORDER_SERVICE_URL = process.env.ORDER_SERVICE_URL || 'localhost:50052';
 
+// Use TLS when a CA is configured, presenting a client certificate if one
+// is given. The files are read once at startup.
+const createCredentials = () => {
+  const { GRPC_TLS_CA_FILE, GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE } = process.env;
+  if (!GRPC_TLS_CA_FILE) {
+    return grpc.credentials.createInsecure();
+  }
+  return grpc.credentials.createSsl(
+    fs.readFileSync(GRPC_TLS_CA_FILE),
+    GRPC_TLS_KEY_FILE ? fs.readFileSync(GRPC_TLS_KEY_FILE) : null,
+    GRPC_TLS_CERT_FILE ? fs.readFileSync(GRPC_TLS_CERT_FILE) : null
+  );
+};
+
+const credentials = createCredentials();
+
 // Create gRPC clients
 const userClient = new protoDescriptor.user.UserService(
   USER_SERVICE_URL,
-  grpc.credentials.createInsecure()
+  credentials
 );
 
 const orderClient = new protoDescriptor.order.OrderService(
   ORDER_SERVICE_URL,
-  grpc.credentials.createInsecure()
+  credentials
 );
 
 // Helper function to promisify gRPC calls
 const promisifyGrpcCall = (client, method) => {
-  return (request) => {
+  return (request, metadata = new grpc.Metadata()) => {
     return new Promise((resolve, reject) => {
-      client[method](request, (error, response) => {
+      client[method](request, metadata, (error, response) => {
         if (error) {
           reject(error);
         } else {
@@ -55,8 +72,16 @@ const userService = {
   getUser: promisifyGrpcCall(userClient, 'GetUser'),
   updateUser: promisifyGrpcCall(userClient, 'UpdateUser'),
   deleteUser: promisifyGrpcCall(userClient, 'DeleteUser'),
+  restoreUser: promisifyGrpcCall(userClient, 'RestoreUser'),
+  purgeUser: promisifyGrpcCall(userClient, 'PurgeUser'),
   listUsers: promisifyGrpcCall(userClient, 'ListUsers'),
-  validateUser: promisifyGrpcCall(userClient, 'ValidateUser')
+  searchUsers: promisifyGrpcCall(userClient, 'SearchUsers'),
+  validateUser: promisifyGrpcCall(userClient, 'ValidateUser'),
+  changePassword: promisifyGrpcCall(userClient, 'ChangePassword'),
+  authenticate: promisifyGrpcCall(userClient, 'Authenticate'),
+  refreshToken: promisifyGrpcCall(userClient, 'RefreshToken'),
+  revokeToken: promisifyGrpcCall(userClient, 'RevokeToken'),
+  getJWKS: promisifyGrpcCall(userClient, 'GetJWKS')
 };
 
 // Order Service methods
@@ -66,11 +91,28 @@ const orderService = {
   updateOrderStatus: promisifyGrpcCall(orderClient, 'UpdateOrderStatus'),
   listOrders: promisifyGrpcCall(orderClient, 'ListOrders'),
   getUserOrders: promisifyGrpcCall(orderClient, 'GetUserOrders'),
-  cancelOrder: promisifyGrpcCall(orderClient, 'CancelOrder')
+  cancelOrder: promisifyGrpcCall(orderClient, 'CancelOrder'),
+  getOrderHistory: promisifyGrpcCall(orderClient, 'GetOrderHistory')
+};
+
+// Build gRPC metadata for an incoming HTTP request, forwarding the caller's
+// bearer token and request ID
+const metadataFrom = (req) => {
+  const metadata = new grpc.Metadata();
+  const authorization = req.get('Authorization');
+  if (authorization) {
+    metadata.set('authorization', authorization);
+  }
+  const requestId = req.get('X-Request-Id');
+  if (requestId) {
+    metadata.set('x-request-id', requestId);
+  }
+  return metadata;
 };
 
 module.exports = {
   userService,
-  orderService
+  orderService,
+  metadataFrom
 };
 
@@ -0,0 +1,97 @@
+const express = require('express');
+const { userService } = require('../grpc-clients');
+
+const router = express.Router();
+
+// Log in with email and password
+router.post('/login', async (req, res) => {
+  try {
+    const { email, password } = req.body;
+
+    if (!email || !password) {
+      return res.status(400).json({ error: 'Email and password are required' });
+    }
+
+    const response = await userService.authenticate({ email, password });
+
+    res.json({
+      success: true,
+      data: response.user,
+      tokens: response.tokens
+    });
+  } catch (error) {
+    console.error('Error authenticating user:', error.code);
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: 'Invalid email or password'
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to authenticate'
+    });
+  }
+});
+
+// Exchange a refresh token for a new token pair
+router.post('/refresh', async (req, res) => {
+  try {
+    const { refresh_token } = req.body;
+
+    if (!refresh_token) {
+      return res.status(400).json({ error: 'refresh_token is required' });
+    }
+
+    const response = await userService.refreshToken({ refresh_token });
+
+    res.json({
+      success: true,
+      tokens: response.tokens
+    });
+  } catch (error) {
+    console.error('Error refreshing token:', error.code);
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: 'Invalid refresh token'
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to refresh token'
+    });
+  }
+});
+
+// Log out by revoking a refresh token
+router.post('/logout', async (req, res) => {
+  try {
+    const { refresh_token, all_sessions } = req.body;
+
+    if (!refresh_token) {
+      return res.status(400).json({ error: 'refresh_token is required' });
+    }
+
+    const response = await userService.revokeToken({
+      refresh_token,
+      all_sessions: Boolean(all_sessions)
+    });
+
+    res.json({
+      success: response.success
+    });
+  } catch (error) {
+    console.error('Error revoking token:', error.code);
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to revoke token'
+    });
+  }
+});
+
+module.exports = router;
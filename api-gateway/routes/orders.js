@@ -1,5 +1,5 @@
 const express = require('express');
-const { orderService } = require('../grpc-clients');
+const { orderService, metadataFrom } = require('../grpc-clients');
 
 const router = express.Router();
 
@@ -12,10 +12,34 @@ const OrderStatus = {
   CANCELLED: 4
 };
 
+// Convert a decimal price (number or string) into an order.Money message
+const toMoney = (value, currency) => {
+  const match = /^(-)?(\d+)(?:\.(\d{1,9}))?$/.exec(String(value).trim());
+  if (!match) {
+    return null;
+  }
+  const [, sign, whole, fraction = ''] = match;
+  const nanos = parseInt(fraction.padEnd(9, '0'), 10);
+  return {
+    currency_code: currency,
+    units: (sign || '') + whole,
+    nanos: sign ? -nanos : nanos
+  };
+};
+
+// Parse a status query parameter, which may be repeated or comma-separated,
+// e.g. ?status=PENDING,PROCESSING. Unknown names map to undefined.
+const parseStatuses = (status) => [].concat(status || [])
+  .flatMap(value => value.split(','))
+  .filter(value => value !== '')
+  .map(value => OrderStatus[value.trim().toUpperCase()]);
+
+const invalidStatusError = 'Invalid status. Must be one of: PENDING, PROCESSING, SHIPPED, DELIVERED, CANCELLED';
+
 // Create Order
 router.post('/', async (req, res) => {
   try {
-    const { user_id, items } = req.body;
+    const { user_id, items, currency = 'USD' } = req.body;
 
     if (!user_id || !items || !Array.isArray(items) || items.length === 0) {
       return res.status(400).json({
@@ -25,11 +49,16 @@ router.post('/', async (req, res) => {
 
     // Validate items
     for (const item of items) {
-      if (!item.product_name || !item.quantity || !item.price) {
+      if (!item.product_name || !item.quantity || item.price === undefined) {
         return res.status(400).json({
           error: 'Each item must have product_name, quantity, and price'
         });
       }
+      if (!toMoney(item.price, item.currency || currency)) {
+        return res.status(400).json({
+          error: 'Each item price must be a decimal amount, e.g. 19.99'
+        });
+      }
     }
 
     const response = await orderService.createOrder({
@@ -37,9 +66,10 @@ router.post('/', async (req, res) => {
       items: items.map(item => ({
         product_name: item.product_name,
         quantity: parseInt(item.quantity),
-        price: parseFloat(item.price)
-      }))
-    });
+        price: toMoney(item.price, item.currency || currency)
+      })),
+      idempotency_key: req.get('Idempotency-Key') || ''
+    }, metadataFrom(req));
 
     res.status(201).json({
       success: true,
@@ -56,6 +86,27 @@ router.post('/', async (req, res) => {
       });
     }
 
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to create order'
@@ -72,8 +123,9 @@ router.get('/:id', async (req, res) => {
       return res.status(400).json({ error: 'Invalid order ID' });
     }
 
-    const response = await orderService.getOrder({ id });
+    const response = await orderService.getOrder({ id }, metadataFrom(req));
 
+    res.set('ETag', response.order.etag);
     res.json({
       success: true,
       data: response.order
@@ -88,6 +140,20 @@ router.get('/:id', async (req, res) => {
       });
     }
 
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to get order'
@@ -99,7 +165,7 @@ router.get('/:id', async (req, res) => {
 router.patch('/:id/status', async (req, res) => {
   try {
     const id = parseInt(req.params.id);
-    const { status } = req.body;
+    const { status, reason } = req.body;
 
     if (isNaN(id)) {
       return res.status(400).json({ error: 'Invalid order ID' });
@@ -124,8 +190,10 @@ router.patch('/:id/status', async (req, res) => {
 
     const response = await orderService.updateOrderStatus({
       id,
-      status: statusValue
-    });
+      status: statusValue,
+      reason: reason || '',
+      etag: req.get('If-Match') || ''
+    }, metadataFrom(req));
 
     res.json({
       success: true,
@@ -142,6 +210,27 @@ router.patch('/:id/status', async (req, res) => {
       });
     }
 
+    if (error.code === 10) { // ABORTED
+      return res.status(412).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to update order status'
@@ -152,22 +241,91 @@ router.patch('/:id/status', async (req, res) => {
 // List Orders
 router.get('/', async (req, res) => {
   try {
-    const page = parseInt(req.query.page) || 1;
+    const page = parseInt(req.query.page) || 0;
     const limit = parseInt(req.query.limit) || 10;
+    const page_token = req.query.page_token || '';
+    const include_total = req.query.include_total === 'true';
+    const {
+      status,
+      user_id,
+      created_after = '',
+      created_before = '',
+      updated_after = '',
+      updated_before = '',
+      min_total,
+      max_total,
+      currency = 'USD',
+      order_by = ''
+    } = req.query;
+
+    const statuses = parseStatuses(status);
+    if (statuses.includes(undefined)) {
+      return res.status(400).json({ error: invalidStatusError });
+    }
+
+    const minTotal = min_total !== undefined ? toMoney(min_total, currency) : null;
+    const maxTotal = max_total !== undefined ? toMoney(max_total, currency) : null;
+    if ((min_total !== undefined && !minTotal) || (max_total !== undefined && !maxTotal)) {
+      return res.status(400).json({
+        error: 'min_total and max_total must be decimal amounts, e.g. 19.99'
+      });
+    }
 
-    const response = await orderService.listOrders({ page, limit });
+    const response = await orderService.listOrders({
+      page,
+      limit,
+      page_token,
+      include_total,
+      statuses,
+      user_id: parseInt(user_id) || 0,
+      created_after,
+      created_before,
+      updated_after,
+      updated_before,
+      min_total: minTotal,
+      max_total: maxTotal,
+      order_by
+    }, metadataFrom(req));
+
+    const pagination = {
+      limit,
+      next_page_token: response.next_page_token
+    };
+    if (page) {
+      pagination.page = page;
+    }
+    if (include_total) {
+      pagination.total = response.total;
+    }
 
     res.json({
       success: true,
       data: response.orders,
-      pagination: {
-        page,
-        limit,
-        total: response.total
-      }
+      pagination
     });
   } catch (error) {
     console.error('Error listing orders:', error);
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to list orders'
@@ -184,16 +342,44 @@ router.get('/user/:userId', async (req, res) => {
       return res.status(400).json({ error: 'Invalid user ID' });
     }
 
-    const response = await orderService.getUserOrders({ user_id });
+    const limit = parseInt(req.query.limit) || 10;
+    const page_token = req.query.page_token || '';
+    const { status, created_after = '', created_before = '' } = req.query;
+
+    const statuses = parseStatuses(status);
+    if (statuses.includes(undefined)) {
+      return res.status(400).json({ error: invalidStatusError });
+    }
+
+    const response = await orderService.getUserOrders({
+      user_id,
+      limit,
+      page_token,
+      statuses,
+      created_after,
+      created_before
+    }, metadataFrom(req));
 
     res.json({
       success: true,
       data: response.orders,
-      total: response.total
+      total: response.total,
+      pagination: {
+        limit,
+        next_page_token: response.next_page_token,
+        total: response.total
+      }
     });
   } catch (error) {
     console.error('Error getting user orders:', error);
-    
+
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     if (error.code === 5) { // NOT_FOUND
       return res.status(404).json({
         success: false,
@@ -201,6 +387,20 @@ router.get('/user/:userId', async (req, res) => {
       });
     }
 
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to get user orders'
@@ -217,7 +417,12 @@ router.post('/:id/cancel', async (req, res) => {
       return res.status(400).json({ error: 'Invalid order ID' });
     }
 
-    const response = await orderService.cancelOrder({ id });
+    const reason = (req.body && req.body.reason) || '';
+    const response = await orderService.cancelOrder({
+      id,
+      reason,
+      etag: req.get('If-Match') || ''
+    }, metadataFrom(req));
 
     res.json({
       success: response.success,
@@ -233,6 +438,27 @@ router.post('/:id/cancel', async (req, res) => {
       });
     }
 
+    if (error.code === 10) { // ABORTED
+      return res.status(412).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to cancel order'
@@ -240,5 +466,51 @@ router.post('/:id/cancel', async (req, res) => {
   }
 });
 
+// Get Order Status History
+router.get('/:id/history', async (req, res) => {
+  try {
+    const order_id = parseInt(req.params.id);
+
+    if (isNaN(order_id)) {
+      return res.status(400).json({ error: 'Invalid order ID' });
+    }
+
+    const response = await orderService.getOrderHistory({ order_id }, metadataFrom(req));
+
+    res.json({
+      success: true,
+      data: response.history
+    });
+  } catch (error) {
+    console.error('Error getting order history:', error);
+
+    if (error.code === 5) { // NOT_FOUND
+      return res.status(404).json({
+        success: false,
+        error: 'Order not found'
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to get order history'
+    });
+  }
+});
+
 module.exports = router;
 
@@ -1,12 +1,12 @@
 const express = require('express');
-const { userService } = require('../grpc-clients');
+const { userService, metadataFrom } = require('../grpc-clients');
 
 const router = express.Router();
 
 // Create User
 router.post('/', async (req, res) => {
   try {
-    const { name, email, phone, address } = req.body;
+    const { name, email, phone, address, password, role } = req.body;
 
     if (!name || !email) {
       return res.status(400).json({ error: 'Name and email are required' });
@@ -16,8 +16,11 @@ router.post('/', async (req, res) => {
       name,
       email,
       phone: phone || '',
-      address: address || ''
-    });
+      address: address || '',
+      password: password || '',
+      role: role || 'USER_ROLE_UNSPECIFIED',
+      idempotency_key: req.get('Idempotency-Key') || ''
+    }, metadataFrom(req));
 
     res.status(201).json({
       success: true,
@@ -26,6 +29,28 @@ router.post('/', async (req, res) => {
     });
   } catch (error) {
     console.error('Error creating user:', error);
+
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 6) { // ALREADY_EXISTS
+      return res.status(409).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to create user'
@@ -33,6 +58,57 @@ router.post('/', async (req, res) => {
   }
 });
 
+// Search Users (declared before /:id so that "search" is not taken as an ID)
+router.get('/search', async (req, res) => {
+  try {
+    const query = req.query.q || '';
+    const limit = parseInt(req.query.limit) || 10;
+    const page_token = req.query.page_token || '';
+
+    const response = await userService.searchUsers({
+      query,
+      limit,
+      page_token
+    }, metadataFrom(req));
+
+    res.json({
+      success: true,
+      data: response.users,
+      pagination: {
+        limit,
+        next_page_token: response.next_page_token
+      }
+    });
+  } catch (error) {
+    console.error('Error searching users:', error);
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to search users'
+    });
+  }
+});
+
 // Get User by ID
 router.get('/:id', async (req, res) => {
   try {
@@ -42,8 +118,9 @@ router.get('/:id', async (req, res) => {
       return res.status(400).json({ error: 'Invalid user ID' });
     }
 
-    const response = await userService.getUser({ id });
+    const response = await userService.getUser({ id }, metadataFrom(req));
 
+    res.set('ETag', response.user.etag);
     res.json({
       success: true,
       data: response.user
@@ -58,6 +135,20 @@ router.get('/:id', async (req, res) => {
       });
     }
 
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to get user'
@@ -69,7 +160,7 @@ router.get('/:id', async (req, res) => {
 router.put('/:id', async (req, res) => {
   try {
     const id = parseInt(req.params.id);
-    const { name, email, phone, address } = req.body;
+    const { name, email, phone, address, role } = req.body;
 
     if (isNaN(id)) {
       return res.status(400).json({ error: 'Invalid user ID' });
@@ -80,8 +171,95 @@ router.put('/:id', async (req, res) => {
       name: name || '',
       email: email || '',
       phone: phone || '',
-      address: address || ''
+      address: address || '',
+      role: role || 'USER_ROLE_UNSPECIFIED',
+      etag: req.get('If-Match') || ''
+    }, metadataFrom(req));
+
+    res.json({
+      success: true,
+      data: response.user,
+      message: response.message
     });
+  } catch (error) {
+    console.error('Error updating user:', error);
+    
+    if (error.code === 5) { // NOT_FOUND
+      return res.status(404).json({
+        success: false,
+        error: 'User not found'
+      });
+    }
+
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 6) { // ALREADY_EXISTS
+      return res.status(409).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 10) { // ABORTED
+      return res.status(412).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to update user'
+    });
+  }
+});
+
+// Patch User: only the fields present in the body are changed, and they
+// are set even when empty, so phone and address can be cleared
+router.patch('/:id', async (req, res) => {
+  try {
+    const id = parseInt(req.params.id);
+
+    if (isNaN(id)) {
+      return res.status(400).json({ error: 'Invalid user ID' });
+    }
+
+    const paths = ['name', 'email', 'phone', 'address', 'role']
+      .filter((field) => req.body[field] !== undefined);
+    if (paths.length === 0) {
+      return res.status(400).json({ error: 'No fields to update' });
+    }
+
+    const { name, email, phone, address, role } = req.body;
+    const response = await userService.updateUser({
+      id,
+      name: name || '',
+      email: email || '',
+      phone: phone || '',
+      address: address || '',
+      role: role || 'USER_ROLE_UNSPECIFIED',
+      etag: req.get('If-Match') || '',
+      update_mask: { paths }
+    }, metadataFrom(req));
 
     res.json({
       success: true,
@@ -98,6 +276,41 @@ router.put('/:id', async (req, res) => {
       });
     }
 
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 6) { // ALREADY_EXISTS
+      return res.status(409).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 10) { // ABORTED
+      return res.status(412).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to update user'
@@ -114,7 +327,7 @@ router.delete('/:id', async (req, res) => {
       return res.status(400).json({ error: 'Invalid user ID' });
     }
 
-    const response = await userService.deleteUser({ id });
+    const response = await userService.deleteUser({ id }, metadataFrom(req));
 
     res.json({
       success: response.success,
@@ -130,6 +343,20 @@ router.delete('/:id', async (req, res) => {
       });
     }
 
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to delete user'
@@ -137,25 +364,160 @@ router.delete('/:id', async (req, res) => {
   }
 });
 
+// Restore User
+router.post('/:id/restore', async (req, res) => {
+  try {
+    const id = parseInt(req.params.id);
+
+    if (isNaN(id)) {
+      return res.status(400).json({ error: 'Invalid user ID' });
+    }
+
+    const response = await userService.restoreUser({ id }, metadataFrom(req));
+
+    res.json({
+      success: true,
+      data: response.user,
+      message: response.message
+    });
+  } catch (error) {
+    console.error('Error restoring user:', error);
+
+    if (error.code === 5) { // NOT_FOUND
+      return res.status(404).json({
+        success: false,
+        error: 'Deleted user not found'
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to restore user'
+    });
+  }
+});
+
+// Purge User
+router.delete('/:id/purge', async (req, res) => {
+  try {
+    const id = parseInt(req.params.id);
+
+    if (isNaN(id)) {
+      return res.status(400).json({ error: 'Invalid user ID' });
+    }
+
+    const response = await userService.purgeUser({ id }, metadataFrom(req));
+
+    res.json({
+      success: response.success,
+      message: response.message
+    });
+  } catch (error) {
+    console.error('Error purging user:', error);
+
+    if (error.code === 5) { // NOT_FOUND
+      return res.status(404).json({
+        success: false,
+        error: 'User not found'
+      });
+    }
+
+    if (error.code === 9) { // FAILED_PRECONDITION
+      return res.status(409).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to purge user'
+    });
+  }
+});
+
 // List Users
 router.get('/', async (req, res) => {
   try {
-    const page = parseInt(req.query.page) || 1;
+    const page = parseInt(req.query.page) || 0;
     const limit = parseInt(req.query.limit) || 10;
+    const page_token = req.query.page_token || '';
+    const include_total = req.query.include_total === 'true';
 
-    const response = await userService.listUsers({ page, limit });
+    const response = await userService.listUsers({
+      page,
+      limit,
+      page_token,
+      include_total
+    }, metadataFrom(req));
+
+    const pagination = {
+      limit,
+      next_page_token: response.next_page_token
+    };
+    if (page) {
+      pagination.page = page;
+    }
+    if (include_total) {
+      pagination.total = response.total;
+    }
 
     res.json({
       success: true,
       data: response.users,
-      pagination: {
-        page,
-        limit,
-        total: response.total
-      }
+      pagination
     });
   } catch (error) {
     console.error('Error listing users:', error);
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to list users'
@@ -172,7 +534,7 @@ router.get('/:id/validate', async (req, res) => {
       return res.status(400).json({ error: 'Invalid user ID' });
     }
 
-    const response = await userService.validateUser({ user_id });
+    const response = await userService.validateUser({ user_id }, metadataFrom(req));
 
     res.json({
       success: true,
@@ -181,6 +543,20 @@ router.get('/:id/validate', async (req, res) => {
     });
   } catch (error) {
     console.error('Error validating user:', error);
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
     res.status(500).json({
       success: false,
       error: error.details || 'Failed to validate user'
@@ -188,5 +564,64 @@ router.get('/:id/validate', async (req, res) => {
   }
 });
 
+// Change Password
+router.put('/:id/password', async (req, res) => {
+  try {
+    const user_id = parseInt(req.params.id);
+    const { current_password, new_password } = req.body;
+
+    if (isNaN(user_id)) {
+      return res.status(400).json({ error: 'Invalid user ID' });
+    }
+    if (!new_password) {
+      return res.status(400).json({ error: 'new_password is required' });
+    }
+
+    const response = await userService.changePassword({
+      user_id,
+      current_password: current_password || '',
+      new_password
+    }, metadataFrom(req));
+
+    res.json({
+      success: response.success,
+      message: response.message
+    });
+  } catch (error) {
+    console.error('Error changing password:', error.code);
+
+    if (error.code === 5) { // NOT_FOUND
+      return res.status(404).json({
+        success: false,
+        error: 'User not found'
+      });
+    }
+    if (error.code === 3) { // INVALID_ARGUMENT
+      return res.status(400).json({
+        success: false,
+        error: error.details
+      });
+    }
+    if (error.code === 7) { // PERMISSION_DENIED
+      return res.status(403).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    if (error.code === 16) { // UNAUTHENTICATED
+      return res.status(401).json({
+        success: false,
+        error: error.details
+      });
+    }
+
+    res.status(500).json({
+      success: false,
+      error: error.details || 'Failed to change password'
+    });
+  }
+});
+
 module.exports = router;
 
@@ -6,6 +6,8 @@ const morgan = require('morgan');
 // Import routes
 const userRoutes = require('./routes/users');
 const orderRoutes = require('./routes/orders');
+const authRoutes = require('./routes/auth');
+const { userService } = require('./grpc-clients');
 
 const app = express();
 const PORT = process.env.PORT || 3000;
@@ -25,6 +27,18 @@ app.get('/health', (req, res) => {
   });
 });
 
+// Public keys for verifying access tokens
+app.get('/.well-known/jwks.json', async (req, res) => {
+  try {
+    const response = await userService.getJWKS({});
+    res.set('Cache-Control', 'public, max-age=60');
+    res.json({ keys: response.keys });
+  } catch (error) {
+    console.error('Error getting JWKS:', error.code);
+    res.status(502).json({ error: 'Failed to get signing keys' });
+  }
+});
+
 // API documentation endpoint
 app.get('/', (req, res) => {
   res.json({
@@ -34,19 +48,31 @@ app.get('/', (req, res) => {
     endpoints: {
       users: {
         'POST /api/users': 'Create a new user',
-        'GET /api/users': 'List all users (supports ?page=1&limit=10)',
+        'GET /api/users': 'List all users (supports ?limit=10&page_token=...&include_total=true)',
+        'GET /api/users/search': 'Search users by name, email, phone or address (?q=...)',
         'GET /api/users/:id': 'Get user by ID',
         'PUT /api/users/:id': 'Update user',
-        'DELETE /api/users/:id': 'Delete user',
-        'GET /api/users/:id/validate': 'Validate user exists'
+        'PATCH /api/users/:id': 'Update only the given fields, clearing empty ones',
+        'DELETE /api/users/:id': 'Delete user (restorable until purged)',
+        'POST /api/users/:id/restore': 'Restore a deleted user',
+        'DELETE /api/users/:id/purge': 'Permanently remove a deleted user',
+        'GET /api/users/:id/validate': 'Validate user exists',
+        'PUT /api/users/:id/password': 'Set or change a user\'s password'
+      },
+      auth: {
+        'POST /api/auth/login': 'Authenticate with email and password',
+        'POST /api/auth/refresh': 'Exchange a refresh token for new tokens',
+        'POST /api/auth/logout': 'Revoke a refresh token (supports all_sessions)',
+        'GET /.well-known/jwks.json': 'Public keys for verifying access tokens'
       },
       orders: {
         'POST /api/orders': 'Create a new order',
-        'GET /api/orders': 'List all orders (supports ?page=1&limit=10)',
+        'GET /api/orders': 'List all orders (supports ?limit=10&page_token=...&include_total=true, filters and order_by)',
         'GET /api/orders/:id': 'Get order by ID',
         'PATCH /api/orders/:id/status': 'Update order status',
-        'GET /api/orders/user/:userId': 'Get orders for specific user',
-        'POST /api/orders/:id/cancel': 'Cancel an order'
+        'GET /api/orders/user/:userId': 'Get orders for specific user (paginated, filterable)',
+        'POST /api/orders/:id/cancel': 'Cancel an order',
+        'GET /api/orders/:id/history': 'Get order status history'
       }
     },
     examples: {
@@ -57,14 +83,17 @@ app.get('/', (req, res) => {
           name: 'John Doe',
           email: 'john@example.com',
           phone: '+1234567890',
-          address: '123 Main St'
+          address: '123 Main St',
+          password: 'correct horse battery staple'
         }
       },
       createOrder: {
         method: 'POST',
         url: '/api/orders',
+        // Decimal prices are converted to Money in the given currency
         body: {
           user_id: 1,
+          currency: 'USD',
           items: [
             { product_name: 'Laptop', quantity: 1, price: 999.99 },
             { product_name: 'Mouse', quantity: 2, price: 25.50 }
@@ -78,6 +107,7 @@ app.get('/', (req, res) => {
 // Routes
 app.use('/api/users', userRoutes);
 app.use('/api/orders', orderRoutes);
+app.use('/api/auth', authRoutes);
 
 // 404 handler
 app.use((req, res) => {
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+)
+
+// Role is what an authenticated caller is allowed to do.
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleAdmin    Role = "admin"
+)
+
+// Identity is the authenticated end user calling an RPC.
+type Identity struct {
+	UserID int32
+	Role   Role
+}
+
+// String describes the caller for logs and audit trails, e.g. "user:42".
+func (id *Identity) String() string {
+	return "user:" + strconv.Itoa(int(id.UserID))
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the caller's identity, if the RPC was authenticated.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
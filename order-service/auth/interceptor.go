@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+)
+
+// Reason codes sent in the ErrorInfo of authentication and authorization
+// errors.
+const (
+	reasonMissingCredentials = "MISSING_CREDENTIALS"
+	reasonInvalidToken       = "INVALID_TOKEN"
+	reasonRoleNotAllowed     = "ROLE_NOT_ALLOWED"
+)
+
+// exemptPrefixes are infrastructure services that never require a token.
+var exemptPrefixes = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// Authenticator checks the bearer token on every incoming RPC and stores
+// the caller's Identity in the context.
+type Authenticator struct {
+	verifier *Verifier
+}
+
+func NewAuthenticator(verifier *Verifier) *Authenticator {
+	return &Authenticator{verifier: verifier}
+}
+
+// UnaryServerInterceptor rejects unauthenticated calls with
+// codes.Unauthenticated.
+func (a *Authenticator) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func (a *Authenticator) StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	for _, prefix := range exemptPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return ctx, nil
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return nil, rpcerror.Unauthenticated(reasonMissingCredentials, "missing bearer token")
+	}
+	if len(values[0]) <= len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return nil, rpcerror.Unauthenticated(reasonInvalidToken, "authorization must be a bearer token")
+	}
+
+	claims, err := a.verifier.Verify(ctx, values[0][len(bearerPrefix):])
+	if err != nil {
+		slog.DebugContext(ctx, "Rejected bearer token", "method", fullMethod, "error", err)
+		return nil, rpcerror.Unauthenticated(reasonInvalidToken, "invalid or expired token")
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, rpcerror.Unauthenticated(reasonInvalidToken, "invalid or expired token")
+	}
+	return WithIdentity(ctx, &Identity{UserID: userID, Role: Role(claims.Role)}), nil
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
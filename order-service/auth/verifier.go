@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "order-service/proto/user"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRefetchInterval limits how often an unknown key ID can trigger a JWKS
+// fetch, so that forged tokens cannot be used to flood the User Service.
+const minRefetchInterval = 10 * time.Second
+
+// KeySource fetches the JSON Web Key Set published by the User Service.
+type KeySource func(ctx context.Context) ([]*pb.JSONWebKey, error)
+
+// Config controls which access tokens the Verifier accepts.
+type Config struct {
+	Issuer   string
+	Audience string
+
+	// RefreshInterval is how often the key set is re-fetched.
+	RefreshInterval time.Duration
+}
+
+// ConfigFromEnv reads TOKEN_ISSUER, TOKEN_AUDIENCE and JWKS_REFRESH_INTERVAL.
+// Issuer and audience must match the User Service's settings.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Issuer:          "user-service",
+		Audience:        "grpc-microservices",
+		RefreshInterval: time.Minute,
+	}
+	if value := os.Getenv("TOKEN_ISSUER"); value != "" {
+		cfg.Issuer = value
+	}
+	if value := os.Getenv("TOKEN_AUDIENCE"); value != "" {
+		cfg.Audience = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("JWKS_REFRESH_INTERVAL")); err == nil && value > 0 {
+		cfg.RefreshInterval = value
+	}
+	return cfg
+}
+
+// Claims are the claims carried by an access token. The subject is the
+// user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+}
+
+// UserID returns the user ID named by the subject claim.
+func (c *Claims) UserID() (int32, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject %q", c.Subject)
+	}
+	return int32(id), nil
+}
+
+// Verifier checks access tokens offline against a cached copy of the User
+// Service's public keys.
+type Verifier struct {
+	cfg   Config
+	fetch KeySource
+
+	mu          sync.RWMutex
+	keys        map[string]*ecdsa.PublicKey
+	lastFetched time.Time
+
+	fetchMu sync.Mutex
+}
+
+func NewVerifier(cfg Config, fetch KeySource) *Verifier {
+	return &Verifier{
+		cfg:   cfg,
+		fetch: fetch,
+		keys:  make(map[string]*ecdsa.PublicKey),
+	}
+}
+
+// Run fetches the key set immediately and then every RefreshInterval until
+// ctx is cancelled.
+func (v *Verifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(v.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := v.refresh(ctx); err != nil {
+			slog.WarnContext(ctx, "Error fetching JWKS", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Verify checks an access token's signature, issuer, audience and expiry
+// and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(token *jwt.Token) (any, error) {
+			return v.publicKey(ctx, token)
+		},
+		jwt.WithValidMethods([]string{"ES256"}),
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithAudience(v.cfg.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// publicKey looks up the token's signing key, re-fetching the key set once
+// if the key ID is unknown, since the User Service may have just rotated.
+func (v *Verifier) publicKey(ctx context.Context, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key := v.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	v.mu.RLock()
+	stale := time.Since(v.lastFetched) >= minRefetchInterval
+	v.mu.RUnlock()
+	if stale {
+		if err := v.refresh(ctx); err != nil {
+			slog.WarnContext(ctx, "Error fetching JWKS", "error", err)
+		}
+		if key := v.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (v *Verifier) lookup(kid string) *ecdsa.PublicKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.keys[kid]
+}
+
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.fetchMu.Lock()
+	defer v.fetchMu.Unlock()
+
+	jwks, err := v.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*ecdsa.PublicKey, len(jwks))
+	for _, jwk := range jwks {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping unusable JWK", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.lastFetched = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+func parseJWK(jwk *pb.JSONWebKey) (*ecdsa.PublicKey, error) {
+	if jwk.Kty != "EC" || jwk.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported key type %s/%s", jwk.Kty, jwk.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point is not on curve")
+	}
+	return key, nil
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "order-service/proto/user"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKey is a signing key of the User Service.
+type testKey struct {
+	kid     string
+	private *ecdsa.PrivateKey
+}
+
+func newTestKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, private: private}
+}
+
+func (k testKey) jwk() *pb.JSONWebKey {
+	return &pb.JSONWebKey{
+		Kty: "EC",
+		Kid: k.kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(k.private.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(k.private.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// sign returns an access token for userID, changed by edit before signing.
+func (k testKey) sign(t *testing.T, userID int32, edit func(*Claims)) string {
+	t.Helper()
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "user-service",
+			Subject:   strconv.Itoa(int(userID)),
+			Audience:  jwt.ClaimStrings{"grpc-microservices"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+		},
+		Role: "customer",
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// fakeKeySource serves a key set that tests can change, counting fetches.
+type fakeKeySource struct {
+	keys    []*pb.JSONWebKey
+	fetches int
+}
+
+func (s *fakeKeySource) fetch(ctx context.Context) ([]*pb.JSONWebKey, error) {
+	s.fetches++
+	return s.keys, nil
+}
+
+func newTestVerifier(t *testing.T, source *fakeKeySource) *Verifier {
+	t.Helper()
+	v := NewVerifier(Config{Issuer: "user-service", Audience: "grpc-microservices", RefreshInterval: time.Minute}, source.fetch)
+	if err := v.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestKey(t, "key-1")
+	v := newTestVerifier(t, &fakeKeySource{keys: []*pb.JSONWebKey{key.jwk()}})
+
+	claims, err := v.Verify(context.Background(), key.sign(t, 7, nil))
+	if err != nil {
+		t.Fatalf("Verify = %v", err)
+	}
+	if id, err := claims.UserID(); err != nil || id != 7 || claims.Role != "customer" {
+		t.Errorf("claims = user %d (%v), role %q", id, err, claims.Role)
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	key := newTestKey(t, "key-1")
+	v := newTestVerifier(t, &fakeKeySource{keys: []*pb.JSONWebKey{key.jwk()}})
+	forged := newTestKey(t, "key-1")
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, &Claims{}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, signed := range map[string]string{
+		"other issuer":   key.sign(t, 7, func(c *Claims) { c.Issuer = "someone-else" }),
+		"other audience": key.sign(t, 7, func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }),
+		"expired":        key.sign(t, 7, func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }),
+		"no expiry":      key.sign(t, 7, func(c *Claims) { c.ExpiresAt = nil }),
+		"forged key":     forged.sign(t, 7, nil),
+		"alg none":       none,
+	} {
+		if _, err := v.Verify(context.Background(), signed); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestVerifyFollowsKeyRotation(t *testing.T) {
+	oldKey, newKey := newTestKey(t, "key-1"), newTestKey(t, "key-2")
+	source := &fakeKeySource{keys: []*pb.JSONWebKey{oldKey.jwk()}}
+	v := newTestVerifier(t, source)
+	oldToken := oldKey.sign(t, 7, nil)
+
+	// The User Service rotates; the old key stays published for a while
+	source.keys = []*pb.JSONWebKey{newKey.jwk(), oldKey.jwk()}
+	newToken := newKey.sign(t, 7, nil)
+
+	// Right after a fetch, an unknown key does not trigger another one
+	if _, err := v.Verify(context.Background(), newToken); err == nil {
+		t.Fatal("token with an unknown key accepted without a fetch")
+	}
+	if source.fetches != 1 {
+		t.Fatalf("%d fetches, want 1: unknown keys must not refetch within minRefetchInterval", source.fetches)
+	}
+
+	// Later, the unknown key is fetched on demand
+	v.lastFetched = time.Now().Add(-minRefetchInterval)
+	for name, signed := range map[string]string{"new": newToken, "old": oldToken} {
+		if _, err := v.Verify(context.Background(), signed); err != nil {
+			t.Errorf("%s token rejected after rotation: %v", name, err)
+		}
+	}
+	if source.fetches != 2 {
+		t.Errorf("%d fetches, want 2", source.fetches)
+	}
+
+	// Once the old key is withdrawn, its tokens are rejected
+	source.keys = []*pb.JSONWebKey{newKey.jwk()}
+	if err := v.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(context.Background(), oldToken); err == nil {
+		t.Error("token signed by a withdrawn key accepted")
+	}
+	if _, err := v.Verify(context.Background(), newToken); err != nil {
+		t.Errorf("current token rejected: %v", err)
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	key := newTestKey(t, "key-1")
+	if _, err := parseJWK(key.jwk()); err != nil {
+		t.Fatalf("parseJWK = %v", err)
+	}
+
+	for name, edit := range map[string]func(*pb.JSONWebKey){
+		"RSA key":      func(jwk *pb.JSONWebKey) { jwk.Kty = "RSA" },
+		"other curve":  func(jwk *pb.JSONWebKey) { jwk.Crv = "P-384" },
+		"off curve":    func(jwk *pb.JSONWebKey) { jwk.Y = base64.RawURLEncoding.EncodeToString(make([]byte, 32)) },
+		"bad encoding": func(jwk *pb.JSONWebKey) { jwk.X = "!!" },
+	} {
+		jwk := key.jwk()
+		edit(jwk)
+		if _, err := parseJWK(jwk); err == nil {
+			t.Errorf("%s: parseJWK accepted it", name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops calling a downstream service after a run of
+// consecutive failures. While open, calls fail immediately with
+// codes.Unavailable; after openTimeout a single trial call is let through
+// and its outcome decides whether the breaker closes again.
+type circuitBreaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+}
+
+// allow reports whether a call may proceed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call made with ctx.
+// Calls the caller gave up on are not counted either way; a half-open
+// breaker lets the next call through as its trial instead.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if callerGaveUp(ctx, err) {
+		return
+	}
+	if !isBreakerFailure(err) {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// retryAfter is how long until the open breaker lets a trial call through.
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if remaining := b.openTimeout - b.now().Sub(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state != state {
+		slog.Warn("Circuit breaker state changed", "target", b.name, "state", state.String())
+		b.state = state
+	}
+}
+
+// unaryInterceptor guards every unary call made on the connection.
+func (b *circuitBreaker) unaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if !b.allow() {
+		return rpcerror.Unavailable("CIRCUIT_OPEN", fmt.Sprintf("%s circuit breaker is open", b.name), b.retryAfter())
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	b.record(ctx, err)
+	return err
+}
+
+// errCallTimeout is the cause of a call context that ran out of the
+// client's CallTimeout rather than the caller's own deadline.
+var errCallTimeout = errors.New("user service call timed out")
+
+// callerGaveUp reports whether a call ended because the caller cancelled it
+// or its own deadline passed first, which says nothing about the health of
+// the downstream service.
+func callerGaveUp(ctx context.Context, err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled:
+		return true
+	case codes.DeadlineExceeded:
+		return ctx.Err() != nil && !errors.Is(context.Cause(ctx), errCallTimeout)
+	default:
+		return false
+	}
+}
+
+// isBreakerFailure reports whether err indicates the downstream service is
+// unhealthy, as opposed to a normal application error.
+func isBreakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// newTestBreaker returns a breaker that opens after 3 failures for 10
+// seconds, and a function that moves its clock forward.
+func newTestBreaker() (*circuitBreaker, func(time.Duration)) {
+	b := newCircuitBreaker("test", 3, 10*time.Second)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+var (
+	errUnavailable = status.Error(codes.Unavailable, "connection refused")
+	errNotFound    = status.Error(codes.NotFound, "user not found")
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	b, advance := newTestBreaker()
+	ctx := context.Background()
+
+	// closed: failures below the threshold let calls through
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("call %d rejected while closed", i+1)
+		}
+		b.record(ctx, errUnavailable)
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("state after 2 failures = %v, want closed", b.state)
+	}
+
+	// closed -> open
+	b.allow()
+	b.record(ctx, errUnavailable)
+	if b.state != breakerOpen || b.allow() {
+		t.Fatalf("state after 3 failures = %v, want open and rejecting", b.state)
+	}
+	if got := b.retryAfter(); got != 10*time.Second {
+		t.Errorf("retryAfter = %v, want 10s", got)
+	}
+
+	// open -> half-open: one trial call after the timeout
+	advance(10 * time.Second)
+	if !b.allow() {
+		t.Fatal("trial call rejected after the open timeout")
+	}
+	if b.state != breakerHalfOpen || b.allow() {
+		t.Fatalf("state = %v, want half-open allowing a single trial", b.state)
+	}
+
+	// half-open -> open: a failed trial opens the breaker again
+	b.record(ctx, errUnavailable)
+	if b.state != breakerOpen || b.allow() {
+		t.Fatalf("state after a failed trial = %v, want open", b.state)
+	}
+
+	// half-open -> closed: a successful trial closes it
+	advance(10 * time.Second)
+	b.allow()
+	b.record(ctx, nil)
+	if b.state != breakerClosed || b.failures != 0 {
+		t.Fatalf("state after a successful trial = %v with %d failures, want closed", b.state, b.failures)
+	}
+	if !b.allow() || !b.allow() {
+		t.Error("closed breaker rejected calls")
+	}
+}
+
+func TestBreakerCountsConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker()
+	ctx := context.Background()
+
+	for _, err := range []error{errUnavailable, errUnavailable, nil, errUnavailable, errUnavailable, errNotFound, errUnavailable} {
+		b.allow()
+		b.record(ctx, err)
+	}
+	if b.state != breakerClosed {
+		t.Errorf("state = %v; successes and application errors must reset the count", b.state)
+	}
+}
+
+func TestBreakerFailureCodes(t *testing.T) {
+	for code, failure := range map[codes.Code]bool{
+		codes.Unavailable:       true,
+		codes.DeadlineExceeded:  true,
+		codes.ResourceExhausted: true,
+		codes.Internal:          true,
+		codes.Unknown:           true,
+		codes.NotFound:          false,
+		codes.InvalidArgument:   false,
+		codes.PermissionDenied:  false,
+		codes.Unauthenticated:   false,
+	} {
+		if got := isBreakerFailure(status.Error(code, "")); got != failure {
+			t.Errorf("isBreakerFailure(%v) = %v, want %v", code, got, failure)
+		}
+	}
+}
+
+func TestBreakerIgnoresCallsTheCallerGaveUpOn(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	c := &UserServiceClient{timeout: 0}
+	timedOut, cancel := c.withCallTimeout(context.Background())
+	defer cancel()
+	<-timedOut.Done()
+
+	for _, tc := range []struct {
+		name    string
+		ctx     context.Context
+		err     error
+		counted bool
+	}{
+		{"cancelled by the caller", cancelled, status.Error(codes.Canceled, "context canceled"), false},
+		{"caller's deadline", expired, status.Error(codes.DeadlineExceeded, "context deadline exceeded"), false},
+		{"call timeout", timedOut, status.Error(codes.DeadlineExceeded, "context deadline exceeded"), true},
+		{"deadline reported by the server", context.Background(), status.Error(codes.DeadlineExceeded, "upstream timeout"), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, advance := newTestBreaker()
+			b.failures = 2
+			b.allow()
+			b.record(tc.ctx, tc.err)
+			if opened := b.state == breakerOpen; opened != tc.counted {
+				t.Fatalf("opened = %v, want %v", opened, tc.counted)
+			}
+			if tc.counted {
+				return
+			}
+			if b.failures != 2 {
+				t.Errorf("failures = %d, want the count unchanged", b.failures)
+			}
+
+			// A half-open breaker lets the next call through as its trial
+			b.failures = 3
+			b.openedAt = b.now()
+			b.state = breakerOpen
+			advance(10 * time.Second)
+			b.allow()
+			b.record(tc.ctx, tc.err)
+			if b.state != breakerHalfOpen || !b.allow() {
+				t.Errorf("state = %v, want half-open with a new trial", b.state)
+			}
+		})
+	}
+}
+
+func TestBreakerInterceptorFailsFastWhenOpen(t *testing.T) {
+	b, _ := newTestBreaker()
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return errUnavailable
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := b.unaryInterceptor(context.Background(), "/user.UserService/GetUser", nil, nil, nil, invoker); !errors.Is(err, errUnavailable) {
+			t.Fatalf("call %d = %v, want the downstream error", i+1, err)
+		}
+	}
+	err := b.unaryInterceptor(context.Background(), "/user.UserService/GetUser", nil, nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable || rpcerror.Reason(err) != "CIRCUIT_OPEN" {
+		t.Errorf("call to an open breaker = %v, want Unavailable with reason CIRCUIT_OPEN", err)
+	}
+	if calls != 3 {
+		t.Errorf("downstream called %d times, want 3", calls)
+	}
+}
+
+func TestRetryServiceConfig(t *testing.T) {
+	cfg := Config{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, BackoffMultiplier: 2}
+
+	var parsed struct {
+		MethodConfig []struct {
+			Name        []struct{ Service, Method string }
+			RetryPolicy struct {
+				MaxAttempts          int
+				InitialBackoff       string
+				MaxBackoff           string
+				BackoffMultiplier    float64
+				RetryableStatusCodes []string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(retryServiceConfig(cfg)), &parsed); err != nil {
+		t.Fatalf("service config is not JSON: %v", err)
+	}
+	if len(parsed.MethodConfig) != 1 {
+		t.Fatalf("%d method configs, want 1", len(parsed.MethodConfig))
+	}
+	methods := parsed.MethodConfig[0].Name
+	if len(methods) != 2 || methods[0].Method != "ValidateUser" || methods[1].Method != "GetUser" {
+		t.Errorf("retried methods = %+v, want only ValidateUser and GetUser", methods)
+	}
+	policy := parsed.MethodConfig[0].RetryPolicy
+	if policy.MaxAttempts != 3 || policy.InitialBackoff != "0.100s" || policy.MaxBackoff != "1.000s" || policy.BackoffMultiplier != 2 {
+		t.Errorf("retry policy = %+v", policy)
+	}
+	if len(policy.RetryableStatusCodes) != 1 || policy.RetryableStatusCodes[0] != "UNAVAILABLE" {
+		t.Errorf("retryable codes = %v, want only UNAVAILABLE", policy.RetryableStatusCodes)
+	}
+
+	// gRPC rejects an invalid default service config when dialling
+	if _, err := grpc.NewClient("localhost:0", grpc.WithDefaultServiceConfig(retryServiceConfig(cfg)), grpc.WithTransportCredentials(insecure.NewCredentials())); err != nil {
+		t.Errorf("gRPC rejected the service config: %v", err)
+	}
+
+	if got := retryServiceConfig(Config{MaxAttempts: 1}); got != `{}` {
+		t.Errorf("config with a single attempt = %s, want no retries", got)
+	}
+}
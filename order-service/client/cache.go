@@ -0,0 +1,171 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	pb "order-service/proto/user"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// CacheStats is a snapshot of the user cache counters.
+type CacheStats struct {
+	Hits          uint64
+	NegativeHits  uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Size          int
+}
+
+// HitRate returns the fraction of lookups served from the cache.
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.NegativeHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.NegativeHits) / float64(total)
+}
+
+type cacheEntry struct {
+	userID    int32
+	user      *pb.User // nil for a cached "user not found"
+	expiresAt time.Time
+}
+
+// userCache is a bounded LRU cache of ValidateUser results. Users that do
+// not exist are cached too, with a shorter TTL.
+type userCache struct {
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[int32]*list.Element
+	order   *list.List // front is most recently used
+	stats   CacheStats
+
+	// generation counts invalidations. A lookup records it before calling
+	// the User Service and passes it to put, which drops the result if an
+	// invalidation happened in between: the result may predate the change.
+	generation uint64
+}
+
+func newUserCache(capacity int, ttl, negativeTTL time.Duration) *userCache {
+	return &userCache{
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[int32]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// get returns the cached result for userID. found reports whether the
+// cache had a live entry; user is nil if that entry records a missing user.
+func (c *userCache) get(userID int32) (user *pb.User, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[userID]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	if entry.user == nil {
+		c.stats.NegativeHits++
+		return nil, true
+	}
+	c.stats.Hits++
+	return proto.Clone(entry.user).(*pb.User), true
+}
+
+// currentGeneration returns the value to pass to put for a lookup starting now.
+func (c *userCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put stores the result of a lookup started at generation; a nil user
+// records that it does not exist. The result is discarded if the cache was
+// invalidated since the lookup started.
+func (c *userCache) put(userID int32, user *pb.User, generation uint64) {
+	ttl := c.ttl
+	if user == nil {
+		ttl = c.negativeTTL
+	} else {
+		user = proto.Clone(user).(*pb.User)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[userID]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.user = user
+		entry.expiresAt = time.Now().Add(ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	entry := &cacheEntry{userID: userID, user: user, expiresAt: time.Now().Add(ttl)}
+	c.entries[userID] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate drops any cached result for userID.
+func (c *userCache) invalidate(userID int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[userID]; ok {
+		c.removeElement(elem)
+		c.stats.Invalidations++
+	}
+}
+
+// invalidateAll empties the cache.
+func (c *userCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations += uint64(c.order.Len())
+	c.entries = make(map[int32]*list.Element)
+	c.order.Init()
+}
+
+func (c *userCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.order.Len()
+	return stats
+}
+
+func (c *userCache) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.userID)
+}
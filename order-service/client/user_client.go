@@ -2,55 +2,189 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strconv"
 	"time"
 
 	pb "order-service/proto/user"
+	"order-service/tlsconfig"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// Config controls how the order service talks to the User Service.
+type Config struct {
+	URL string
+
+	// ServiceToken identifies the order service to the User Service. It is
+	// sent as x-service-token metadata on every call.
+	ServiceToken string
+
+	// TLS secures the connection. With a client certificate, the User
+	// Service can also identify the order service by it (mutual TLS).
+	TLS tlsconfig.Config
+
+	// CallTimeout bounds each call, including retries.
+	CallTimeout time.Duration
+
+	// Retry policy for idempotent calls (ValidateUser, GetUser).
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// Circuit breaker settings.
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+
+	// User lookup cache; a CacheSize of 0 disables caching.
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+}
+
+// ConfigFromEnv reads the client configuration from USER_SERVICE_* variables.
+func ConfigFromEnv() Config {
+	return Config{
+		URL:                     getEnv("USER_SERVICE_URL", "localhost:50051"),
+		ServiceToken:            getEnv("USER_SERVICE_TOKEN", ""),
+		TLS:                     tlsconfig.ClientConfigFromEnv("USER_SERVICE_"),
+		CallTimeout:             getEnvDuration("USER_SERVICE_TIMEOUT", 3*time.Second),
+		MaxAttempts:             getEnvInt("USER_SERVICE_MAX_ATTEMPTS", 3),
+		InitialBackoff:          getEnvDuration("USER_SERVICE_INITIAL_BACKOFF", 100*time.Millisecond),
+		MaxBackoff:              getEnvDuration("USER_SERVICE_MAX_BACKOFF", time.Second),
+		BackoffMultiplier:       getEnvFloat("USER_SERVICE_BACKOFF_MULTIPLIER", 2),
+		BreakerFailureThreshold: getEnvInt("USER_SERVICE_BREAKER_THRESHOLD", 5),
+		BreakerOpenTimeout:      getEnvDuration("USER_SERVICE_BREAKER_TIMEOUT", 10*time.Second),
+		CacheSize:               getEnvInt("USER_CACHE_SIZE", 10000),
+		CacheTTL:                getEnvDuration("USER_CACHE_TTL", time.Minute),
+		CacheNegativeTTL:        getEnvDuration("USER_CACHE_NEGATIVE_TTL", 5*time.Second),
+	}
+}
+
+// validate checks that the order service can identify itself to the User
+// Service, which rejects anonymous callers.
+func (cfg Config) validate() error {
+	if cfg.ServiceToken == "" && !(cfg.TLS.Enabled && cfg.TLS.CertFile != "") {
+		return errors.New("USER_SERVICE_TOKEN or a client certificate (USER_SERVICE_TLS_CERT_FILE) is required to call the User Service")
+	}
+	return nil
+}
+
+const serviceTokenHeader = "x-service-token"
+
 type UserServiceClient struct {
-	client pb.UserServiceClient
-	conn   *grpc.ClientConn
+	client  pb.UserServiceClient
+	health  healthpb.HealthClient
+	conn    *grpc.ClientConn
+	timeout time.Duration
+	cache   *userCache // nil when caching is disabled
+	stop    context.CancelFunc
 }
 
-func NewUserServiceClient() (*UserServiceClient, error) {
-	userServiceURL := os.Getenv("USER_SERVICE_URL")
-	if userServiceURL == "" {
-		userServiceURL = "localhost:50051"
+// NewUserServiceClient creates a client for the User Service. The
+// connection is established lazily, so the order service can start while
+// the User Service is still down. Extra dial options (e.g. interceptors)
+// are applied outside the circuit breaker.
+func NewUserServiceClient(opts ...grpc.DialOption) (*UserServiceClient, error) {
+	cfg := ConfigFromEnv()
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
-	log.Printf("Connecting to User Service at %s", userServiceURL)
+	slog.Info("Connecting to User Service", "url", cfg.URL, "tls", cfg.TLS.Enabled)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	creds, err := tlsconfig.ClientCredentials(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user service TLS credentials: %v", err)
+	}
+
+	breaker := newCircuitBreaker("user-service", cfg.BreakerFailureThreshold, cfg.BreakerOpenTimeout)
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(retryServiceConfig(cfg)),
+	}
+	dialOpts = append(dialOpts, opts...)
+	dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(breaker.unaryInterceptor))
+	if cfg.ServiceToken != "" {
+		creds := serviceToken(cfg.ServiceToken)
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(creds.unaryInterceptor),
+			grpc.WithChainStreamInterceptor(creds.streamInterceptor),
+		)
+	}
 
-	conn, err := grpc.DialContext(
-		ctx,
-		userServiceURL,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
+	conn, err := grpc.NewClient(cfg.URL, dialOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to user service: %v", err)
+		return nil, fmt.Errorf("failed to create user service client: %v", err)
+	}
+
+	c := &UserServiceClient{
+		client:  pb.NewUserServiceClient(conn),
+		health:  healthpb.NewHealthClient(conn),
+		conn:    conn,
+		timeout: cfg.CallTimeout,
+		stop:    func() {},
 	}
 
-	client := pb.NewUserServiceClient(conn)
+	if cfg.CacheSize > 0 {
+		c.cache = newUserCache(cfg.CacheSize, cfg.CacheTTL, cfg.CacheNegativeTTL)
 
-	log.Println("Successfully connected to User Service")
+		ctx, cancel := context.WithCancel(context.Background())
+		c.stop = cancel
+		go c.watchUserEvents(ctx)
+	}
 
-	return &UserServiceClient{
-		client: client,
-		conn:   conn,
-	}, nil
+	return c, nil
+}
+
+// retryServiceConfig builds a gRPC service config that retries the
+// idempotent User Service methods on UNAVAILABLE.
+func retryServiceConfig(cfg Config) string {
+	if cfg.MaxAttempts < 2 {
+		return `{}`
+	}
+	return fmt.Sprintf(`{
+		"methodConfig": [{
+			"name": [
+				{"service": "user.UserService", "method": "ValidateUser"},
+				{"service": "user.UserService", "method": "GetUser"}
+			],
+			"retryPolicy": {
+				"maxAttempts": %d,
+				"initialBackoff": "%.3fs",
+				"maxBackoff": "%.3fs",
+				"backoffMultiplier": %g,
+				"retryableStatusCodes": ["UNAVAILABLE"]
+			}
+		}]
+	}`, cfg.MaxAttempts, cfg.InitialBackoff.Seconds(), cfg.MaxBackoff.Seconds(), cfg.BackoffMultiplier)
 }
 
 func (c *UserServiceClient) ValidateUser(ctx context.Context, userID int32) (bool, *pb.User, error) {
-	log.Printf("Validating user with ID: %d", userID)
+	if c.cache != nil {
+		if user, found := c.cache.get(userID); found {
+			return user != nil, user, nil
+		}
+	}
+
+	var generation uint64
+	if c.cache != nil {
+		generation = c.cache.currentGeneration()
+	}
+
+	slog.DebugContext(ctx, "Calling ValidateUser", "user_id", userID)
+
+	ctx, cancel := c.withCallTimeout(ctx)
+	defer cancel()
 
 	resp, err := c.client.ValidateUser(ctx, &pb.ValidateUserRequest{
 		UserId: userID,
@@ -59,11 +193,33 @@ func (c *UserServiceClient) ValidateUser(ctx context.Context, userID int32) (boo
 		return false, nil, err
 	}
 
+	if c.cache != nil {
+		if resp.IsValid {
+			c.cache.put(userID, resp.User, generation)
+		} else {
+			c.cache.put(userID, nil, generation)
+		}
+	}
+
 	return resp.IsValid, resp.User, nil
 }
 
 func (c *UserServiceClient) GetUser(ctx context.Context, userID int32) (*pb.User, error) {
-	log.Printf("Getting user with ID: %d", userID)
+	if c.cache != nil {
+		if user, found := c.cache.get(userID); found && user != nil {
+			return user, nil
+		}
+	}
+
+	var generation uint64
+	if c.cache != nil {
+		generation = c.cache.currentGeneration()
+	}
+
+	slog.DebugContext(ctx, "Calling GetUser", "user_id", userID)
+
+	ctx, cancel := c.withCallTimeout(ctx)
+	defer cancel()
 
 	resp, err := c.client.GetUser(ctx, &pb.GetUserRequest{
 		Id: userID,
@@ -72,12 +228,142 @@ func (c *UserServiceClient) GetUser(ctx context.Context, userID int32) (*pb.User
 		return nil, err
 	}
 
+	if c.cache != nil {
+		c.cache.put(userID, resp.User, generation)
+	}
+
 	return resp.User, nil
 }
 
+// withCallTimeout bounds a call by the configured CallTimeout. Running out
+// of it counts against the circuit breaker; the caller's own deadline does
+// not.
+func (c *UserServiceClient) withCallTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, c.timeout, errCallTimeout)
+}
+
+// GetJWKS fetches the public keys the User Service signs access tokens with.
+func (c *UserServiceClient) GetJWKS(ctx context.Context) ([]*pb.JSONWebKey, error) {
+	ctx, cancel := c.withCallTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.client.GetJWKS(ctx, &pb.GetJWKSRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Ping checks that the User Service reports itself as SERVING.
+func (c *UserServiceClient) Ping(ctx context.Context) error {
+	resp, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{
+		Service: pb.UserService_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("user service is %s", resp.Status)
+	}
+	return nil
+}
+
+// InvalidateUser drops any cached lookup for userID.
+func (c *UserServiceClient) InvalidateUser(userID int32) {
+	if c.cache != nil {
+		c.cache.invalidate(userID)
+	}
+}
+
+// CacheStats returns the user cache counters.
+func (c *UserServiceClient) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.snapshot()
+}
+
+// watchUserEvents subscribes to the User Service event stream and
+// invalidates cached users as they change. Events may have been missed
+// whenever the stream is (re)established, so the whole cache is dropped
+// at that point.
+func (c *UserServiceClient) watchUserEvents(ctx context.Context) {
+	backoff := time.Second
+	for {
+		stream, err := c.client.WatchUserEvents(ctx, &pb.WatchUserEventsRequest{})
+		if err == nil {
+			c.cache.invalidateAll()
+			for {
+				var event *pb.UserEvent
+				event, err = stream.Recv()
+				if err != nil {
+					break
+				}
+				backoff = time.Second
+				c.cache.invalidate(event.UserId)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) != codes.Unavailable {
+			slog.WarnContext(ctx, "User event stream ended", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// serviceToken attaches the order service's credentials to outgoing calls.
+type serviceToken string
+
+func (t serviceToken) unaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(metadata.AppendToOutgoingContext(ctx, serviceTokenHeader, string(t)), method, req, reply, cc, opts...)
+}
+
+func (t serviceToken) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(metadata.AppendToOutgoingContext(ctx, serviceTokenHeader, string(t)), desc, cc, method, opts...)
+}
+
 func (c *UserServiceClient) Close() {
+	c.stop()
 	if c.conn != nil {
 		c.conn.Close()
 	}
 }
 
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
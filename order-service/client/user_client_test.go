@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "order-service/proto/user"
+	"order-service/tlsconfig"
+
+	"google.golang.org/grpc"
+)
+
+// racingUserService answers ValidateUser with a valid user, running
+// duringCall while the call is in flight.
+type racingUserService struct {
+	pb.UserServiceClient
+	duringCall func()
+	calls      int
+}
+
+func (s *racingUserService) ValidateUser(ctx context.Context, req *pb.ValidateUserRequest, opts ...grpc.CallOption) (*pb.ValidateUserResponse, error) {
+	s.calls++
+	if s.duringCall != nil {
+		s.duringCall()
+	}
+	return &pb.ValidateUserResponse{IsValid: true, User: &pb.User{Id: req.UserId, Name: "Alice"}}, nil
+}
+
+func newTestClient(service pb.UserServiceClient) *UserServiceClient {
+	return &UserServiceClient{
+		client:  service,
+		timeout: time.Second,
+		cache:   newUserCache(10, time.Minute, time.Minute),
+		stop:    func() {},
+	}
+}
+
+func TestValidateUserDoesNotCacheResultInvalidatedDuringCall(t *testing.T) {
+	for name, invalidate := range map[string]func(c *UserServiceClient){
+		"user":       func(c *UserServiceClient) { c.InvalidateUser(1) },
+		"other user": func(c *UserServiceClient) { c.InvalidateUser(2) },
+		"all":        func(c *UserServiceClient) { c.cache.invalidateAll() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := &racingUserService{}
+			c := newTestClient(service)
+			// A delete event for the user arrives after the User Service
+			// answered but before the answer is cached
+			service.duringCall = func() { invalidate(c) }
+
+			if valid, _, err := c.ValidateUser(context.Background(), 1); err != nil || !valid {
+				t.Fatalf("ValidateUser = %v, %v; want true, nil", valid, err)
+			}
+			if _, found := c.cache.get(1); found {
+				t.Fatal("result fetched before the invalidation was cached")
+			}
+
+			// The next lookup asks the User Service again
+			service.duringCall = nil
+			if _, _, err := c.ValidateUser(context.Background(), 1); err != nil {
+				t.Fatal(err)
+			}
+			if service.calls != 2 {
+				t.Fatalf("User Service called %d times, want 2", service.calls)
+			}
+		})
+	}
+}
+
+func TestValidateUserCachesResult(t *testing.T) {
+	service := &racingUserService{}
+	c := newTestClient(service)
+
+	for i := 0; i < 3; i++ {
+		if valid, user, err := c.ValidateUser(context.Background(), 1); err != nil || !valid || user.Id != 1 {
+			t.Fatalf("ValidateUser = %v, %v, %v", valid, user, err)
+		}
+	}
+	if service.calls != 1 {
+		t.Fatalf("User Service called %d times, want 1", service.calls)
+	}
+}
+
+func TestUserCachePutAfterInvalidate(t *testing.T) {
+	c := newUserCache(10, time.Minute, time.Minute)
+	user := &pb.User{Id: 1}
+
+	generation := c.currentGeneration()
+	c.invalidate(1)
+	c.put(1, user, generation)
+	if _, found := c.get(1); found {
+		t.Fatal("stale result cached after invalidate")
+	}
+
+	c.put(1, user, c.currentGeneration())
+	if got, found := c.get(1); !found || got.Id != 1 {
+		t.Fatalf("get = %v, %v; want user 1", got, found)
+	}
+}
+
+func TestConfigRequiresCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   Config
+		valid bool
+	}{
+		{"nothing", Config{}, false},
+		{"service token", Config{ServiceToken: "token"}, true},
+		{"client certificate", Config{TLS: tlsconfig.Config{Enabled: true, CertFile: "client.pem"}}, true},
+		{"TLS without a certificate", Config{TLS: tlsconfig.Config{Enabled: true, CAFile: "ca.pem"}}, false},
+	} {
+		if err := tc.cfg.validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: validate = %v, want valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
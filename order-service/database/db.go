@@ -3,10 +3,12 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 var DB *sql.DB
@@ -22,7 +24,8 @@ func InitDB() error {
 		host, port, user, password, dbname)
 
 	var err error
-	DB, err = sql.Open("postgres", connStr)
+	DB, err = otelsql.Open("postgres", connStr,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(dbname)))
 	if err != nil {
 		return fmt.Errorf("error opening database: %v", err)
 	}
@@ -31,7 +34,7 @@ func InitDB() error {
 		return fmt.Errorf("error connecting to database: %v", err)
 	}
 
-	log.Println("Successfully connected to PostgreSQL database")
+	slog.Info("Successfully connected to PostgreSQL database", "host", host, "database", dbname)
 
 	// Create tables
 	if err := createTables(); err != nil {
@@ -49,11 +52,15 @@ func createTables() error {
 		user_name VARCHAR(255),
 		user_email VARCHAR(255),
 		total_amount DECIMAL(10, 2) NOT NULL,
+		currency VARCHAR(3) NOT NULL DEFAULT 'USD',
 		status VARCHAR(50) NOT NULL DEFAULT 'PENDING',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
+	ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+	ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
 	CREATE TABLE IF NOT EXISTS order_items (
 		id SERIAL PRIMARY KEY,
 		order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
@@ -63,8 +70,35 @@ func createTables() error {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
-	CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id);
+	CREATE TABLE IF NOT EXISTS order_status_history (
+		id SERIAL PRIMARY KEY,
+		order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+		old_status VARCHAR(50),
+		new_status VARCHAR(50) NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		owner VARCHAR(100) NOT NULL,
+		method VARCHAR(100) NOT NULL,
+		key VARCHAR(255) NOT NULL,
+		request_hash VARCHAR(64) NOT NULL,
+		response BYTEA,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (owner, method, key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+
+	DROP INDEX IF EXISTS idx_orders_user_id;
+	CREATE INDEX IF NOT EXISTS idx_orders_user_id_created_at ON orders(user_id, created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_orders_created_at_id ON orders(created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_orders_status_created_at ON orders(status, created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_orders_updated_at ON orders(updated_at);
+	CREATE INDEX IF NOT EXISTS idx_orders_total_amount_id ON orders(total_amount, id);
 	CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+	CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id);
 	`
 
 	_, err := DB.Exec(query)
@@ -72,7 +106,7 @@ func createTables() error {
 		return err
 	}
 
-	log.Println("Tables created successfully")
+	slog.Info("Tables created successfully")
 	return nil
 }
 
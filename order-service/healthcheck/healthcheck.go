@@ -0,0 +1,113 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Probe checks one dependency and returns an error if it is unhealthy.
+type Probe func(ctx context.Context) error
+
+// Checker runs its probes periodically and publishes, through the
+// grpc.health.v1 service, the status of every registered service name based
+// on the probes that name depends on.
+type Checker struct {
+	server   *health.Server
+	services map[string][]string
+	probes   map[string]Probe
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// NewChecker creates a Checker from the given named probes. services maps
+// each service name to the probes it depends on; the overall "" service
+// depends on every probe.
+func NewChecker(server *health.Server, interval time.Duration, services map[string][]string, probes map[string]Probe) *Checker {
+	return &Checker{
+		server:   server,
+		services: services,
+		probes:   probes,
+		interval: interval,
+		timeout:  interval / 2,
+	}
+}
+
+// Run probes until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	failed := make(map[string]bool)
+	for name, probe := range c.probes {
+		if err := probe(ctx); err != nil {
+			slog.WarnContext(ctx, "Health check failed", "probe", name, "error", err)
+			failed[name] = true
+		}
+	}
+
+	c.server.SetServingStatus("", servingStatus(len(failed) == 0))
+	for service, probes := range c.services {
+		healthy := true
+		for _, name := range probes {
+			healthy = healthy && !failed[name]
+		}
+		c.server.SetServingStatus(service, servingStatus(healthy))
+	}
+}
+
+func servingStatus(healthy bool) healthpb.HealthCheckResponse_ServingStatus {
+	if healthy {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// Shutdown marks every service NOT_SERVING and ignores later probe results,
+// so that clients stop routing traffic here before the server drains.
+func (c *Checker) Shutdown() {
+	c.server.Shutdown()
+}
+
+// CheckAddr asks the gRPC server at addr whether service is SERVING. It
+// backs the "healthcheck" command used by container health checks.
+func CheckAddr(addr, service string, creds credentials.TransportCredentials) error {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("service %q is %s", service, resp.Status)
+	}
+	return nil
+}
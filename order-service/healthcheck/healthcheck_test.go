@@ -0,0 +1,79 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestCheckerReportsEachServiceFromItsProbes(t *testing.T) {
+	down := errors.New("connection refused")
+	for _, tc := range []struct {
+		name     string
+		database error
+		upstream error
+		want     map[string]healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{"all healthy", nil, nil, map[string]healthpb.HealthCheckResponse_ServingStatus{
+			"":              healthpb.HealthCheckResponse_SERVING,
+			"test.Service":  healthpb.HealthCheckResponse_SERVING,
+			"test.Upstream": healthpb.HealthCheckResponse_SERVING,
+		}},
+		{"upstream down", nil, down, map[string]healthpb.HealthCheckResponse_ServingStatus{
+			"":              healthpb.HealthCheckResponse_NOT_SERVING,
+			"test.Service":  healthpb.HealthCheckResponse_SERVING,
+			"test.Upstream": healthpb.HealthCheckResponse_NOT_SERVING,
+		}},
+		{"database down", down, nil, map[string]healthpb.HealthCheckResponse_ServingStatus{
+			"":              healthpb.HealthCheckResponse_NOT_SERVING,
+			"test.Service":  healthpb.HealthCheckResponse_NOT_SERVING,
+			"test.Upstream": healthpb.HealthCheckResponse_SERVING,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := health.NewServer()
+			checker := NewChecker(server, time.Second,
+				map[string][]string{
+					"test.Service":  {"database"},
+					"test.Upstream": {"upstream"},
+				},
+				map[string]Probe{
+					"database": func(context.Context) error { return tc.database },
+					"upstream": func(context.Context) error { return tc.upstream },
+				})
+			checker.check(context.Background())
+
+			for service, want := range tc.want {
+				resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				if err != nil {
+					t.Fatalf("Check(%q): %v", service, err)
+				}
+				if resp.Status != want {
+					t.Errorf("Check(%q) = %v, want %v", service, resp.Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckerShutdown(t *testing.T) {
+	server := health.NewServer()
+	checker := NewChecker(server, time.Second,
+		map[string][]string{"test.Service": {"database"}},
+		map[string]Probe{"database": func(context.Context) error { return nil }})
+	checker.check(context.Background())
+	checker.Shutdown()
+	checker.check(context.Background())
+
+	resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "test.Service"})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status after Shutdown = %v, want NOT_SERVING", resp.Status)
+	}
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLoggerRedactsPersonalDataAndAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&contextHandler{Handler: slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redact})})
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.InfoContext(ctx, "User created", "user_id", 7, "email", "alice@example.com", "user_name", "Alice")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log line is not JSON: %v\n%s", err, buf.String())
+	}
+	for key, want := range map[string]any{
+		"request_id": "req-1",
+		"user_id":    float64(7),
+		"email":      redacted,
+		"user_name":  redacted,
+	} {
+		if record[key] != want {
+			t.Errorf("%s = %v, want %v", key, record[key], want)
+		}
+	}
+	if strings.Contains(buf.String(), "alice@example.com") {
+		t.Errorf("log line leaks the email address:\n%s", buf.String())
+	}
+}
+
+func TestIncomingRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"from metadata", "req-1", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.incoming != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(RequestIDHeader, tc.incoming))
+			}
+
+			got := RequestID(withIncomingRequestID(ctx))
+			if tc.keep && got != tc.incoming {
+				t.Errorf("request ID = %q, want %q", got, tc.incoming)
+			}
+			if !tc.keep && (got == "" || got == tc.incoming) {
+				t.Errorf("request ID = %q, want a generated one", got)
+			}
+		})
+	}
+}
+
+func TestUnaryClientInterceptorForwardsRequestID(t *testing.T) {
+	var forwarded []string
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		forwarded = md.Get(RequestIDHeader)
+		return nil
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	if err := UnaryClientInterceptor(ctx, "/user.UserService/GetUser", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarded) != 1 || forwarded[0] != "req-1" {
+		t.Errorf("forwarded %s = %v, want [req-1]", RequestIDHeader, forwarded)
+	}
+}
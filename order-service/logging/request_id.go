@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the metadata key used to carry request IDs between
+// services.
+const RequestIDHeader = "x-request-id"
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// UnaryServerInterceptor takes the request ID from incoming x-request-id
+// metadata, generating one if absent, stores it in the context and echoes
+// it back in the response headers.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = withIncomingRequestID(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, RequestID(ctx)))
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := withIncomingRequestID(ss.Context())
+	ss.SetHeader(metadata.Pairs(RequestIDHeader, RequestID(ctx)))
+	return handler(srv, &requestIDStream{ServerStream: ss, ctx: ctx})
+}
+
+// UnaryClientInterceptor forwards the request ID in ctx to the called service.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := RequestID(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, RequestIDHeader, id)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func withIncomingRequestID(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 && values[0] != "" && len(values[0]) <= maxRequestIDLength {
+			return WithRequestID(ctx, values[0])
+		}
+	}
+	return WithRequestID(ctx, newRequestID())
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
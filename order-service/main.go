@@ -1,59 +1,164 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"order-service/auth"
 	"order-service/client"
 	"order-service/database"
+	"order-service/healthcheck"
+	"order-service/logging"
+	"order-service/metrics"
 	"order-service/models"
+	"order-service/pagetoken"
 	pb "order-service/proto/order"
 	"order-service/service"
+	"order-service/tlsconfig"
+	"order-service/tracing"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
 func main() {
+	logging.Init("order-service")
+
+	// Get port from environment or use default
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		port = "50052"
+	}
+
+	tlsConfig := tlsconfig.ServerConfigFromEnv()
+
+	// "main healthcheck" probes a running server, for container health checks
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		creds, err := tlsconfig.LoopbackCredentials(tlsConfig)
+		if err != nil {
+			logging.Fatal("Failed to load TLS credentials", "error", err)
+		}
+		if err := healthcheck.CheckAddr("localhost:"+port, pb.OrderService_ServiceDesc.ServiceName, creds); err != nil {
+			logging.Fatal("Health check failed", "error", err)
+		}
+		return
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background(), "order-service")
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize database
 	if err := database.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		logging.Fatal("Failed to initialize database", "error", err)
 	}
 	defer database.CloseDB()
 
 	// Initialize User Service client
-	userClient, err := client.NewUserServiceClient()
+	userClient, err := client.NewUserServiceClient(
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)),
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor, metrics.UnaryClientInterceptor),
+	)
 	if err != nil {
-		log.Fatalf("Failed to initialize user service client: %v", err)
+		logging.Fatal("Failed to initialize user service client", "error", err)
 	}
 	defer userClient.Close()
 
-	// Get port from environment or use default
-	port := os.Getenv("GRPC_PORT")
-	if port == "" {
-		port = "50052"
-	}
-
 	// Create listener
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		logging.Fatal("Failed to listen", "error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Verify bearer tokens offline against the User Service's published keys
+	verifier := auth.NewVerifier(auth.ConfigFromEnv(), userClient.GetJWKS)
+	go verifier.Run(ctx)
+	authenticator := auth.NewAuthenticator(verifier)
+
+	// Serve TLS, and verify client certificates, if configured
+	creds, err := tlsconfig.ServerCredentials(tlsConfig)
+	if err != nil {
+		logging.Fatal("Failed to load TLS credentials", "error", err)
 	}
 
 	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)),
+		grpc.ChainUnaryInterceptor(
+			logging.UnaryServerInterceptor,
+			metrics.UnaryServerInterceptor,
+			authenticator.UnaryServerInterceptor,
+			service.AccessPolicy.UnaryServerInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			logging.StreamServerInterceptor,
+			metrics.StreamServerInterceptor,
+			authenticator.StreamServerInterceptor,
+			service.AccessPolicy.StreamServerInterceptor,
+		),
+	)
 
 	// Create repository and service
 	orderRepo := models.NewOrderRepository(database.DB)
-	orderService := service.NewOrderServiceServer(orderRepo, userClient)
+	idempotencyRepo := models.NewIdempotencyRepository(database.DB)
+	pageTokens, err := pagetoken.CodecFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure page tokens", "error", err)
+	}
+	orderService := service.NewOrderServiceServer(orderRepo, idempotencyRepo, userClient, pageTokens)
 
 	// Register service
 	pb.RegisterOrderServiceServer(grpcServer, orderService)
 
+	// Register health service. order.OrderService follows the database only,
+	// so a User Service outage doesn't take this service out of rotation;
+	// User Service reachability is reported as "user-service" and on the
+	// overall "" status.
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	checker := healthcheck.NewChecker(healthServer, healthCheckInterval(),
+		map[string][]string{
+			pb.OrderService_ServiceDesc.ServiceName: {"database"},
+			"user-service":                          {"user-service"},
+		},
+		map[string]healthcheck.Probe{
+			"database":     database.DB.PingContext,
+			"user-service": userClient.Ping,
+		})
+
+	go checker.Run(ctx)
+	go orderService.Run(ctx)
+
+	// Expose Prometheus metrics on a separate HTTP listener
+	metrics.RegisterDB(database.DB, "orderdb")
+	metrics.RegisterUserCache(userClient.CacheStats)
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9092"
+	}
+	go metrics.Serve(ctx, fmt.Sprintf(":%s", metricsPort))
+
 	// Register reflection service (for grpcurl and debugging)
 	reflection.Register(grpcServer)
 
@@ -62,13 +167,21 @@ func main() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 		<-sigCh
-		log.Println("Shutting down gRPC server...")
+		slog.Info("Shutting down gRPC server")
+		cancel()
+		checker.Shutdown()
 		grpcServer.GracefulStop()
 	}()
 
-	log.Printf("Order Service gRPC server listening on port %s", port)
+	slog.Info("Order Service gRPC server listening", "port", port, "tls", tlsConfig.Enabled)
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+		logging.Fatal("Failed to serve", "error", err)
 	}
 }
 
+func healthCheckInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return 10 * time.Second
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"order-service/client"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	clientHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_handled_total",
+		Help: "Total number of RPCs completed by the client, by status code.",
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+
+	clientHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_client_handling_seconds",
+		Help:    "Latency of RPCs made to downstream services, including retries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_service", "grpc_method"})
+)
+
+// UnaryClientInterceptor records request counts, status codes and latency
+// for outgoing unary RPCs.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	service, name := splitMethodName(method)
+	clientHandled.WithLabelValues(service, name, status.Code(err).String()).Inc()
+	clientHandlingSeconds.WithLabelValues(service, name).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// RegisterUserCache exports the user lookup cache counters.
+func RegisterUserCache(stats func() client.CacheStats) {
+	counter := func(name, help string, value func(client.CacheStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(stats()))
+		})
+	}
+
+	prometheus.MustRegister(
+		counter("user_cache_hits_total", "User lookups served from the cache.",
+			func(s client.CacheStats) uint64 { return s.Hits }),
+		counter("user_cache_negative_hits_total", "Lookups of missing users served from the cache.",
+			func(s client.CacheStats) uint64 { return s.NegativeHits }),
+		counter("user_cache_misses_total", "User lookups that went to the User Service.",
+			func(s client.CacheStats) uint64 { return s.Misses }),
+		counter("user_cache_evictions_total", "Entries evicted to stay within the cache size.",
+			func(s client.CacheStats) uint64 { return s.Evictions }),
+		counter("user_cache_invalidations_total", "Entries dropped because the user changed.",
+			func(s client.CacheStats) uint64 { return s.Invalidations }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "user_cache_entries",
+			Help: "Number of entries currently in the user cache.",
+		}, func() float64 { return float64(stats().Size) }),
+	)
+}
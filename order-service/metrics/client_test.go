@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptorCountsByCode(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"ok", nil, "OK"},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), "Unavailable"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return tc.err
+			}
+
+			counter := clientHandled.WithLabelValues("user.UserService", "ValidateUser", tc.code)
+			before := testutil.ToFloat64(counter)
+
+			if err := UnaryClientInterceptor(context.Background(), "/user.UserService/ValidateUser", nil, nil, nil, invoker); err != tc.err {
+				t.Fatalf("interceptor error = %v, want %v", err, tc.err)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("grpc_client_handled_total{grpc_code=%q} grew by %v, want 1", tc.code, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OrderSort is a column List can sort orders by.
+type OrderSort string
+
+const (
+	SortByCreatedAt   OrderSort = "created_at"
+	SortByTotalAmount OrderSort = "total_amount"
+	SortByStatus      OrderSort = "status"
+)
+
+// statusOrder is the order statuses sort in: the order lifecycle, rather
+// than alphabetical.
+var statusOrder = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusProcessing,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+}
+
+// statusRank is the SQL counterpart of statusRankOf.
+var statusRank = func() string {
+	names := make([]string, len(statusOrder))
+	for i, status := range statusOrder {
+		names[i] = "'" + string(status) + "'"
+	}
+	return "array_position(ARRAY[" + strings.Join(names, ", ") + "]::VARCHAR[], status)"
+}()
+
+func statusRankOf(status OrderStatus) int {
+	for i, s := range statusOrder {
+		if s == status {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// OrderFilter selects the orders returned by List and Count, and the order
+// List returns them in. Zero-valued fields do not filter.
+type OrderFilter struct {
+	Statuses []OrderStatus
+	UserID   int32
+
+	// Time ranges include their start and exclude their end.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	// Total amount bounds are inclusive, and only match orders in their
+	// currency.
+	MinTotal *Money
+	MaxTotal *Money
+
+	SortBy     OrderSort // SortByCreatedAt if empty
+	Descending bool
+}
+
+// sortKey returns the SQL expression List sorts by, and the type a cursor
+// key must be cast to for comparison with it.
+func (f OrderFilter) sortKey() (expr, cast string) {
+	switch f.SortBy {
+	case SortByTotalAmount:
+		return "total_amount", "NUMERIC"
+	case SortByStatus:
+		return statusRank, "INTEGER"
+	default:
+		return "created_at", "TIMESTAMP"
+	}
+}
+
+// Cursor returns the position of order in the filter's sort order, for
+// use as Page.After.
+func (f OrderFilter) Cursor(order *Order) PageCursor {
+	var key string
+	switch f.SortBy {
+	case SortByTotalAmount:
+		key = order.TotalAmount.decimal()
+	case SortByStatus:
+		key = strconv.Itoa(statusRankOf(order.Status))
+	default:
+		key = order.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return PageCursor{Key: key, ID: order.ID}
+}
+
+// where builds the WHERE clause selecting the filtered orders, starting
+// after the cursor if one is given.
+func (f OrderFilter) where(after *PageCursor) *sqlWhere {
+	w := &sqlWhere{}
+	if len(f.Statuses) > 0 {
+		statuses := make([]string, len(f.Statuses))
+		for i, status := range f.Statuses {
+			statuses[i] = string(status)
+		}
+		w.add("status = ANY(?)", pq.Array(statuses))
+	}
+	if f.UserID != 0 {
+		w.add("user_id = ?", f.UserID)
+	}
+
+	// The columns are TIMESTAMP WITHOUT TIME ZONE holding UTC, and Postgres
+	// ignores the offset of a timestamp compared with them
+	if !f.CreatedAfter.IsZero() {
+		w.add("created_at >= ?", f.CreatedAfter.UTC())
+	}
+	if !f.CreatedBefore.IsZero() {
+		w.add("created_at < ?", f.CreatedBefore.UTC())
+	}
+	if !f.UpdatedAfter.IsZero() {
+		w.add("updated_at >= ?", f.UpdatedAfter.UTC())
+	}
+	if !f.UpdatedBefore.IsZero() {
+		w.add("updated_at < ?", f.UpdatedBefore.UTC())
+	}
+
+	if f.MinTotal != nil {
+		w.add("currency = ? AND total_amount >= ?", f.MinTotal.Currency, f.MinTotal.decimal())
+	}
+	if f.MaxTotal != nil {
+		w.add("currency = ? AND total_amount <= ?", f.MaxTotal.Currency, f.MaxTotal.decimal())
+	}
+
+	if after != nil {
+		expr, cast := f.sortKey()
+		op := ">"
+		if f.Descending {
+			op = "<"
+		}
+		w.add(fmt.Sprintf("(%s, id) %s (?::%s, ?)", expr, op, cast), after.Key, after.ID)
+	}
+	return w
+}
+
+// orderBy returns the ORDER BY clause for the filter's sort order. The ID
+// breaks ties so that cursors identify a unique position.
+func (f OrderFilter) orderBy() string {
+	expr, _ := f.sortKey()
+	direction := "ASC"
+	if f.Descending {
+		direction = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s", expr, direction, direction)
+}
+
+// sqlWhere accumulates the conditions of a WHERE clause and their
+// arguments, so that every value is passed as a query parameter.
+type sqlWhere struct {
+	conds []string
+	args  []any
+}
+
+// add appends a condition, replacing each "?" in cond by the placeholder
+// of the corresponding argument.
+func (w *sqlWhere) add(cond string, args ...any) {
+	for _, arg := range args {
+		w.args = append(w.args, arg)
+		cond = strings.Replace(cond, "?", "$"+strconv.Itoa(len(w.args)), 1)
+	}
+	w.conds = append(w.conds, cond)
+}
+
+// arg adds an argument not tied to a condition, such as a LIMIT, and
+// returns its placeholder.
+func (w *sqlWhere) arg(value any) string {
+	w.args = append(w.args, value)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestSQLWhere(t *testing.T) {
+	w := &sqlWhere{}
+	if got := w.String(); got != "" {
+		t.Errorf("empty WHERE = %q, want none", got)
+	}
+
+	w.add("a = ?", 1)
+	w.add("b BETWEEN ? AND ?", 2, 3)
+	w.add("c IS NULL")
+	limit := w.arg(10)
+
+	if want := " WHERE a = $1 AND b BETWEEN $2 AND $3 AND c IS NULL"; w.String() != want {
+		t.Errorf("WHERE = %q, want %q", w.String(), want)
+	}
+	if limit != "$4" {
+		t.Errorf("arg placeholder = %q, want $4", limit)
+	}
+	if want := []any{1, 2, 3, 10}; !reflect.DeepEqual(w.args, want) {
+		t.Errorf("args = %v, want %v", w.args, want)
+	}
+}
+
+func TestOrderFilterWhere(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	// Times in other zones are compared as UTC
+	local := day.In(time.FixedZone("UTC+2", 2*60*60))
+	usd := func(minor int64) *Money { return &Money{Currency: "USD", Minor: minor} }
+
+	for _, tc := range []struct {
+		name   string
+		filter OrderFilter
+		where  string
+		args   []any
+	}{
+		{"no filter", OrderFilter{}, "", nil},
+		{"statuses", OrderFilter{Statuses: []OrderStatus{OrderStatusPending, OrderStatusShipped}},
+			" WHERE status = ANY($1)", []any{pq.Array([]string{"PENDING", "SHIPPED"})}},
+		{"user", OrderFilter{UserID: 7}, " WHERE user_id = $1", []any{int32(7)}},
+		{"created after", OrderFilter{CreatedAfter: local}, " WHERE created_at >= $1", []any{day}},
+		{"created before", OrderFilter{CreatedBefore: day}, " WHERE created_at < $1", []any{day}},
+		{"updated after", OrderFilter{UpdatedAfter: day}, " WHERE updated_at >= $1", []any{day}},
+		{"updated before", OrderFilter{UpdatedBefore: local}, " WHERE updated_at < $1", []any{day}},
+		{"min total", OrderFilter{MinTotal: usd(1050)},
+			" WHERE currency = $1 AND total_amount >= $2", []any{"USD", "10.50"}},
+		{"max total", OrderFilter{MaxTotal: usd(99)},
+			" WHERE currency = $1 AND total_amount <= $2", []any{"USD", "0.99"}},
+		{"total range", OrderFilter{MinTotal: usd(1000), MaxTotal: usd(5000)},
+			" WHERE currency = $1 AND total_amount >= $2 AND currency = $3 AND total_amount <= $4",
+			[]any{"USD", "10.00", "USD", "50.00"}},
+		{
+			"every filter",
+			OrderFilter{
+				Statuses: []OrderStatus{OrderStatusDelivered}, UserID: 7,
+				CreatedAfter: day, CreatedBefore: day.AddDate(0, 1, 0),
+				UpdatedAfter: day, UpdatedBefore: day.AddDate(0, 2, 0),
+				MinTotal: usd(1), MaxTotal: usd(2),
+			},
+			" WHERE status = ANY($1) AND user_id = $2 AND created_at >= $3 AND created_at < $4" +
+				" AND updated_at >= $5 AND updated_at < $6" +
+				" AND currency = $7 AND total_amount >= $8 AND currency = $9 AND total_amount <= $10",
+			[]any{pq.Array([]string{"DELIVERED"}), int32(7), day, day.AddDate(0, 1, 0), day, day.AddDate(0, 2, 0),
+				"USD", "0.01", "USD", "0.02"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := tc.filter.where(nil)
+			if got := w.String(); got != tc.where {
+				t.Errorf("WHERE = %q, want %q", got, tc.where)
+			}
+			if !reflect.DeepEqual(w.args, tc.args) {
+				t.Errorf("args = %#v, want %#v", w.args, tc.args)
+			}
+		})
+	}
+}
+
+func TestOrderFilterKeyset(t *testing.T) {
+	after := &PageCursor{Key: "key", ID: 42}
+	statusRank := "array_position(ARRAY['PENDING', 'PROCESSING', 'SHIPPED', 'DELIVERED', 'CANCELLED']::VARCHAR[], status)"
+
+	for _, tc := range []struct {
+		sort       OrderSort
+		descending bool
+		where      string
+		orderBy    string
+	}{
+		{"", false, "(created_at, id) > ($1::TIMESTAMP, $2)", " ORDER BY created_at ASC, id ASC"},
+		{"", true, "(created_at, id) < ($1::TIMESTAMP, $2)", " ORDER BY created_at DESC, id DESC"},
+		{SortByCreatedAt, false, "(created_at, id) > ($1::TIMESTAMP, $2)", " ORDER BY created_at ASC, id ASC"},
+		{SortByCreatedAt, true, "(created_at, id) < ($1::TIMESTAMP, $2)", " ORDER BY created_at DESC, id DESC"},
+		{SortByTotalAmount, false, "(total_amount, id) > ($1::NUMERIC, $2)", " ORDER BY total_amount ASC, id ASC"},
+		{SortByTotalAmount, true, "(total_amount, id) < ($1::NUMERIC, $2)", " ORDER BY total_amount DESC, id DESC"},
+		{SortByStatus, false, "(" + statusRank + ", id) > ($1::INTEGER, $2)", " ORDER BY " + statusRank + " ASC, id ASC"},
+		{SortByStatus, true, "(" + statusRank + ", id) < ($1::INTEGER, $2)", " ORDER BY " + statusRank + " DESC, id DESC"},
+	} {
+		t.Run(fmt.Sprintf("%s descending=%v", tc.sort, tc.descending), func(t *testing.T) {
+			filter := OrderFilter{SortBy: tc.sort, Descending: tc.descending}
+			w := filter.where(after)
+			if got, want := w.String(), " WHERE "+tc.where; got != want {
+				t.Errorf("WHERE = %q, want %q", got, want)
+			}
+			if want := []any{"key", int32(42)}; !reflect.DeepEqual(w.args, want) {
+				t.Errorf("args = %v, want %v", w.args, want)
+			}
+			if got := filter.orderBy(); got != tc.orderBy {
+				t.Errorf("ORDER BY = %q, want %q", got, tc.orderBy)
+			}
+
+			// The cursor follows the filters' placeholders
+			filter.UserID = 7
+			if got, want := filter.where(after).String(), " WHERE user_id = $1 AND "+
+				strings.NewReplacer("$2", "$3", "$1", "$2").Replace(tc.where); got != want {
+				t.Errorf("filtered WHERE = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestOrderFilterCursor(t *testing.T) {
+	order := &Order{
+		ID:          42,
+		Status:      OrderStatusShipped,
+		TotalAmount: Money{Currency: "USD", Minor: 249_999},
+		CreatedAt:   time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC),
+	}
+	for sort, key := range map[OrderSort]string{
+		"":                "2026-03-01T12:30:00.0000005Z",
+		SortByCreatedAt:   "2026-03-01T12:30:00.0000005Z",
+		SortByTotalAmount: "2499.99",
+		SortByStatus:      "3",
+	} {
+		if got := (OrderFilter{SortBy: sort}).Cursor(order); got != (PageCursor{Key: key, ID: 42}) {
+			t.Errorf("Cursor sorted by %q = %+v, want key %q", sort, got, key)
+		}
+	}
+}
+
+func TestStatusRankFollowsLifecycle(t *testing.T) {
+	for i, status := range []OrderStatus{
+		OrderStatusPending, OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled,
+	} {
+		if got := statusRankOf(status); got != i+1 {
+			t.Errorf("statusRankOf(%s) = %d, want %d", status, got, i+1)
+		}
+	}
+	if got := statusRankOf("UNKNOWN"); got != 0 {
+		t.Errorf("statusRankOf(UNKNOWN) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReserveClaimsFreeKeys(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	conn := &stubConn{respond: func(query string, args []driver.Value) (*stubRows, error) {
+		return &stubRows{columns: []string{"created_at"}, values: [][]driver.Value{{created}}}, nil
+	}}
+	repo := NewIdempotencyRepository(sql.OpenDB(conn))
+
+	record, reserved, err := repo.Reserve(context.Background(), "user:1", "key-1", "Create", "hash", 24*time.Hour)
+	if err != nil || !reserved {
+		t.Fatalf("Reserve = %v, %v; want a reservation", reserved, err)
+	}
+	want := IdempotencyRecord{Owner: "user:1", Key: "key-1", Method: "Create", RequestHash: "hash", CreatedAt: created}
+	if record.Owner != want.Owner || record.Key != want.Key || record.Method != want.Method ||
+		record.RequestHash != want.RequestHash || !record.CreatedAt.Equal(created) || record.Response != nil {
+		t.Errorf("record = %+v, want %+v", record, want)
+	}
+
+	upsert := conn.queries[0]
+	if !strings.Contains(upsert.query, "ON CONFLICT (owner, method, key)") {
+		t.Errorf("upsert does not conflict on the owner's key:\n%s", upsert.query)
+	}
+	wantArgs := []driver.Value{"user:1", "key-1", "Create", "hash", idempotencyLeaseTimeout.Seconds(), (24 * time.Hour).Seconds()}
+	if !equalValues(upsert.args, wantArgs) {
+		t.Errorf("upsert args = %v, want %v", upsert.args, wantArgs)
+	}
+}
+
+// The upsert only replaces a record when its WHERE clause allows it, so
+// these tests pin the conditions under which a key is taken over.
+func TestIdempotencyReserveTakesOverAbandonedAndExpiredKeys(t *testing.T) {
+	conn := &stubConn{respond: func(query string, args []driver.Value) (*stubRows, error) {
+		return &stubRows{columns: []string{"created_at"}, values: [][]driver.Value{{time.Now()}}}, nil
+	}}
+	repo := NewIdempotencyRepository(sql.OpenDB(conn))
+	if _, _, err := repo.Reserve(context.Background(), "", "key-1", "Create", "hash", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	upsert := strings.Join(strings.Fields(conn.queries[0].query), " ")
+	for _, condition := range []string{
+		// A reservation without a response is abandoned after the lease
+		"(idempotency_keys.response IS NULL AND idempotency_keys.created_at < CURRENT_TIMESTAMP - $5 * INTERVAL '1 second')",
+		// Any record is expired after the ttl
+		"OR idempotency_keys.created_at < CURRENT_TIMESTAMP - $6 * INTERVAL '1 second'",
+		// The new request replaces the old one
+		"SET request_hash = EXCLUDED.request_hash, response = NULL, created_at = CURRENT_TIMESTAMP",
+	} {
+		if !strings.Contains(upsert, condition) {
+			t.Errorf("upsert is missing %q:\n%s", condition, upsert)
+		}
+	}
+}
+
+func TestIdempotencyReserveReturnsHeldKeys(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	conn := &stubConn{respond: func(query string, args []driver.Value) (*stubRows, error) {
+		if strings.Contains(query, "INSERT") {
+			// The key is held and not taken over: the upsert returns no row
+			return &stubRows{columns: []string{"created_at"}}, nil
+		}
+		return &stubRows{
+			columns: []string{"owner", "key", "method", "request_hash", "response", "created_at"},
+			values:  [][]driver.Value{{"user:1", "key-1", "Create", "other-hash", []byte("stored"), created}},
+		}, nil
+	}}
+	repo := NewIdempotencyRepository(sql.OpenDB(conn))
+
+	record, reserved, err := repo.Reserve(context.Background(), "user:1", "key-1", "Create", "hash", time.Hour)
+	if err != nil || reserved {
+		t.Fatalf("Reserve = %v, %v; want the held record", reserved, err)
+	}
+	if record.RequestHash != "other-hash" || string(record.Response) != "stored" {
+		t.Errorf("record = %+v, want the stored one", record)
+	}
+	if lookup := conn.queries[1]; !equalValues(lookup.args, []driver.Value{"user:1", "Create", "key-1"}) {
+		t.Errorf("lookup args = %v, want the owner, method and key", lookup.args)
+	}
+}
+
+func TestIdempotencyScopedStatements(t *testing.T) {
+	conn := &stubConn{}
+	repo := NewIdempotencyRepository(sql.OpenDB(conn))
+	ctx := context.Background()
+
+	if err := repo.Complete(ctx, "user:1", "key-1", "Create", []byte("stored")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Release(ctx, "user:1", "key-1", "Create"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range conn.queries {
+		if !strings.Contains(q.query, "owner = ") || !strings.Contains(q.query, "method = ") || !strings.Contains(q.query, "key = ") {
+			t.Errorf("statement is not scoped to the owner's key:\n%s", q.query)
+		}
+	}
+	if release := conn.queries[1].query; !strings.Contains(release, "response IS NULL") {
+		t.Errorf("Release may delete a completed record:\n%s", release)
+	}
+}
+
+func TestIdempotencyDeleteExpired(t *testing.T) {
+	conn := &stubConn{}
+	repo := NewIdempotencyRepository(sql.OpenDB(conn))
+
+	deleted, err := repo.DeleteExpired(context.Background(), 24*time.Hour)
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpired = %d, %v; want 1", deleted, err)
+	}
+	if args := conn.queries[0].args; !equalValues(args, []driver.Value{(24 * time.Hour).Seconds()}) {
+		t.Errorf("DeleteExpired args = %v, want the ttl in seconds", args)
+	}
+}
+
+func equalValues(got, want []driver.Value) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stubConn is a database connection that records every statement and
+// answers queries with respond.
+type stubConn struct {
+	respond func(query string, args []driver.Value) (*stubRows, error)
+	queries []stubQuery
+}
+
+type stubQuery struct {
+	query string
+	args  []driver.Value
+}
+
+func (c *stubConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+
+func (c *stubConn) Driver() driver.Driver { return nil }
+
+func (c *stubConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("stub: prepared statements are not supported")
+}
+
+func (c *stubConn) Close() error { return nil }
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("stub: transactions are not supported")
+}
+
+func (c *stubConn) record(query string, named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	c.queries = append(c.queries, stubQuery{query: query, args: args})
+	return args
+}
+
+func (c *stubConn) QueryContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	args := c.record(query, named)
+	if c.respond == nil {
+		return nil, errors.New("stub: unexpected query")
+	}
+	return c.respond(query, args)
+}
+
+func (c *stubConn) ExecContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	c.record(query, named)
+	return driver.RowsAffected(1), nil
+}
+
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+
+func (r *stubRows) Close() error { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// minorPerUnit is the number of minor units in one major currency unit. The
+// orders and order_items tables store amounts as DECIMAL(10, 2), so every
+// amount is held as an integer count of hundredths.
+const minorPerUnit = 100
+
+// maxStoredMinor is the largest amount, in minor units, that fits those
+// DECIMAL(10, 2) columns: 99,999,999.99.
+const maxStoredMinor = 99_999_999_99
+
+// nanosPerMinor converts between google.type.Money style nanos and minor units.
+const nanosPerMinor = 1_000_000_000 / minorPerUnit
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidCurrency  = errors.New("currency code must be a 3-letter ISO 4217 code")
+	ErrInvalidAmount    = errors.New("invalid monetary amount")
+	ErrAmountOverflow   = errors.New("monetary amount out of range")
+)
+
+// Money is an exact monetary amount in a single currency.
+type Money struct {
+	Currency string // ISO 4217 code, e.g. "USD"
+	Minor    int64  // hundredths of the major unit
+}
+
+// NewMoney builds a Money from google.type.Money style units and nanos.
+// Amounts finer than one hundredth are rejected rather than rounded.
+func NewMoney(currency string, units int64, nanos int32) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if !validCurrency(currency) {
+		return Money{}, ErrInvalidCurrency
+	}
+	if nanos <= -1_000_000_000 || nanos >= 1_000_000_000 {
+		return Money{}, fmt.Errorf("%w: nanos must be within ±999,999,999", ErrInvalidAmount)
+	}
+	if (units > 0 && nanos < 0) || (units < 0 && nanos > 0) {
+		return Money{}, fmt.Errorf("%w: units and nanos must have the same sign", ErrInvalidAmount)
+	}
+	if nanos%nanosPerMinor != 0 {
+		return Money{}, fmt.Errorf("%w: at most 2 decimal places are supported", ErrInvalidAmount)
+	}
+	if units > math.MaxInt64/minorPerUnit || units < math.MinInt64/minorPerUnit {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Currency: currency, Minor: units*minorPerUnit + int64(nanos/nanosPerMinor)}, nil
+}
+
+// MaxStoredAmount returns the largest amount in currency that can be stored.
+func MaxStoredAmount(currency string) Money {
+	return Money{Currency: currency, Minor: maxStoredMinor}
+}
+
+// Storable reports whether m fits the columns amounts are stored in.
+func (m Money) Storable() bool {
+	return m.Minor <= maxStoredMinor && m.Minor >= -maxStoredMinor
+}
+
+// Units returns the whole-unit part of the amount.
+func (m Money) Units() int64 {
+	return m.Minor / minorPerUnit
+}
+
+// Nanos returns the fractional part of the amount in nanos.
+func (m Money) Nanos() int32 {
+	return int32(m.Minor%minorPerUnit) * nanosPerMinor
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	sum := m.Minor + other.Minor
+	if (other.Minor > 0 && sum < m.Minor) || (other.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Currency: m.Currency, Minor: sum}, nil
+}
+
+// Mul returns m multiplied by quantity.
+func (m Money) Mul(quantity int32) (Money, error) {
+	if quantity == 0 || m.Minor == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Minor * int64(quantity)
+	if product/int64(quantity) != m.Minor {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Currency: m.Currency, Minor: product}, nil
+}
+
+// String formats the amount as a decimal followed by the currency code.
+func (m Money) String() string {
+	return m.decimal() + " " + m.Currency
+}
+
+// decimal formats the amount the way Postgres expects a DECIMAL literal.
+func (m Money) decimal() string {
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/minorPerUnit, minor%minorPerUnit)
+}
+
+// parseDecimal converts a DECIMAL value returned by Postgres into Money.
+func parseDecimal(currency, value string) (Money, error) {
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, frac, _ := strings.Cut(value, ".")
+	if len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+		}
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	if units > (math.MaxInt64-cents)/minorPerUnit {
+		return Money{}, ErrAmountOverflow
+	}
+
+	minor := units*minorPerUnit + cents
+	if negative {
+		minor = -minor
+	}
+	return Money{Currency: currency, Minor: minor}, nil
+}
+
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
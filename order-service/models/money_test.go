@@ -0,0 +1,181 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNewMoney(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		currency string
+		units    int64
+		nanos    int32
+		want     Money
+		err      error
+	}{
+		{"whole units", "USD", 12, 0, Money{Currency: "USD", Minor: 1200}, nil},
+		{"cents", "USD", 2499, 990_000_000, Money{Currency: "USD", Minor: 249_999}, nil},
+		{"only nanos", "EUR", 0, 50_000_000, Money{Currency: "EUR", Minor: 5}, nil},
+		{"negative", "USD", -1, -750_000_000, Money{Currency: "USD", Minor: -175}, nil},
+		{"currency is normalised", " usd ", 1, 0, Money{Currency: "USD", Minor: 100}, nil},
+		{"empty currency", "", 1, 0, Money{}, ErrInvalidCurrency},
+		{"long currency", "USDX", 1, 0, Money{}, ErrInvalidCurrency},
+		{"non-letter currency", "U5D", 1, 0, Money{}, ErrInvalidCurrency},
+		{"nanos too large", "USD", 0, 1_000_000_000, Money{}, ErrInvalidAmount},
+		{"mixed signs", "USD", 1, -500_000_000, Money{}, ErrInvalidAmount},
+		{"sub-cent nanos", "USD", 0, 5_000_000, Money{}, ErrInvalidAmount},
+		{"units overflow", "USD", math.MaxInt64/minorPerUnit + 1, 0, Money{}, ErrAmountOverflow},
+		{"negative units overflow", "USD", math.MinInt64/minorPerUnit - 1, 0, Money{}, ErrAmountOverflow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewMoney(tc.currency, tc.units, tc.nanos)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("NewMoney error = %v, want %v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("NewMoney = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnitsAndNanos(t *testing.T) {
+	for _, tc := range []struct {
+		minor int64
+		units int64
+		nanos int32
+	}{
+		{249_999, 2499, 990_000_000},
+		{5, 0, 50_000_000},
+		{-175, -1, -750_000_000},
+		{0, 0, 0},
+	} {
+		m := Money{Currency: "USD", Minor: tc.minor}
+		if m.Units() != tc.units || m.Nanos() != tc.nanos {
+			t.Errorf("%d minor = %d units %d nanos, want %d units %d nanos", tc.minor, m.Units(), m.Nanos(), tc.units, tc.nanos)
+		}
+		back, err := NewMoney(m.Currency, m.Units(), m.Nanos())
+		if err != nil || back != m {
+			t.Errorf("round trip of %d minor = %+v, %v", tc.minor, back, err)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	for _, tc := range []struct {
+		minor   int64
+		decimal string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1200, "12.00"},
+		{249_999, "2499.99"},
+		{-5, "-0.05"},
+		{-175, "-1.75"},
+	} {
+		m := Money{Currency: "USD", Minor: tc.minor}
+		if got := m.decimal(); got != tc.decimal {
+			t.Errorf("decimal(%d) = %q, want %q", tc.minor, got, tc.decimal)
+		}
+		if got, want := m.String(), tc.decimal+" USD"; got != want {
+			t.Errorf("String(%d) = %q, want %q", tc.minor, got, want)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		minor int64
+		err   error
+	}{
+		{"2499.99", 249_999, nil},
+		{"12", 1200, nil},
+		{"12.5", 1250, nil},
+		{"0.05", 5, nil},
+		{"-1.75", -175, nil},
+		{" 7.10 ", 710, nil},
+		{"3.1400", 314, nil},
+		{"3.141", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+		{"abc", 0, ErrInvalidAmount},
+		{"1.x", 0, ErrInvalidAmount},
+		{"92233720368547758.08", 0, ErrAmountOverflow},
+		{"99999999999999999999", 0, ErrInvalidAmount},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseDecimal("USD", tc.value)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("parseDecimal error = %v, want %v", err, tc.err)
+			}
+			if err == nil && got != (Money{Currency: "USD", Minor: tc.minor}) {
+				t.Errorf("parseDecimal = %+v, want %d minor", got, tc.minor)
+			}
+		})
+	}
+}
+
+func TestMoneyStorable(t *testing.T) {
+	for _, tc := range []struct {
+		minor    int64
+		storable bool
+	}{
+		{0, true},
+		{99_999_999_99, true},
+		{99_999_999_99 + 1, false},
+		{-99_999_999_99, true},
+		{-99_999_999_99 - 1, false},
+		{math.MaxInt64, false},
+	} {
+		if got := (Money{Currency: "USD", Minor: tc.minor}).Storable(); got != tc.storable {
+			t.Errorf("Storable(%d) = %v, want %v", tc.minor, got, tc.storable)
+		}
+	}
+	if got := MaxStoredAmount("EUR").String(); got != "99999999.99 EUR" {
+		t.Errorf("MaxStoredAmount = %q", got)
+	}
+}
+
+func TestMoneyAdd(t *testing.T) {
+	usd := func(minor int64) Money { return Money{Currency: "USD", Minor: minor} }
+
+	if got, err := usd(150).Add(usd(275)); err != nil || got != usd(425) {
+		t.Errorf("Add = %+v, %v; want 4.25 USD", got, err)
+	}
+	if _, err := usd(150).Add(Money{Currency: "EUR", Minor: 100}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd(math.MaxInt64).Add(usd(1)); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("Add past MaxInt64 = %v, want ErrAmountOverflow", err)
+	}
+	if _, err := usd(math.MinInt64).Add(usd(-1)); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("Add past MinInt64 = %v, want ErrAmountOverflow", err)
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	for _, tc := range []struct {
+		minor    int64
+		quantity int32
+		want     int64
+		err      error
+	}{
+		{1999, 3, 5997, nil},
+		{1999, 0, 0, nil},
+		{0, 5, 0, nil},
+		{-250, 2, -500, nil},
+		{math.MaxInt64 / 2, 3, 0, ErrAmountOverflow},
+		{math.MaxInt64, math.MaxInt32, 0, ErrAmountOverflow},
+	} {
+		got, err := Money{Currency: "USD", Minor: tc.minor}.Mul(tc.quantity)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d * %d error = %v, want %v", tc.minor, tc.quantity, err, tc.err)
+			continue
+		}
+		if err == nil && got != (Money{Currency: "USD", Minor: tc.want}) {
+			t.Errorf("%d * %d = %+v, want %d minor", tc.minor, tc.quantity, got, tc.want)
+		}
+	}
+}
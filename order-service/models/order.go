@@ -1,8 +1,14 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type OrderStatus string
@@ -15,12 +21,70 @@ const (
 	OrderStatusCancelled  OrderStatus = "CANCELLED"
 )
 
+// orderStatusTransitions lists, for every status, the statuses an order may
+// move to next. DELIVERED and CANCELLED are terminal.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered},
+	OrderStatusDelivered:  {},
+	OrderStatusCancelled:  {},
+}
+
+// AllowedTransitions returns the statuses an order in status s may move to.
+func (s OrderStatus) AllowedTransitions() []OrderStatus {
+	return append([]OrderStatus(nil), orderStatusTransitions[s]...)
+}
+
+// CanTransitionTo reports whether an order in status s may move to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrVersionConflict is returned when an order was changed since it was
+// read.
+var ErrVersionConflict = errors.New("order was modified concurrently")
+
+// StatusTransitionError is returned when an order status change is not
+// permitted by the transition table.
+type StatusTransitionError struct {
+	From    OrderStatus
+	To      OrderStatus
+	Allowed []OrderStatus
+}
+
+func (e *StatusTransitionError) Error() string {
+	allowed := "none"
+	if len(e.Allowed) > 0 {
+		names := make([]string, len(e.Allowed))
+		for i, s := range e.Allowed {
+			names[i] = string(s)
+		}
+		allowed = strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("cannot change order status from %s to %s (allowed: %s)", e.From, e.To, allowed)
+}
+
+// ValidateStatusTransition returns a *StatusTransitionError if an order in
+// status from may not move to status to.
+func ValidateStatusTransition(from, to OrderStatus) error {
+	if from.CanTransitionTo(to) {
+		return nil
+	}
+	return &StatusTransitionError{From: from, To: to, Allowed: from.AllowedTransitions()}
+}
+
 type OrderItem struct {
 	ID          int32
 	OrderID     int32
 	ProductName string
 	Quantity    int32
-	Price       float64
+	Price       Money
 	CreatedAt   time.Time
 }
 
@@ -30,20 +94,40 @@ type Order struct {
 	UserName    string
 	UserEmail   string
 	Items       []*OrderItem
-	TotalAmount float64
+	TotalAmount Money
 	Status      OrderStatus
+	Version     int32 // incremented by every update
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// OrderStatusHistory is one entry in an order's audit trail. OldStatus is
+// empty for the entry written when the order is created.
+type OrderStatusHistory struct {
+	ID        int32
+	OrderID   int32
+	OldStatus OrderStatus
+	NewStatus OrderStatus
+	Actor     string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// StatusChange describes who changed an order's status and why.
+type StatusChange struct {
+	Actor  string
+	Reason string
+}
+
 type OrderRepository interface {
-	Create(order *Order) error
-	GetByID(id int32) (*Order, error)
-	Update(order *Order) error
-	List(page, limit int32) ([]*Order, int32, error)
-	GetByUserID(userID int32) ([]*Order, error)
-	UpdateStatus(id int32, status OrderStatus) error
-	Cancel(id int32) error
+	Create(ctx context.Context, order *Order, change StatusChange) error
+	GetByID(ctx context.Context, id int32) (*Order, error)
+	Update(ctx context.Context, order *Order) error
+	List(ctx context.Context, filter OrderFilter, page Page) ([]*Order, error)
+	Count(ctx context.Context, filter OrderFilter) (int32, error)
+	UpdateStatus(ctx context.Context, id, version int32, status OrderStatus, change StatusChange) error
+	Cancel(ctx context.Context, id, version int32, change StatusChange) error
+	GetHistory(ctx context.Context, orderID int32) ([]*OrderStatusHistory, error)
 }
 
 type orderRepository struct {
@@ -54,9 +138,12 @@ func NewOrderRepository(db *sql.DB) OrderRepository {
 	return &orderRepository{db: db}
 }
 
-func (r *orderRepository) Create(order *Order) error {
+func (r *orderRepository) Create(ctx context.Context, order *Order, change StatusChange) error {
+	ctx, span := tracer.Start(ctx, "orderRepository.Create")
+	defer span.End()
+
 	// Start transaction
-	tx, err := r.db.Begin()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -64,12 +151,13 @@ func (r *orderRepository) Create(order *Order) error {
 
 	// Insert order
 	query := `
-		INSERT INTO orders (user_id, user_name, user_email, total_amount, status)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at
+		INSERT INTO orders (user_id, user_name, user_email, total_amount, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, version, created_at, updated_at
 	`
-	err = tx.QueryRow(query, order.UserID, order.UserName, order.UserEmail, order.TotalAmount, order.Status).
-		Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+	err = tx.QueryRowContext(ctx, query, order.UserID, order.UserName, order.UserEmail,
+		order.TotalAmount.decimal(), order.TotalAmount.Currency, order.Status).
+		Scan(&order.ID, &order.Version, &order.CreatedAt, &order.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -81,194 +169,278 @@ func (r *orderRepository) Create(order *Order) error {
 		RETURNING id, created_at
 	`
 	for _, item := range order.Items {
+		if item.Price.Currency != order.TotalAmount.Currency {
+			return fmt.Errorf("%w: item %q is priced in %s, order in %s", ErrCurrencyMismatch,
+				item.ProductName, item.Price.Currency, order.TotalAmount.Currency)
+		}
 		item.OrderID = order.ID
-		err = tx.QueryRow(itemQuery, order.ID, item.ProductName, item.Quantity, item.Price).
+		err = tx.QueryRowContext(ctx, itemQuery, order.ID, item.ProductName, item.Quantity, item.Price.decimal()).
 			Scan(&item.ID, &item.CreatedAt)
 		if err != nil {
 			return err
 		}
 	}
 
+	if err := insertStatusHistory(ctx, tx, order.ID, "", order.Status, change); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (r *orderRepository) GetByID(id int32) (*Order, error) {
+func (r *orderRepository) GetByID(ctx context.Context, id int32) (*Order, error) {
+	ctx, span := tracer.Start(ctx, "orderRepository.GetByID")
+	defer span.End()
+
 	query := `
-		SELECT id, user_id, user_name, user_email, total_amount, status, created_at, updated_at
+		SELECT ` + orderColumns + `
 		FROM orders
 		WHERE id = $1
 	`
+	order, err := scanOrder(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadItems(ctx, []*Order{order}); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// orderColumns is the column list read by scanOrder.
+const orderColumns = `id, user_id, user_name, user_email, total_amount, currency, status, version, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(row rowScanner) (*Order, error) {
 	order := &Order{}
-	err := r.db.QueryRow(query, id).Scan(
+	var totalAmount, currency string
+	err := row.Scan(
 		&order.ID, &order.UserID, &order.UserName, &order.UserEmail,
-		&order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt,
+		&totalAmount, &currency, &order.Status, &order.Version, &order.CreatedAt, &order.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get order items
-	items, err := r.getOrderItems(order.ID)
+	order.TotalAmount, err = parseDecimal(currency, totalAmount)
 	if err != nil {
 		return nil, err
 	}
-	order.Items = items
-
 	return order, nil
 }
 
-func (r *orderRepository) getOrderItems(orderID int32) ([]*OrderItem, error) {
+// loadItems fills in the items of orders with a single query, however many
+// orders there are.
+func (r *orderRepository) loadItems(ctx context.Context, orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	byID := make(map[int32]*Order, len(orders))
+	ids := make([]int32, len(orders))
+	for i, order := range orders {
+		byID[order.ID] = order
+		ids[i] = order.ID
+	}
+
 	query := `
 		SELECT id, order_id, product_name, quantity, price, created_at
 		FROM order_items
-		WHERE order_id = $1
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id
 	`
-	rows, err := r.db.Query(query, orderID)
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var items []*OrderItem
 	for rows.Next() {
 		item := &OrderItem{}
-		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductName, &item.Quantity, &item.Price, &item.CreatedAt)
+		var price string
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductName, &item.Quantity, &price, &item.CreatedAt)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		items = append(items, item)
+		order := byID[item.OrderID]
+		item.Price, err = parseDecimal(order.TotalAmount.Currency, price)
+		if err != nil {
+			return err
+		}
+		order.Items = append(order.Items, item)
 	}
 
-	return items, nil
+	return rows.Err()
 }
 
-func (r *orderRepository) Update(order *Order) error {
+// Update saves order if it is still at order.Version, and advances the
+// version. It returns ErrVersionConflict if the order was changed in the
+// meantime.
+func (r *orderRepository) Update(ctx context.Context, order *Order) error {
+	ctx, span := tracer.Start(ctx, "orderRepository.Update")
+	defer span.End()
+
 	query := `
 		UPDATE orders
-		SET user_name = $1, user_email = $2, total_amount = $3, status = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5
-		RETURNING updated_at
+		SET user_name = $1, user_email = $2, total_amount = $3, currency = $4, status = $5,
+			version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6 AND version = $7
+		RETURNING version, updated_at
 	`
-	return r.db.QueryRow(query, order.UserName, order.UserEmail, order.TotalAmount, order.Status, order.ID).
-		Scan(&order.UpdatedAt)
-}
-
-func (r *orderRepository) List(page, limit int32) ([]*Order, int32, error) {
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 {
-		limit = 10
+	err := r.db.QueryRowContext(ctx, query, order.UserName, order.UserEmail, order.TotalAmount.decimal(),
+		order.TotalAmount.Currency, order.Status, order.ID, order.Version).
+		Scan(&order.Version, &order.UpdatedAt)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, order.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrVersionConflict
+		}
 	}
+	return err
+}
 
-	offset := (page - 1) * limit
+// List returns a page of the orders matching filter, in its sort order.
+func (r *orderRepository) List(ctx context.Context, filter OrderFilter, page Page) ([]*Order, error) {
+	ctx, span := tracer.Start(ctx, "orderRepository.List")
+	defer span.End()
 
-	// Get total count
-	var total int32
-	countQuery := `SELECT COUNT(*) FROM orders`
-	err := r.db.QueryRow(countQuery).Scan(&total)
-	if err != nil {
-		return nil, 0, err
-	}
+	w := filter.where(page.After)
+	query := `SELECT ` + orderColumns + ` FROM orders` + w.String() + filter.orderBy() +
+		` LIMIT ` + w.arg(page.Limit) + ` OFFSET ` + w.arg(page.Offset)
 
-	// Get orders
-	query := `
-		SELECT id, user_id, user_name, user_email, total_amount, status, created_at, updated_at
-		FROM orders
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, w.args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
 	var orders []*Order
 	for rows.Next() {
-		order := &Order{}
-		err := rows.Scan(
-			&order.ID, &order.UserID, &order.UserName, &order.UserEmail,
-			&order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt,
-		)
-		if err != nil {
-			return nil, 0, err
-		}
-
-		// Get order items
-		items, err := r.getOrderItems(order.ID)
+		order, err := scanOrder(rows)
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
-		order.Items = items
-
 		orders = append(orders, order)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return orders, total, nil
-}
-
-func (r *orderRepository) GetByUserID(userID int32) ([]*Order, error) {
-	query := `
-		SELECT id, user_id, user_name, user_email, total_amount, status, created_at, updated_at
-		FROM orders
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-	`
-	rows, err := r.db.Query(query, userID)
-	if err != nil {
+	if err := r.loadItems(ctx, orders); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return orders, nil
+}
 
-	var orders []*Order
-	for rows.Next() {
-		order := &Order{}
-		err := rows.Scan(
-			&order.ID, &order.UserID, &order.UserName, &order.UserEmail,
-			&order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
+// Count returns the number of orders matching filter.
+func (r *orderRepository) Count(ctx context.Context, filter OrderFilter) (int32, error) {
+	ctx, span := tracer.Start(ctx, "orderRepository.Count")
+	defer span.End()
 
-		// Get order items
-		items, err := r.getOrderItems(order.ID)
-		if err != nil {
-			return nil, err
-		}
-		order.Items = items
+	w := filter.where(nil)
+	var total int32
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders`+w.String(), w.args...).Scan(&total)
+	return total, err
+}
 
-		orders = append(orders, order)
+// UpdateStatus moves an order to a new status and records the change in
+// order_status_history within the same transaction. The current status is
+// read under a row lock so concurrent updates cannot bypass the transition
+// rules, and the update is refused with ErrVersionConflict unless the order
+// is still at version.
+func (r *orderRepository) UpdateStatus(ctx context.Context, id, version int32, status OrderStatus, change StatusChange) error {
+	ctx, span := tracer.Start(ctx, "orderRepository.UpdateStatus")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return orders, nil
-}
+	var current OrderStatus
+	var currentVersion int32
+	err = tx.QueryRowContext(ctx, `SELECT status, version FROM orders WHERE id = $1 FOR UPDATE`, id).
+		Scan(&current, &currentVersion)
+	if err != nil {
+		return err
+	}
+	if currentVersion != version {
+		return ErrVersionConflict
+	}
+
+	if err := ValidateStatusTransition(current, status); err != nil {
+		return err
+	}
 
-func (r *orderRepository) UpdateStatus(id int32, status OrderStatus) error {
 	query := `
 		UPDATE orders
-		SET status = $1, updated_at = CURRENT_TIMESTAMP
+		SET status = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $2
 	`
-	result, err := r.db.Exec(query, status, id)
-	if err != nil {
+	if _, err := tx.ExecContext(ctx, query, status, id); err != nil {
 		return err
 	}
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	if err := insertStatusHistory(ctx, tx, id, current, status, change); err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return sql.ErrNoRows
-	}
+	return tx.Commit()
+}
 
-	return nil
+func (r *orderRepository) Cancel(ctx context.Context, id, version int32, change StatusChange) error {
+	return r.UpdateStatus(ctx, id, version, OrderStatusCancelled, change)
 }
 
-func (r *orderRepository) Cancel(id int32) error {
-	return r.UpdateStatus(id, OrderStatusCancelled)
+func (r *orderRepository) GetHistory(ctx context.Context, orderID int32) ([]*OrderStatusHistory, error) {
+	ctx, span := tracer.Start(ctx, "orderRepository.GetHistory")
+	defer span.End()
+
+	query := `
+		SELECT id, order_id, old_status, new_status, actor, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*OrderStatusHistory
+	for rows.Next() {
+		entry := &OrderStatusHistory{}
+		var oldStatus sql.NullString
+		err := rows.Scan(&entry.ID, &entry.OrderID, &oldStatus, &entry.NewStatus,
+			&entry.Actor, &entry.Reason, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.OldStatus = OrderStatus(oldStatus.String)
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
 }
 
+func insertStatusHistory(ctx context.Context, tx *sql.Tx, orderID int32, oldStatus, newStatus OrderStatus, change StatusChange) error {
+	query := `
+		INSERT INTO order_status_history (order_id, old_status, new_status, actor, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	var old sql.NullString
+	if oldStatus != "" {
+		old = sql.NullString{String: string(oldStatus), Valid: true}
+	}
+	_, err := tx.ExecContext(ctx, query, orderID, old, newStatus, change.Actor, change.Reason)
+	return err
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateStatusTransition(t *testing.T) {
+	statuses := []OrderStatus{
+		OrderStatusPending, OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled,
+	}
+	// Every pair not listed here must be rejected, including staying in the
+	// same status
+	allowed := map[OrderStatus][]OrderStatus{
+		OrderStatusPending:    {OrderStatusProcessing, OrderStatusCancelled},
+		OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
+		OrderStatusShipped:    {OrderStatusDelivered},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			t.Run(fmt.Sprintf("%s to %s", from, to), func(t *testing.T) {
+				if got := from.CanTransitionTo(to); got != want {
+					t.Errorf("CanTransitionTo = %v, want %v", got, want)
+				}
+
+				err := ValidateStatusTransition(from, to)
+				if want {
+					if err != nil {
+						t.Errorf("ValidateStatusTransition = %v, want nil", err)
+					}
+					return
+				}
+				var transitionErr *StatusTransitionError
+				if !errors.As(err, &transitionErr) {
+					t.Fatalf("ValidateStatusTransition = %v, want *StatusTransitionError", err)
+				}
+				if transitionErr.From != from || transitionErr.To != to {
+					t.Errorf("error describes %s to %s", transitionErr.From, transitionErr.To)
+				}
+				if fmt.Sprint(transitionErr.Allowed) != fmt.Sprint(allowed[from]) {
+					t.Errorf("Allowed = %v, want %v", transitionErr.Allowed, allowed[from])
+				}
+			})
+		}
+	}
+}
+
+func TestStatusTransitionErrorMessage(t *testing.T) {
+	for _, tc := range []struct {
+		from, to OrderStatus
+		want     string
+	}{
+		{OrderStatusShipped, OrderStatusCancelled, "cannot change order status from SHIPPED to CANCELLED (allowed: DELIVERED)"},
+		{OrderStatusPending, OrderStatusDelivered, "cannot change order status from PENDING to DELIVERED (allowed: PROCESSING, CANCELLED)"},
+		{OrderStatusDelivered, OrderStatusPending, "cannot change order status from DELIVERED to PENDING (allowed: none)"},
+	} {
+		if got := ValidateStatusTransition(tc.from, tc.to).Error(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+// benchRoundTrip is the latency the fake driver adds to every query, standing
+// in for the network round trip to Postgres that dominates List's cost.
+const benchRoundTrip = 100 * time.Microsecond
+
+// benchItemsPerOrder is the number of items the fake driver returns per order.
+const benchItemsPerOrder = 3
+
+// BenchmarkOrderRepositoryList lists pages of orders with their items. The
+// queries/op metric is the number of statements List sends, which no longer
+// grows with the page size.
+func BenchmarkOrderRepositoryList(b *testing.B) {
+	for _, size := range []int32{10, 100} {
+		b.Run(fmt.Sprintf("page=%d", size), func(b *testing.B) {
+			var queries atomic.Int64
+			db := sql.OpenDB(benchConnector{queries: &queries})
+			defer db.Close()
+			repo := NewOrderRepository(db)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				orders, err := repo.List(ctx, OrderFilter{}, Page{Limit: size})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(orders) != int(size) || len(orders[0].Items) != benchItemsPerOrder {
+					b.Fatalf("got %d orders with %d items", len(orders), len(orders[0].Items))
+				}
+			}
+			b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func TestOrderRepositoryListLoadsItemsInOneQuery(t *testing.T) {
+	var queries atomic.Int64
+	db := sql.OpenDB(benchConnector{queries: &queries})
+	defer db.Close()
+
+	orders, err := NewOrderRepository(db).List(context.Background(), OrderFilter{}, Page{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("List sent %d queries, want 2", got)
+	}
+	if len(orders) != 5 {
+		t.Fatalf("got %d orders, want 5", len(orders))
+	}
+	for _, order := range orders {
+		if len(order.Items) != benchItemsPerOrder {
+			t.Fatalf("order %d has %d items, want %d", order.ID, len(order.Items), benchItemsPerOrder)
+		}
+		for _, item := range order.Items {
+			if item.OrderID != order.ID || item.Price != (Money{Currency: "USD", Minor: 999}) {
+				t.Errorf("order %d has item %+v", order.ID, *item)
+			}
+		}
+	}
+}
+
+// The fake driver below answers the two statements List sends: the orders
+// query returns as many orders as its LIMIT asks for, and the items query
+// returns benchItemsPerOrder items for every order ID it is given.
+
+type benchDriver struct{}
+
+func (benchDriver) Open(string) (driver.Conn, error) {
+	return &benchConn{queries: new(atomic.Int64)}, nil
+}
+
+type benchConnector struct {
+	queries *atomic.Int64
+}
+
+func (c benchConnector) Connect(context.Context) (driver.Conn, error) {
+	return &benchConn{queries: c.queries}, nil
+}
+
+func (benchConnector) Driver() driver.Driver { return benchDriver{} }
+
+type benchConn struct {
+	queries *atomic.Int64
+}
+
+func (c *benchConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("orders-bench: prepared statements are not supported")
+}
+
+func (c *benchConn) Close() error { return nil }
+
+func (c *benchConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("orders-bench: transactions are not supported")
+}
+
+func (c *benchConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.queries.Add(1)
+	time.Sleep(benchRoundTrip)
+
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	switch {
+	case strings.Contains(query, "FROM order_items"):
+		ids, err := parseInt32Array(args[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		rows := &benchRows{columns: []string{"id", "order_id", "product_name", "quantity", "price", "created_at"}}
+		for _, id := range ids {
+			for j := 0; j < benchItemsPerOrder; j++ {
+				rows.values = append(rows.values, []driver.Value{
+					int64(id)*benchItemsPerOrder + int64(j), int64(id), "Widget", int64(2), "9.99", created,
+				})
+			}
+		}
+		return rows, nil
+
+	case strings.Contains(query, "FROM orders"):
+		// With no filter the arguments are just LIMIT and OFFSET
+		limit := args[0].Value.(int64)
+		rows := &benchRows{columns: strings.Split(orderColumns, ", ")}
+		for id := int64(1); id <= limit; id++ {
+			rows.values = append(rows.values, []driver.Value{
+				id, int64(1), "Alice", "alice@example.com", "59.94", "USD", "PENDING", int64(1), created, created,
+			})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("orders-bench: unexpected query %q", query)
+}
+
+// parseInt32Array decodes the "{1,2,3}" literal pq.Array sends for []int32.
+func parseInt32Array(value driver.Value) ([]int32, error) {
+	literal, ok := value.(string)
+	if !ok {
+		if b, isBytes := value.([]byte); isBytes {
+			literal = string(b)
+		} else {
+			return nil, fmt.Errorf("orders-bench: unexpected array argument %T", value)
+		}
+	}
+	literal = strings.Trim(literal, "{}")
+	if literal == "" {
+		return nil, nil
+	}
+	var ids []int32
+	for _, field := range strings.Split(literal, ",") {
+		id, err := strconv.ParseInt(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int32(id))
+	}
+	return ids, nil
+}
+
+type benchRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *benchRows) Columns() []string { return r.columns }
+
+func (r *benchRows) Close() error { return nil }
+
+func (r *benchRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
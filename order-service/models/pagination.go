@@ -0,0 +1,20 @@
+package models
+
+// PageCursor is the position of the last row of a page: the value of the
+// column the list is sorted by, as text, and the row's ID.
+type PageCursor struct {
+	Key string `json:"k"`
+	ID  int32  `json:"id"`
+}
+
+// Page selects the rows of a list to return.
+type Page struct {
+	// After starts the page after this row. Reading from a cursor is
+	// unaffected by rows added or removed since the previous page.
+	After *PageCursor
+
+	// Offset skips rows instead, for callers still using page numbers.
+	Offset int32
+
+	Limit int32
+}
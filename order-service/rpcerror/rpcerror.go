@@ -0,0 +1,96 @@
+// Package rpcerror builds gRPC errors that carry google.rpc error details
+// (ErrorInfo, BadRequest, ResourceInfo, PreconditionFailure, RetryInfo) and
+// decodes them again on the client side. Every error built here has an
+// ErrorInfo with a stable reason code, so that clients can act on the
+// reason instead of parsing messages.
+package rpcerror
+
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain is the ErrorInfo domain of the errors built by this service.
+const Domain = "order-service"
+
+// New returns an error with code and message, an ErrorInfo carrying
+// reason, and any further details.
+func New(code codes.Code, reason, message string, details ...protoadapt.MessageV1) error {
+	info := &errdetails.ErrorInfo{Reason: reason, Domain: Domain}
+	st, err := status.New(code, message).WithDetails(append([]protoadapt.MessageV1{info}, details...)...)
+	if err != nil {
+		// Only possible if a detail cannot be marshalled
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// NotFound reports a missing resource, naming it in a ResourceInfo.
+func NotFound(reason, resourceType, resourceName, message string) error {
+	return New(codes.NotFound, reason, message, Resource(resourceType, resourceName))
+}
+
+// AlreadyExists reports a conflicting resource, naming it in a ResourceInfo.
+func AlreadyExists(reason, resourceType, resourceName, message string) error {
+	return New(codes.AlreadyExists, reason, message, Resource(resourceType, resourceName))
+}
+
+// InvalidArgument reports invalid request fields in a BadRequest.
+func InvalidArgument(reason, message string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	if len(violations) == 0 {
+		return New(codes.InvalidArgument, reason, message)
+	}
+	return New(codes.InvalidArgument, reason, message, &errdetails.BadRequest{FieldViolations: violations})
+}
+
+// FailedPrecondition reports why the resource is not in a state that allows
+// the call, in a PreconditionFailure.
+func FailedPrecondition(reason, message string, violations ...*errdetails.PreconditionFailure_Violation) error {
+	if len(violations) == 0 {
+		return New(codes.FailedPrecondition, reason, message)
+	}
+	return New(codes.FailedPrecondition, reason, message, &errdetails.PreconditionFailure{Violations: violations})
+}
+
+// PermissionDenied reports that the caller may not make the call.
+func PermissionDenied(reason, message string) error {
+	return New(codes.PermissionDenied, reason, message)
+}
+
+// Unauthenticated reports missing or invalid credentials.
+func Unauthenticated(reason, message string) error {
+	return New(codes.Unauthenticated, reason, message)
+}
+
+// Unavailable reports a transient failure, with a RetryInfo suggesting when
+// to try again.
+func Unavailable(reason, message string, retryAfter time.Duration) error {
+	return New(codes.Unavailable, reason, message, RetryAfter(retryAfter))
+}
+
+// Resource returns a ResourceInfo naming a resource, e.g. ("user", "42").
+func Resource(resourceType, resourceName string) *errdetails.ResourceInfo {
+	return &errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: resourceName}
+}
+
+// FieldViolation describes one invalid request field. Nested fields use
+// dotted paths and list indexes, e.g. "items[2].quantity".
+func FieldViolation(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+// PreconditionViolation describes one failed precondition. subject names
+// the resource, e.g. "order/42".
+func PreconditionViolation(violationType, subject, description string) *errdetails.PreconditionFailure_Violation {
+	return &errdetails.PreconditionFailure_Violation{Type: violationType, Subject: subject, Description: description}
+}
+
+// RetryAfter returns a RetryInfo asking clients to wait d before retrying.
+func RetryAfter(d time.Duration) *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{RetryDelay: durationpb.New(d)}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Reason codes sent in the ErrorInfo of errors returned by
+// OrderServiceServer. Clients may rely on them, so they must not change.
+const (
+	reasonInvalidFields            = "INVALID_FIELDS"
+	reasonOrderNotFound            = "ORDER_NOT_FOUND"
+	reasonUserNotFound             = "USER_NOT_FOUND"
+	reasonInvalidStatusTransition  = "INVALID_STATUS_TRANSITION"
+	reasonAuthenticationRequired   = "AUTHENTICATION_REQUIRED"
+	reasonNotOrderOwner            = "NOT_ORDER_OWNER"
+	reasonUserServiceUnavailable   = "USER_SERVICE_UNAVAILABLE"
+	reasonIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	reasonIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	reasonVersionConflict          = "VERSION_CONFLICT"
+	reasonInternal                 = "INTERNAL"
+)
+
+// userServiceRetryDelay is suggested to clients when the User Service is
+// unavailable and did not say how long to wait.
+const userServiceRetryDelay = time.Second
+
+// internalError reports a failure the caller cannot fix. The cause is
+// logged where it happened and not sent to the client.
+func internalError(message string) error {
+	return rpcerror.New(codes.Internal, reasonInternal, message)
+}
+
+func orderNotFound(id int32) error {
+	return rpcerror.NotFound(reasonOrderNotFound, "order", strconv.Itoa(int(id)), "order not found")
+}
+
+func userNotFound(id int32) error {
+	return rpcerror.NotFound(reasonUserNotFound, "user", strconv.Itoa(int(id)), "user not found")
+}
+
+// orderConflict reports that the order changed since the caller read it;
+// they should read it again and retry.
+func orderConflict(id int32) error {
+	return rpcerror.New(codes.Aborted, reasonVersionConflict, "order was modified concurrently, read it again and retry",
+		rpcerror.Resource("order", strconv.Itoa(int(id))))
+}
+
+// invalidTransition reports a status change the state machine forbids.
+func invalidTransition(orderID int32, err error) error {
+	return rpcerror.FailedPrecondition(reasonInvalidStatusTransition, err.Error(),
+		rpcerror.PreconditionViolation("STATUS_TRANSITION", "order/"+strconv.Itoa(int(orderID)), err.Error()))
+}
+
+func invalidField(field, description string) error {
+	return rpcerror.InvalidArgument(reasonInvalidFields, field+" "+description,
+		rpcerror.FieldViolation(field, description))
+}
+
+// invalidItem reports a problem with field of the i-th order item.
+func invalidItem(i int, field, description string) error {
+	path := fmt.Sprintf("items[%d].%s", i, field)
+	return rpcerror.InvalidArgument(reasonInvalidFields, fmt.Sprintf("item %d: %s %s", i, field, description),
+		rpcerror.FieldViolation(path, description))
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"order-service/models"
+	pb "order-service/proto/order"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// orderFilter converts the filter and order_by fields of a ListOrders
+// request.
+func orderFilter(req *pb.ListOrdersRequest) (models.OrderFilter, error) {
+	filter := models.OrderFilter{UserID: req.UserId}
+	if req.UserId < 0 {
+		return filter, invalidField("user_id", "must not be negative")
+	}
+
+	var err error
+	if filter.Statuses, err = parseStatuses(req.Statuses); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = parseTime("created_after", req.CreatedAfter); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = parseTime("created_before", req.CreatedBefore); err != nil {
+		return filter, err
+	}
+	if filter.UpdatedAfter, err = parseTime("updated_after", req.UpdatedAfter); err != nil {
+		return filter, err
+	}
+	if filter.UpdatedBefore, err = parseTime("updated_before", req.UpdatedBefore); err != nil {
+		return filter, err
+	}
+
+	if filter.MinTotal, err = moneyBound("min_total", req.MinTotal); err != nil {
+		return filter, err
+	}
+	if filter.MaxTotal, err = moneyBound("max_total", req.MaxTotal); err != nil {
+		return filter, err
+	}
+	if filter.MinTotal != nil && filter.MaxTotal != nil {
+		if filter.MinTotal.Currency != filter.MaxTotal.Currency {
+			return filter, invalidField("max_total.currency_code", "must match min_total.currency_code")
+		}
+		if filter.MaxTotal.Minor < filter.MinTotal.Minor {
+			return filter, invalidField("max_total", "must not be less than min_total")
+		}
+	}
+
+	filter.SortBy, filter.Descending, err = parseOrderBy(req.OrderBy)
+	return filter, err
+}
+
+// userOrdersFilter converts the filter fields of a GetUserOrders request.
+// The orders are always sorted newest first.
+func userOrdersFilter(req *pb.GetUserOrdersRequest) (models.OrderFilter, error) {
+	filter := models.OrderFilter{UserID: req.UserId, SortBy: models.SortByCreatedAt, Descending: true}
+
+	var err error
+	if filter.Statuses, err = parseStatuses(req.Statuses); err != nil {
+		return filter, err
+	}
+	if filter.CreatedAfter, err = parseTime("created_after", req.CreatedAfter); err != nil {
+		return filter, err
+	}
+	if filter.CreatedBefore, err = parseTime("created_before", req.CreatedBefore); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func parseStatuses(values []pb.OrderStatus) ([]models.OrderStatus, error) {
+	var statuses []models.OrderStatus
+	for i, status := range values {
+		if _, ok := pb.OrderStatus_name[int32(status)]; !ok {
+			return nil, invalidField(fmt.Sprintf("statuses[%d]", i), "is not a known status")
+		}
+		statuses = append(statuses, protoStatusToModel(status))
+	}
+	return statuses, nil
+}
+
+// parseOrderBy parses an AIP-132 style order_by of a single field.
+func parseOrderBy(orderBy string) (models.OrderSort, bool, error) {
+	fields := strings.Fields(orderBy)
+	if len(fields) == 0 {
+		return models.SortByCreatedAt, true, nil
+	}
+
+	var sortBy models.OrderSort
+	switch models.OrderSort(fields[0]) {
+	case models.SortByCreatedAt, models.SortByTotalAmount, models.SortByStatus:
+		sortBy = models.OrderSort(fields[0])
+	default:
+		return "", false, invalidField("order_by", "must sort by created_at, total_amount or status")
+	}
+	switch {
+	case len(fields) == 1:
+		return sortBy, false, nil
+	case len(fields) == 2 && strings.EqualFold(fields[1], "asc"):
+		return sortBy, false, nil
+	case len(fields) == 2 && strings.EqualFold(fields[1], "desc"):
+		return sortBy, true, nil
+	default:
+		return "", false, invalidField("order_by", `must be a field name optionally followed by "asc" or "desc"`)
+	}
+}
+
+func parseTime(field, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, invalidField(field, "must be an RFC 3339 timestamp, e.g. 2024-05-01T00:00:00Z")
+	}
+	return t, nil
+}
+
+func moneyBound(field string, value *pb.Money) (*models.Money, error) {
+	if value == nil {
+		return nil, nil
+	}
+	money, err := models.NewMoney(value.CurrencyCode, value.Units, value.Nanos)
+	if err != nil {
+		return nil, invalidField(field, err.Error())
+	}
+	return &money, nil
+}
+
+// listQuery fingerprints the filters and sort order of a ListOrders
+// request, so that a page token cannot be used with different ones.
+func listQuery(req *pb.ListOrdersRequest) string {
+	query := proto.Clone(req).(*pb.ListOrdersRequest)
+	query.Page = 0
+	query.Limit = 0
+	query.PageToken = ""
+	query.IncludeTotal = false
+	return fingerprint(query)
+}
+
+// userOrdersQuery is the GetUserOrders counterpart of listQuery.
+func userOrdersQuery(req *pb.GetUserOrdersRequest) string {
+	query := proto.Clone(req).(*pb.GetUserOrdersRequest)
+	query.Limit = 0
+	query.PageToken = ""
+	return fingerprint(query)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"order-service/models"
+	pb "order-service/proto/order"
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	for _, tc := range []struct {
+		orderBy    string
+		sortBy     models.OrderSort
+		descending bool
+	}{
+		{"", models.SortByCreatedAt, true},
+		{"created_at", models.SortByCreatedAt, false},
+		{"created_at desc", models.SortByCreatedAt, true},
+		{"total_amount", models.SortByTotalAmount, false},
+		{"total_amount ASC", models.SortByTotalAmount, false},
+		{"total_amount desc", models.SortByTotalAmount, true},
+		{"status", models.SortByStatus, false},
+		{"  status   DESC ", models.SortByStatus, true},
+	} {
+		sortBy, descending, err := parseOrderBy(tc.orderBy)
+		if err != nil || sortBy != tc.sortBy || descending != tc.descending {
+			t.Errorf("parseOrderBy(%q) = %s, %v, %v; want %s, %v", tc.orderBy, sortBy, descending, err, tc.sortBy, tc.descending)
+		}
+	}
+
+	for _, orderBy := range []string{"id", "user_id desc", "created_at up", "created_at desc, id", "status desc asc"} {
+		if _, _, err := parseOrderBy(orderBy); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("parseOrderBy(%q) = %v, want InvalidArgument", orderBy, err)
+		}
+	}
+}
+
+func TestOrderFilter(t *testing.T) {
+	filter, err := orderFilter(&pb.ListOrdersRequest{
+		UserId:        7,
+		Statuses:      []pb.OrderStatus{pb.OrderStatus_PENDING, pb.OrderStatus_SHIPPED},
+		CreatedAfter:  "2026-03-01T00:00:00Z",
+		UpdatedBefore: "2026-03-02T00:00:00+02:00",
+		MinTotal:      &pb.Money{CurrencyCode: "usd", Units: 10},
+		MaxTotal:      &pb.Money{CurrencyCode: "USD", Units: 20, Nanos: 500_000_000},
+		OrderBy:       "total_amount desc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.UserID != 7 || len(filter.Statuses) != 2 || filter.Statuses[1] != models.OrderStatusShipped {
+		t.Errorf("filter = %+v", filter)
+	}
+	if !filter.CreatedAfter.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) ||
+		!filter.UpdatedBefore.Equal(time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("times = %v, %v", filter.CreatedAfter, filter.UpdatedBefore)
+	}
+	if *filter.MinTotal != (models.Money{Currency: "USD", Minor: 1000}) || *filter.MaxTotal != (models.Money{Currency: "USD", Minor: 2050}) {
+		t.Errorf("totals = %+v, %+v", filter.MinTotal, filter.MaxTotal)
+	}
+	if filter.SortBy != models.SortByTotalAmount || !filter.Descending {
+		t.Errorf("sort = %s descending=%v", filter.SortBy, filter.Descending)
+	}
+}
+
+func TestOrderFilterRejectsInvalidFilters(t *testing.T) {
+	for _, tc := range []struct {
+		req   *pb.ListOrdersRequest
+		field string
+	}{
+		{&pb.ListOrdersRequest{UserId: -1}, "user_id"},
+		{&pb.ListOrdersRequest{Statuses: []pb.OrderStatus{pb.OrderStatus_PENDING, 99}}, "statuses[1]"},
+		{&pb.ListOrdersRequest{CreatedAfter: "2026-03-01"}, "created_after"},
+		{&pb.ListOrdersRequest{CreatedBefore: "yesterday"}, "created_before"},
+		{&pb.ListOrdersRequest{UpdatedAfter: "2026-03-01 00:00:00"}, "updated_after"},
+		{&pb.ListOrdersRequest{UpdatedBefore: "1"}, "updated_before"},
+		{&pb.ListOrdersRequest{MinTotal: &pb.Money{CurrencyCode: "US", Units: 1}}, "min_total"},
+		{&pb.ListOrdersRequest{MaxTotal: &pb.Money{CurrencyCode: "USD", Nanos: 5}}, "max_total"},
+		{&pb.ListOrdersRequest{MinTotal: &pb.Money{CurrencyCode: "USD", Units: 1}, MaxTotal: &pb.Money{CurrencyCode: "EUR", Units: 2}}, "max_total.currency_code"},
+		{&pb.ListOrdersRequest{MinTotal: &pb.Money{CurrencyCode: "USD", Units: 2}, MaxTotal: &pb.Money{CurrencyCode: "USD", Units: 1}}, "max_total"},
+		{&pb.ListOrdersRequest{OrderBy: "id"}, "order_by"},
+	} {
+		_, err := orderFilter(tc.req)
+		violations := rpcerror.Decode(err).FieldViolations
+		if status.Code(err) != codes.InvalidArgument || len(violations) != 1 || violations[0].Field != tc.field {
+			t.Errorf("orderFilter(%v) = %v, want InvalidArgument on %s", tc.req, err, tc.field)
+		}
+	}
+}
+
+func TestUserOrdersFilterSortsNewestFirst(t *testing.T) {
+	filter, err := userOrdersFilter(&pb.GetUserOrdersRequest{UserId: 7, Statuses: []pb.OrderStatus{pb.OrderStatus_DELIVERED}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.UserID != 7 || filter.SortBy != models.SortByCreatedAt || !filter.Descending {
+		t.Errorf("filter = %+v", filter)
+	}
+}
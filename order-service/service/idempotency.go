@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"order-service/auth"
+	"order-service/models"
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// idempotencyKeyHeader is the metadata key clients may use instead of the
+// idempotency_key request field.
+const idempotencyKeyHeader = "idempotency-key"
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyCleanupInterval is how often expired idempotency keys are
+// deleted.
+const idempotencyCleanupInterval = time.Hour
+
+// idempotencyGuard replays stored responses for requests that carry an
+// idempotency key that has already been used by the same caller.
+type idempotencyGuard struct {
+	repo models.IdempotencyRepository
+	// ttl is how long a key is remembered after its first use
+	ttl time.Duration
+}
+
+func newIdempotencyGuard(repo models.IdempotencyRepository) *idempotencyGuard {
+	return &idempotencyGuard{repo: repo, ttl: idempotencyTTLFromEnv()}
+}
+
+// idempotencyTTLFromEnv reads IDEMPOTENCY_KEY_TTL, defaulting to 24 hours.
+func idempotencyTTLFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_KEY_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// idempotencyOwner returns the caller a key is scoped to. Anonymous callers
+// share a single scope.
+func idempotencyOwner(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return id.String()
+	}
+	return ""
+}
+
+// idempotencyKey returns the key from the request field, falling back to
+// the idempotency-key metadata entry.
+func idempotencyKey(ctx context.Context, fieldValue string) string {
+	if fieldValue != "" {
+		return fieldValue
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(idempotencyKeyHeader); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// begin reserves key for method. If a response was already stored for the
+// same key and payload it is unmarshalled into resp and replayed is true.
+func (g *idempotencyGuard) begin(ctx context.Context, method, key string, req, resp proto.Message) (replayed bool, err error) {
+	if len(key) > maxIdempotencyKeyLength {
+		description := fmt.Sprintf("must be at most %d characters", maxIdempotencyKeyLength)
+		return false, rpcerror.InvalidArgument(reasonInvalidFields, "idempotency key "+description,
+			rpcerror.FieldViolation("idempotency_key", description))
+	}
+
+	hash, err := requestHash(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error hashing request", "error", err)
+		return false, internalError("failed to process idempotency key")
+	}
+
+	record, reserved, err := g.repo.Reserve(ctx, idempotencyOwner(ctx), key, method, hash, g.ttl)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reserving idempotency key", "error", err)
+		return false, internalError("failed to process idempotency key")
+	}
+	if reserved {
+		return false, nil
+	}
+
+	if record.RequestHash != hash {
+		return false, rpcerror.InvalidArgument(reasonIdempotencyKeyReused, "idempotency key was already used with a different request",
+			rpcerror.FieldViolation("idempotency_key", "was already used with a different request"))
+	}
+	if record.Response == nil {
+		return false, rpcerror.New(codes.AlreadyExists, reasonIdempotencyKeyInProgress,
+			"a request with this idempotency key is still in progress", rpcerror.RetryAfter(time.Second))
+	}
+	if err := proto.Unmarshal(record.Response, resp); err != nil {
+		slog.ErrorContext(ctx, "Error decoding stored response", "error", err)
+		return false, internalError("failed to process idempotency key")
+	}
+	return true, nil
+}
+
+// finish stores resp as the result for key. It runs even if the caller has
+// already gone away, since the work it records has been done.
+func (g *idempotencyGuard) finish(ctx context.Context, method, key string, resp proto.Message) {
+	data, err := proto.Marshal(resp)
+	if err == nil {
+		err = g.repo.Complete(context.WithoutCancel(ctx), idempotencyOwner(ctx), key, method, data)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error storing idempotent response", "error", err)
+	}
+}
+
+// run deletes expired keys until ctx is cancelled.
+func (g *idempotencyGuard) run(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := g.repo.DeleteExpired(ctx, g.ttl)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error deleting expired idempotency keys", "error", err)
+			} else if deleted > 0 {
+				slog.InfoContext(ctx, "Deleted expired idempotency keys", "count", deleted)
+			}
+		}
+	}
+}
+
+// abort releases key so that the client can retry after a failure.
+func (g *idempotencyGuard) abort(ctx context.Context, method, key string) {
+	if err := g.repo.Release(context.WithoutCancel(ctx), idempotencyOwner(ctx), key, method); err != nil {
+		slog.ErrorContext(ctx, "Error releasing idempotency key", "error", err)
+	}
+}
+
+// requestHash fingerprints req with its idempotency_key field cleared.
+func requestHash(req proto.Message) (string, error) {
+	clone := proto.Clone(req)
+	msg := clone.ProtoReflect()
+	if fd := msg.Descriptor().Fields().ByName("idempotency_key"); fd != nil {
+		msg.Clear(fd)
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(clone)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"order-service/auth"
+	"order-service/models"
+	pb "order-service/proto/order"
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeIdempotencyRepository keeps idempotency records in memory. Records
+// never expire; the takeover of expired and abandoned keys is a property
+// of the SQL and is covered in the models package.
+type fakeIdempotencyRepository struct {
+	records map[[3]string]*models.IdempotencyRecord
+}
+
+func newFakeIdempotencyRepository() *fakeIdempotencyRepository {
+	return &fakeIdempotencyRepository{records: map[[3]string]*models.IdempotencyRecord{}}
+}
+
+func (r *fakeIdempotencyRepository) Reserve(ctx context.Context, owner, key, method, requestHash string, ttl time.Duration) (*models.IdempotencyRecord, bool, error) {
+	if record, ok := r.records[[3]string{owner, method, key}]; ok {
+		copied := *record
+		return &copied, false, nil
+	}
+	record := &models.IdempotencyRecord{Owner: owner, Key: key, Method: method, RequestHash: requestHash, CreatedAt: time.Now()}
+	r.records[[3]string{owner, method, key}] = record
+	return record, true, nil
+}
+
+func (r *fakeIdempotencyRepository) Complete(ctx context.Context, owner, key, method string, response []byte) error {
+	r.records[[3]string{owner, method, key}].Response = response
+	return nil
+}
+
+func (r *fakeIdempotencyRepository) Release(ctx context.Context, owner, key, method string) error {
+	if record := r.records[[3]string{owner, method, key}]; record != nil && record.Response == nil {
+		delete(r.records, [3]string{owner, method, key})
+	}
+	return nil
+}
+
+func (r *fakeIdempotencyRepository) DeleteExpired(ctx context.Context, ttl time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyReplaysSameRequest(t *testing.T) {
+	guard := &idempotencyGuard{repo: newFakeIdempotencyRepository(), ttl: time.Hour}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+	req := &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Keyboard", Quantity: 1}}, IdempotencyKey: "key-1"}
+
+	if replayed, err := guard.begin(ctx, "Create", "key-1", req, &pb.CreateOrderResponse{}); err != nil || replayed {
+		t.Fatalf("first begin = %v, %v; want a fresh reservation", replayed, err)
+	}
+	guard.finish(ctx, "Create", "key-1", &pb.CreateOrderResponse{Message: "created"})
+
+	var resp pb.CreateOrderResponse
+	replayed, err := guard.begin(ctx, "Create", "key-1", proto.Clone(req), &resp)
+	if err != nil || !replayed {
+		t.Fatalf("retry = %v, %v; want the stored response", replayed, err)
+	}
+	if resp.Message != "created" {
+		t.Errorf("replayed message = %q", resp.Message)
+	}
+}
+
+func TestIdempotencyKeyFromMetadata(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotencyKeyHeader, "from-header"))
+	if got := idempotencyKey(ctx, ""); got != "from-header" {
+		t.Errorf("idempotencyKey = %q, want the header", got)
+	}
+	if got := idempotencyKey(ctx, "from-field"); got != "from-field" {
+		t.Errorf("idempotencyKey = %q, want the request field", got)
+	}
+}
+
+func TestIdempotencyRejectsReuse(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		finish bool
+		retry  proto.Message
+		code   codes.Code
+		reason string
+	}{
+		{"different payload", true, &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Mouse", Quantity: 1}}}, codes.InvalidArgument, reasonIdempotencyKeyReused},
+		{"different payload in progress", false, &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Mouse", Quantity: 1}}}, codes.InvalidArgument, reasonIdempotencyKeyReused},
+		{"same payload in progress", false, &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Keyboard", Quantity: 1}}, IdempotencyKey: "key-1"}, codes.AlreadyExists, reasonIdempotencyKeyInProgress},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			guard := &idempotencyGuard{repo: newFakeIdempotencyRepository(), ttl: time.Hour}
+			ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+			if _, err := guard.begin(ctx, "Create", "key-1", &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Keyboard", Quantity: 1}}, IdempotencyKey: "key-1"}, &pb.CreateOrderResponse{}); err != nil {
+				t.Fatal(err)
+			}
+			if tc.finish {
+				guard.finish(ctx, "Create", "key-1", &pb.CreateOrderResponse{Message: "created"})
+			}
+
+			_, err := guard.begin(ctx, "Create", "key-1", tc.retry, &pb.CreateOrderResponse{})
+			if status.Code(err) != tc.code || rpcerror.Reason(err) != tc.reason {
+				t.Errorf("retry = %v, want %v with reason %s", err, tc.code, tc.reason)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTheCaller(t *testing.T) {
+	guard := &idempotencyGuard{repo: newFakeIdempotencyRepository(), ttl: time.Hour}
+	first := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+	second := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 2, Role: auth.RoleCustomer})
+
+	if _, err := guard.begin(first, "Create", "key-1", &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Keyboard", Quantity: 1}}, IdempotencyKey: "key-1"}, &pb.CreateOrderResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	guard.finish(first, "Create", "key-1", &pb.CreateOrderResponse{Message: "created"})
+
+	replayed, err := guard.begin(second, "Create", "key-1", &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Mouse", Quantity: 1}}}, &pb.CreateOrderResponse{})
+	if err != nil || replayed {
+		t.Errorf("another caller's begin = %v, %v; want a fresh reservation", replayed, err)
+	}
+	replayed, err = guard.begin(first, "Other", "key-1", &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Mouse", Quantity: 1}}}, &pb.CreateOrderResponse{})
+	if err != nil || replayed {
+		t.Errorf("another method's begin = %v, %v; want a fresh reservation", replayed, err)
+	}
+}
+
+func TestIdempotencyAbortAllowsRetry(t *testing.T) {
+	guard := &idempotencyGuard{repo: newFakeIdempotencyRepository(), ttl: time.Hour}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+	if _, err := guard.begin(ctx, "Create", "key-1", &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Keyboard", Quantity: 1}}, IdempotencyKey: "key-1"}, &pb.CreateOrderResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	guard.abort(ctx, "Create", "key-1")
+
+	if replayed, err := guard.begin(ctx, "Create", "key-1", &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Mouse", Quantity: 1}}}, &pb.CreateOrderResponse{}); err != nil || replayed {
+		t.Errorf("begin after abort = %v, %v; want a fresh reservation", replayed, err)
+	}
+}
+
+func TestIdempotencyKeyLength(t *testing.T) {
+	guard := &idempotencyGuard{repo: newFakeIdempotencyRepository(), ttl: time.Hour}
+	key := string(make([]byte, maxIdempotencyKeyLength+1))
+
+	_, err := guard.begin(context.Background(), "Create", key, &pb.CreateOrderRequest{UserId: 1, Items: []*pb.OrderItem{{ProductName: "Keyboard", Quantity: 1}}, IdempotencyKey: "key-1"}, &pb.CreateOrderResponse{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("begin with a long key = %v, want InvalidArgument", err)
+	}
+}
@@ -3,53 +3,93 @@ package service
 import (
 	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 
+	"order-service/auth"
 	"order-service/client"
 	"order-service/models"
+	"order-service/pagetoken"
 	pb "order-service/proto/order"
+	"order-service/rpcerror"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
+// defaultActor is recorded in the status history when the caller is not
+// authenticated.
+const defaultActor = "anonymous"
+
 type OrderServiceServer struct {
 	pb.UnimplementedOrderServiceServer
 	repo           models.OrderRepository
 	userClient     *client.UserServiceClient
+	idempotency    *idempotencyGuard
+	pageTokens     *pagetoken.Codec
 }
 
-func NewOrderServiceServer(repo models.OrderRepository, userClient *client.UserServiceClient) *OrderServiceServer {
+func NewOrderServiceServer(repo models.OrderRepository, idempotencyRepo models.IdempotencyRepository, userClient *client.UserServiceClient, pageTokens *pagetoken.Codec) *OrderServiceServer {
 	return &OrderServiceServer{
-		repo:       repo,
-		userClient: userClient,
+		repo:        repo,
+		userClient:  userClient,
+		idempotency: newIdempotencyGuard(idempotencyRepo),
+		pageTokens:  pageTokens,
 	}
 }
 
+// Run deletes expired idempotency keys until ctx is cancelled.
+func (s *OrderServiceServer) Run(ctx context.Context) {
+	s.idempotency.run(ctx)
+}
+
 func (s *OrderServiceServer) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest) (*pb.CreateOrderResponse, error) {
-	log.Printf("Creating order for user ID: %d", req.UserId)
+	slog.InfoContext(ctx, "Creating order", "user_id", req.UserId, "items", len(req.Items))
+
+	if err := authorizeUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+
+	key := idempotencyKey(ctx, req.IdempotencyKey)
+	if key == "" {
+		return s.createOrder(ctx, req)
+	}
+
+	replay := &pb.CreateOrderResponse{}
+	replayed, err := s.idempotency.begin(ctx, "CreateOrder", key, req, replay)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return replay, nil
+	}
+
+	resp, err := s.createOrder(ctx, req)
+	if err != nil {
+		s.idempotency.abort(ctx, "CreateOrder", key)
+		return nil, err
+	}
+	s.idempotency.finish(ctx, "CreateOrder", key, resp)
+	return resp, nil
+}
+
+func (s *OrderServiceServer) createOrder(ctx context.Context, req *pb.CreateOrderRequest) (*pb.CreateOrderResponse, error) {
+	// Validate items and calculate total amount
+	items, totalAmount, err := itemsFromProto(req.Items)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate user through User Service
 	isValid, user, err := s.userClient.ValidateUser(ctx, req.UserId)
 	if err != nil {
-		log.Printf("Error validating user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to validate user")
+		slog.ErrorContext(ctx, "Error validating user", "error", err)
+		return nil, userServiceError(err)
 	}
 
 	if !isValid {
-		return nil, status.Error(codes.NotFound, "user not found")
-	}
-
-	// Calculate total amount
-	var totalAmount float64
-	items := make([]*models.OrderItem, len(req.Items))
-	for i, item := range req.Items {
-		totalAmount += item.Price * float64(item.Quantity)
-		items[i] = &models.OrderItem{
-			ProductName: item.ProductName,
-			Quantity:    item.Quantity,
-			Price:       item.Price,
-		}
+		return nil, userNotFound(req.UserId)
 	}
 
 	// Create order
@@ -62,9 +102,9 @@ func (s *OrderServiceServer) CreateOrder(ctx context.Context, req *pb.CreateOrde
 		Status:      models.OrderStatusPending,
 	}
 
-	if err := s.repo.Create(order); err != nil {
-		log.Printf("Error creating order: %v", err)
-		return nil, status.Error(codes.Internal, "failed to create order")
+	if err := s.repo.Create(ctx, order, models.StatusChange{Actor: actorFromContext(ctx), Reason: "order created"}); err != nil {
+		slog.ErrorContext(ctx, "Error creating order", "error", err)
+		return nil, internalError("failed to create order")
 	}
 
 	return &pb.CreateOrderResponse{
@@ -74,39 +114,73 @@ func (s *OrderServiceServer) CreateOrder(ctx context.Context, req *pb.CreateOrde
 }
 
 func (s *OrderServiceServer) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
-	log.Printf("Getting order with ID: %d", req.Id)
+	slog.InfoContext(ctx, "Getting order", "order_id", req.Id)
 
-	order, err := s.repo.GetByID(req.Id)
+	order, err := s.repo.GetByID(ctx, req.Id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Error(codes.NotFound, "order not found")
+			return nil, orderNotFound(req.Id)
 		}
-		log.Printf("Error getting order: %v", err)
-		return nil, status.Error(codes.Internal, "failed to get order")
+		slog.ErrorContext(ctx, "Error getting order", "error", err)
+		return nil, internalError("failed to get order")
+	}
+	if err := authorizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetHistory(ctx, order.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting order history", "error", err)
+		return nil, internalError("failed to get order history")
 	}
 
+	pbOrder := modelToProto(order)
+	pbOrder.History = historyToProto(history)
+
 	return &pb.GetOrderResponse{
-		Order: modelToProto(order),
+		Order: pbOrder,
 	}, nil
 }
 
 func (s *OrderServiceServer) UpdateOrderStatus(ctx context.Context, req *pb.UpdateOrderStatusRequest) (*pb.UpdateOrderStatusResponse, error) {
-	log.Printf("Updating order status: ID=%d, Status=%v", req.Id, req.Status)
+	slog.InfoContext(ctx, "Updating order status", "order_id", req.Id, "status", req.Status.String())
 
 	// Check if order exists
-	order, err := s.repo.GetByID(req.Id)
+	order, err := s.repo.GetByID(ctx, req.Id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Error(codes.NotFound, "order not found")
+			return nil, orderNotFound(req.Id)
 		}
-		return nil, status.Error(codes.Internal, "failed to get order")
+		return nil, internalError("failed to get order")
+	}
+	if req.Etag != "" && req.Etag != etag(order.Version) {
+		return nil, orderConflict(order.ID)
+	}
+
+	// Enforce the status state machine
+	newStatus := protoStatusToModel(req.Status)
+	if err := models.ValidateStatusTransition(order.Status, newStatus); err != nil {
+		return nil, invalidTransition(order.ID, err)
 	}
 
 	// Update status
-	order.Status = protoStatusToModel(req.Status)
-	if err := s.repo.Update(order); err != nil {
-		log.Printf("Error updating order status: %v", err)
-		return nil, status.Error(codes.Internal, "failed to update order status")
+	change := models.StatusChange{Actor: actorFromContext(ctx), Reason: req.Reason}
+	if err := s.repo.UpdateStatus(ctx, order.ID, order.Version, newStatus, change); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			return nil, orderConflict(order.ID)
+		}
+		var transitionErr *models.StatusTransitionError
+		if errors.As(err, &transitionErr) {
+			return nil, invalidTransition(order.ID, transitionErr)
+		}
+		slog.ErrorContext(ctx, "Error updating order status", "error", err)
+		return nil, internalError("failed to update order status")
+	}
+
+	order, err = s.repo.GetByID(ctx, order.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reloading order", "error", err)
+		return nil, internalError("failed to get order")
 	}
 
 	return &pb.UpdateOrderStatusResponse{
@@ -116,71 +190,138 @@ func (s *OrderServiceServer) UpdateOrderStatus(ctx context.Context, req *pb.Upda
 }
 
 func (s *OrderServiceServer) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
-	log.Printf("Listing orders: page=%d, limit=%d", req.Page, req.Limit)
+	slog.InfoContext(ctx, "Listing orders", "page", req.Page, "limit", req.Limit, "page_token", req.PageToken != "", "order_by", req.OrderBy)
 
-	orders, total, err := s.repo.List(req.Page, req.Limit)
+	filter, err := orderFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	query := listQuery(req)
+	page, size, err := listPage(s.pageTokens, req.Page, req.Limit, req.PageToken, query)
 	if err != nil {
-		log.Printf("Error listing orders: %v", err)
-		return nil, status.Error(codes.Internal, "failed to list orders")
+		return nil, err
 	}
 
-	pbOrders := make([]*pb.Order, len(orders))
-	for i, order := range orders {
-		pbOrders[i] = modelToProto(order)
+	orders, nextPageToken, err := s.listOrders(ctx, filter, page, size, query)
+	if err != nil {
+		return nil, err
 	}
 
-	return &pb.ListOrdersResponse{
-		Orders: pbOrders,
-		Total:  total,
-	}, nil
+	resp := &pb.ListOrdersResponse{Orders: orders, NextPageToken: nextPageToken}
+	if req.IncludeTotal {
+		if resp.Total, err = s.repo.Count(ctx, filter); err != nil {
+			slog.ErrorContext(ctx, "Error counting orders", "error", err)
+			return nil, internalError("failed to list orders")
+		}
+	}
+	return resp, nil
 }
 
 func (s *OrderServiceServer) GetUserOrders(ctx context.Context, req *pb.GetUserOrdersRequest) (*pb.GetUserOrdersResponse, error) {
-	log.Printf("Getting orders for user ID: %d", req.UserId)
+	slog.InfoContext(ctx, "Getting user orders", "user_id", req.UserId, "limit", req.Limit, "page_token", req.PageToken != "")
+
+	if err := authorizeUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	filter, err := userOrdersFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	query := userOrdersQuery(req)
+	page, size, err := listPage(s.pageTokens, 0, req.Limit, req.PageToken, query)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate user
 	isValid, _, err := s.userClient.ValidateUser(ctx, req.UserId)
 	if err != nil {
-		log.Printf("Error validating user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to validate user")
+		slog.ErrorContext(ctx, "Error validating user", "error", err)
+		return nil, userServiceError(err)
 	}
 
 	if !isValid {
-		return nil, status.Error(codes.NotFound, "user not found")
+		return nil, userNotFound(req.UserId)
+	}
+
+	orders, nextPageToken, err := s.listOrders(ctx, filter, page, size, query)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting user orders", "error", err)
+		return nil, internalError("failed to get user orders")
 	}
 
-	orders, err := s.repo.GetByUserID(req.UserId)
+	return &pb.GetUserOrdersResponse{
+		Orders:        orders,
+		Total:         total,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// listOrders reads a page of the orders matching filter, trimming the extra
+// row listPage asks for and returning a token for the next page if that row
+// was there.
+func (s *OrderServiceServer) listOrders(ctx context.Context, filter models.OrderFilter, page models.Page, size int32, query string) ([]*pb.Order, string, error) {
+	orders, err := s.repo.List(ctx, filter, page)
 	if err != nil {
-		log.Printf("Error getting user orders: %v", err)
-		return nil, status.Error(codes.Internal, "failed to get user orders")
+		slog.ErrorContext(ctx, "Error listing orders", "error", err)
+		return nil, "", internalError("failed to list orders")
+	}
+
+	var next string
+	if len(orders) > int(size) {
+		orders = orders[:size]
+		next, err = nextPageToken(s.pageTokens, filter.Cursor(orders[size-1]), query)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error creating page token", "error", err)
+			return nil, "", internalError("failed to list orders")
+		}
 	}
 
 	pbOrders := make([]*pb.Order, len(orders))
 	for i, order := range orders {
 		pbOrders[i] = modelToProto(order)
 	}
-
-	return &pb.GetUserOrdersResponse{
-		Orders: pbOrders,
-		Total:  int32(len(orders)),
-	}, nil
+	return pbOrders, next, nil
 }
 
 func (s *OrderServiceServer) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
-	log.Printf("Cancelling order with ID: %d", req.Id)
+	slog.InfoContext(ctx, "Cancelling order", "order_id", req.Id)
 
 	// Check if order exists
-	_, err := s.repo.GetByID(req.Id)
+	order, err := s.repo.GetByID(ctx, req.Id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Error(codes.NotFound, "order not found")
+			return nil, orderNotFound(req.Id)
 		}
-		return nil, status.Error(codes.Internal, "failed to get order")
+		return nil, internalError("failed to get order")
+	}
+	if err := authorizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	if req.Etag != "" && req.Etag != etag(order.Version) {
+		return nil, orderConflict(order.ID)
+	}
+
+	// Cancellation follows the same status rules as UpdateOrderStatus
+	if err := models.ValidateStatusTransition(order.Status, models.OrderStatusCancelled); err != nil {
+		return nil, invalidTransition(order.ID, err)
 	}
 
-	if err := s.repo.Cancel(req.Id); err != nil {
-		log.Printf("Error cancelling order: %v", err)
-		return nil, status.Error(codes.Internal, "failed to cancel order")
+	change := models.StatusChange{Actor: actorFromContext(ctx), Reason: req.Reason}
+	if err := s.repo.Cancel(ctx, req.Id, order.Version, change); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			return nil, orderConflict(order.ID)
+		}
+		var transitionErr *models.StatusTransitionError
+		if errors.As(err, &transitionErr) {
+			return nil, invalidTransition(order.ID, transitionErr)
+		}
+		slog.ErrorContext(ctx, "Error cancelling order", "error", err)
+		return nil, internalError("failed to cancel order")
 	}
 
 	return &pb.CancelOrderResponse{
@@ -189,6 +330,149 @@ func (s *OrderServiceServer) CancelOrder(ctx context.Context, req *pb.CancelOrde
 	}, nil
 }
 
+func (s *OrderServiceServer) GetOrderHistory(ctx context.Context, req *pb.GetOrderHistoryRequest) (*pb.GetOrderHistoryResponse, error) {
+	slog.InfoContext(ctx, "Getting order status history", "order_id", req.OrderId)
+
+	// Check if order exists
+	order, err := s.repo.GetByID(ctx, req.OrderId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, orderNotFound(req.OrderId)
+		}
+		return nil, internalError("failed to get order")
+	}
+	if err := authorizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetHistory(ctx, req.OrderId)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting order history", "error", err)
+		return nil, internalError("failed to get order history")
+	}
+
+	return &pb.GetOrderHistoryResponse{
+		History: historyToProto(history),
+	}, nil
+}
+
+// itemsFromProto converts the requested items to models and sums the order
+// total with exact arithmetic. All items must share a single currency.
+func itemsFromProto(reqItems []*pb.OrderItem) ([]*models.OrderItem, models.Money, error) {
+	if len(reqItems) == 0 {
+		return nil, models.Money{}, rpcerror.InvalidArgument(reasonInvalidFields, "at least one item is required",
+			rpcerror.FieldViolation("items", "at least one item is required"))
+	}
+
+	var totalAmount models.Money
+	items := make([]*models.OrderItem, len(reqItems))
+	for i, item := range reqItems {
+		if item.ProductName == "" {
+			return nil, models.Money{}, invalidItem(i, "product_name", "is required")
+		}
+		if item.Quantity <= 0 {
+			return nil, models.Money{}, invalidItem(i, "quantity", "must be positive")
+		}
+		if item.Price == nil {
+			return nil, models.Money{}, invalidItem(i, "price", "is required")
+		}
+
+		price, err := models.NewMoney(item.Price.CurrencyCode, item.Price.Units, item.Price.Nanos)
+		if err != nil {
+			return nil, models.Money{}, invalidItem(i, "price", err.Error())
+		}
+		if price.Minor < 0 {
+			return nil, models.Money{}, invalidItem(i, "price", "must not be negative")
+		}
+		if !price.Storable() {
+			return nil, models.Money{}, invalidItem(i, "price", fmt.Sprintf("must not exceed %s", models.MaxStoredAmount(price.Currency)))
+		}
+
+		lineTotal, err := price.Mul(item.Quantity)
+		if err != nil {
+			return nil, models.Money{}, invalidItem(i, "quantity", err.Error())
+		}
+		if i == 0 {
+			totalAmount = models.Money{Currency: price.Currency}
+		}
+		sum, err := totalAmount.Add(lineTotal)
+		if err != nil {
+			if errors.Is(err, models.ErrCurrencyMismatch) {
+				return nil, models.Money{}, invalidItem(i, "price.currency_code",
+					fmt.Sprintf("must match the other items (%s)", totalAmount.Currency))
+			}
+			return nil, models.Money{}, invalidItem(i, "price", err.Error())
+		}
+		totalAmount = sum
+		if !totalAmount.Storable() {
+			description := fmt.Sprintf("must not add up to more than %s", models.MaxStoredAmount(totalAmount.Currency))
+			return nil, models.Money{}, rpcerror.InvalidArgument(reasonInvalidFields, "items "+description,
+				rpcerror.FieldViolation("items", description))
+		}
+
+		items[i] = &models.OrderItem{
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			Price:       price,
+		}
+	}
+
+	return items, totalAmount, nil
+}
+
+func moneyToProto(m models.Money) *pb.Money {
+	return &pb.Money{
+		CurrencyCode: m.Currency,
+		Units:        m.Units(),
+		Nanos:        m.Nanos(),
+	}
+}
+
+// userServiceError maps a failed User Service call to the status returned to
+// our own callers, surfacing outages as codes.Unavailable so they can retry,
+// after the delay the User Service or circuit breaker asked for if any.
+func userServiceError(err error) error {
+	details := rpcerror.Decode(err)
+	switch details.Code {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		retryAfter := userServiceRetryDelay
+		if details.HasRetryInfo {
+			retryAfter = details.RetryDelay
+		}
+		return rpcerror.Unavailable(reasonUserServiceUnavailable, "user service is unavailable", retryAfter)
+	default:
+		return internalError("failed to validate user")
+	}
+}
+
+// actorFromContext returns the caller identity to record in the status
+// history, as established by the authentication interceptor.
+func actorFromContext(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return id.String()
+	}
+	return defaultActor
+}
+
+func historyToProto(history []*models.OrderStatusHistory) []*pb.OrderStatusChange {
+	changes := make([]*pb.OrderStatusChange, len(history))
+	for i, entry := range history {
+		changes[i] = &pb.OrderStatusChange{
+			Id:        entry.ID,
+			OrderId:   entry.OrderID,
+			NewStatus: modelStatusToProto(entry.NewStatus),
+			Actor:     entry.Actor,
+			Reason:    entry.Reason,
+			CreatedAt: entry.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		if entry.OldStatus != "" {
+			oldStatus := modelStatusToProto(entry.OldStatus)
+			changes[i].OldStatus = &oldStatus
+		}
+	}
+	return changes
+}
+
 func modelToProto(order *models.Order) *pb.Order {
 	items := make([]*pb.OrderItem, len(order.Items))
 	for i, item := range order.Items {
@@ -196,7 +480,7 @@ func modelToProto(order *models.Order) *pb.Order {
 			Id:          item.ID,
 			ProductName: item.ProductName,
 			Quantity:    item.Quantity,
-			Price:       item.Price,
+			Price:       moneyToProto(item.Price),
 		}
 	}
 
@@ -206,13 +490,20 @@ func modelToProto(order *models.Order) *pb.Order {
 		UserName:    order.UserName,
 		UserEmail:   order.UserEmail,
 		Items:       items,
-		TotalAmount: order.TotalAmount,
+		TotalAmount: moneyToProto(order.TotalAmount),
 		Status:      modelStatusToProto(order.Status),
 		CreatedAt:   order.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:   order.UpdatedAt.Format("2006-01-02 15:04:05"),
+		Etag:        etag(order.Version),
 	}
 }
 
+// etag renders a version as an opaque entity tag, quoted as in HTTP so
+// that the gateway can pass it through as an ETag header.
+func etag(version int32) string {
+	return strconv.Quote(strconv.Itoa(int(version)))
+}
+
 func modelStatusToProto(status models.OrderStatus) pb.OrderStatus {
 	switch status {
 	case models.OrderStatusPending:
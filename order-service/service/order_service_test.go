@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"order-service/auth"
+	"order-service/models"
+	pb "order-service/proto/order"
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeOrderRepository serves a single order with its history and records
+// cancellations.
+type fakeOrderRepository struct {
+	models.OrderRepository
+	order     *models.Order
+	err       error
+	history   []*models.OrderStatusHistory
+	cancelled bool
+	change    models.StatusChange
+}
+
+func (r *fakeOrderRepository) GetByID(ctx context.Context, id int32) (*models.Order, error) {
+	return r.order, r.err
+}
+
+func (r *fakeOrderRepository) Cancel(ctx context.Context, id, version int32, change models.StatusChange) error {
+	if version != r.order.Version {
+		return models.ErrVersionConflict
+	}
+	r.cancelled = true
+	r.change = change
+	return nil
+}
+
+func (r *fakeOrderRepository) GetHistory(ctx context.Context, orderID int32) ([]*models.OrderStatusHistory, error) {
+	return r.history, nil
+}
+
+func TestCancelOrder(t *testing.T) {
+	for _, tc := range []struct {
+		status models.OrderStatus
+		code   codes.Code
+	}{
+		{models.OrderStatusPending, codes.OK},
+		{models.OrderStatusProcessing, codes.OK},
+		{models.OrderStatusShipped, codes.FailedPrecondition},
+		{models.OrderStatusDelivered, codes.FailedPrecondition},
+		{models.OrderStatusCancelled, codes.FailedPrecondition},
+	} {
+		t.Run(string(tc.status), func(t *testing.T) {
+			repo := &fakeOrderRepository{order: &models.Order{ID: 7, UserID: 1, Status: tc.status, Version: 1}}
+			s := &OrderServiceServer{repo: repo}
+			ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+			_, err := s.CancelOrder(ctx, &pb.CancelOrderRequest{Id: 7})
+			if got := status.Code(err); got != tc.code {
+				t.Fatalf("CancelOrder code = %v, want %v (%v)", got, tc.code, err)
+			}
+			if repo.cancelled != (tc.code == codes.OK) {
+				t.Errorf("cancelled = %v", repo.cancelled)
+			}
+			if tc.code != codes.OK {
+				if reason := rpcerror.Reason(err); reason != reasonInvalidStatusTransition {
+					t.Errorf("reason = %q, want %q", reason, reasonInvalidStatusTransition)
+				}
+			}
+		})
+	}
+}
+
+func TestOtherUsersOrderIsNotFound(t *testing.T) {
+	order := &models.Order{ID: 7, UserID: 1, Status: models.OrderStatusPending, Version: 1}
+	stranger := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 2, Role: auth.RoleCustomer})
+
+	for _, tc := range []struct {
+		name string
+		call func(s *OrderServiceServer) error
+	}{
+		{"GetOrder", func(s *OrderServiceServer) error {
+			_, err := s.GetOrder(stranger, &pb.GetOrderRequest{Id: 7})
+			return err
+		}},
+		{"CancelOrder", func(s *OrderServiceServer) error {
+			_, err := s.CancelOrder(stranger, &pb.CancelOrderRequest{Id: 7})
+			return err
+		}},
+		{"GetOrderHistory", func(s *OrderServiceServer) error {
+			_, err := s.GetOrderHistory(stranger, &pb.GetOrderHistoryRequest{OrderId: 7})
+			return err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeOrderRepository{order: order}
+			foreign := tc.call(&OrderServiceServer{repo: repo})
+			missing := tc.call(&OrderServiceServer{repo: &fakeOrderRepository{err: sql.ErrNoRows}})
+
+			if status.Code(foreign) != codes.NotFound || rpcerror.Reason(foreign) != reasonOrderNotFound {
+				t.Fatalf("%s of another user's order = %v, want NotFound", tc.name, foreign)
+			}
+			if status.Convert(foreign).Message() != status.Convert(missing).Message() {
+				t.Errorf("message %q differs from a missing order's %q", status.Convert(foreign).Message(), status.Convert(missing).Message())
+			}
+			if repo.cancelled {
+				t.Error("another user's order was cancelled")
+			}
+		})
+	}
+}
+
+func TestCancelOrderVersionConflict(t *testing.T) {
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+	for _, tc := range []struct {
+		name    string
+		version int32 // of the stored order when Cancel runs
+		etag    string
+	}{
+		{"stale etag", 2, `"1"`},
+		{"changed after it was read", 3, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &stalingOrderRepository{fakeOrderRepository{order: &models.Order{ID: 7, UserID: 1, Status: models.OrderStatusPending, Version: 2}}, tc.version}
+			s := &OrderServiceServer{repo: repo}
+
+			_, err := s.CancelOrder(ctx, &pb.CancelOrderRequest{Id: 7, Etag: tc.etag})
+			if status.Code(err) != codes.Aborted || rpcerror.Reason(err) != reasonVersionConflict {
+				t.Fatalf("CancelOrder = %v, want Aborted with reason %s", err, reasonVersionConflict)
+			}
+			if repo.cancelled {
+				t.Error("order was cancelled despite the conflict")
+			}
+		})
+	}
+}
+
+// stalingOrderRepository moves the order to version between GetByID and
+// Cancel, as a concurrent update would.
+type stalingOrderRepository struct {
+	fakeOrderRepository
+	version int32
+}
+
+func (r *stalingOrderRepository) Cancel(ctx context.Context, id, version int32, change models.StatusChange) error {
+	order := *r.order
+	order.Version = r.version
+	r.order = &order
+	return r.fakeOrderRepository.Cancel(ctx, id, version, change)
+}
+
+func TestCancelOrderRecordsActorAndReason(t *testing.T) {
+	repo := &fakeOrderRepository{order: &models.Order{ID: 7, UserID: 1, Status: models.OrderStatusPending}}
+	s := &OrderServiceServer{repo: repo}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 42, Role: auth.RoleAdmin})
+
+	if _, err := s.CancelOrder(ctx, &pb.CancelOrderRequest{Id: 7, Reason: "customer request"}); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if want := (models.StatusChange{Actor: "user:42", Reason: "customer request"}); repo.change != want {
+		t.Errorf("change = %+v, want %+v", repo.change, want)
+	}
+
+	if got := actorFromContext(context.Background()); got != defaultActor {
+		t.Errorf("actor without an identity = %q, want %q", got, defaultActor)
+	}
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := &fakeOrderRepository{
+		order: &models.Order{ID: 7, UserID: 1, Status: models.OrderStatusProcessing},
+		history: []*models.OrderStatusHistory{
+			{ID: 1, OrderID: 7, NewStatus: models.OrderStatusPending, Actor: "alice", Reason: "order created", CreatedAt: created},
+			{ID: 2, OrderID: 7, OldStatus: models.OrderStatusPending, NewStatus: models.OrderStatusProcessing, Actor: "warehouse", CreatedAt: created.Add(time.Hour)},
+		},
+	}
+	s := &OrderServiceServer{repo: repo}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+	resp, err := s.GetOrderHistory(ctx, &pb.GetOrderHistoryRequest{OrderId: 7})
+	if err != nil {
+		t.Fatalf("GetOrderHistory: %v", err)
+	}
+	if len(resp.History) != 2 {
+		t.Fatalf("got %d history entries, want 2", len(resp.History))
+	}
+
+	first, second := resp.History[0], resp.History[1]
+	if first.OldStatus != nil {
+		t.Errorf("creation entry old_status = %v, want unset", first.GetOldStatus())
+	}
+	if first.NewStatus != pb.OrderStatus_PENDING || first.Actor != "alice" || first.Reason != "order created" {
+		t.Errorf("creation entry = %v", first)
+	}
+	if second.GetOldStatus() != pb.OrderStatus_PENDING || second.NewStatus != pb.OrderStatus_PROCESSING {
+		t.Errorf("second entry moves %v to %v, want PENDING to PROCESSING", second.GetOldStatus(), second.NewStatus)
+	}
+	if second.CreatedAt != "2024-01-01 13:00:00" {
+		t.Errorf("created_at = %q", second.CreatedAt)
+	}
+}
+
+func TestCancelOrderDatabaseFailure(t *testing.T) {
+	s := &OrderServiceServer{repo: &fakeOrderRepository{err: errors.New("connection refused")}}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+	_, err := s.CancelOrder(ctx, &pb.CancelOrderRequest{Id: 7})
+	if status.Code(err) != codes.Internal || rpcerror.Reason(err) != reasonInternal {
+		t.Fatalf("CancelOrder = %v, want Internal with reason %s", err, reasonInternal)
+	}
+	if strings.Contains(status.Convert(err).Message(), "connection refused") {
+		t.Error("database error leaked to the client")
+	}
+}
+
+func TestItemsFromProto(t *testing.T) {
+	usd := func(units int64, nanos int32) *pb.Money {
+		return &pb.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}
+	}
+
+	items, total, err := itemsFromProto([]*pb.OrderItem{
+		{ProductName: "Widget", Quantity: 3, Price: usd(19, 990_000_000)},
+		{ProductName: "Gadget", Quantity: 1, Price: usd(5, 0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || total != (models.Money{Currency: "USD", Minor: 6497}) {
+		t.Errorf("got %d items totalling %v, want 2 totalling 64.97 USD", len(items), total)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		items []*pb.OrderItem
+		field string
+	}{
+		{"no items", nil, "items"},
+		{"mixed currencies", []*pb.OrderItem{
+			{ProductName: "Widget", Quantity: 1, Price: usd(1, 0)},
+			{ProductName: "Gadget", Quantity: 1, Price: &pb.Money{CurrencyCode: "EUR", Units: 1}},
+		}, "items[1].price.currency_code"},
+		{"sub-cent price", []*pb.OrderItem{
+			{ProductName: "Widget", Quantity: 1, Price: usd(0, 1)},
+		}, "items[0].price"},
+		{"negative price", []*pb.OrderItem{
+			{ProductName: "Widget", Quantity: 1, Price: usd(-1, 0)},
+		}, "items[0].price"},
+		{"price too large to store", []*pb.OrderItem{
+			{ProductName: "Widget", Quantity: 1, Price: usd(100_000_000, 0)},
+		}, "items[0].price"},
+		{"total too large to store", []*pb.OrderItem{
+			{ProductName: "Widget", Quantity: 1, Price: usd(99_999_999, 990_000_000)},
+			{ProductName: "Gadget", Quantity: 1, Price: usd(0, 10_000_000)},
+		}, "items"},
+		{"line total overflow", []*pb.OrderItem{
+			{ProductName: "Widget", Quantity: math.MaxInt32, Price: usd(99_999_999, 0)},
+		}, "items[0].quantity"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := itemsFromProto(tc.items)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("code = %v, want InvalidArgument (%v)", status.Code(err), err)
+			}
+			violations := rpcerror.Decode(err).FieldViolations
+			if len(violations) != 1 || violations[0].Field != tc.field {
+				t.Errorf("violations = %v, want one for %s", violations, tc.field)
+			}
+		})
+	}
+}
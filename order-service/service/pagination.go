@@ -0,0 +1,94 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+
+	"order-service/models"
+	"order-service/pagetoken"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Page sizes for list methods. Larger requests are reduced to maxPageSize
+// rather than rejected, as AIP-158 recommends.
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// pageToken is the content of a page token. Query fingerprints the method,
+// filters and sort order of the request, which must not change between
+// pages.
+type pageToken struct {
+	After models.PageCursor `json:"a"`
+	Query string            `json:"q"`
+}
+
+// listPage turns the paging fields of a list request into the page to read
+// and the number of rows to return. The page asks for one extra row so that
+// the caller can tell whether another page follows.
+func listPage(codec *pagetoken.Codec, pageNumber, limit int32, token, query string) (models.Page, int32, error) {
+	if limit < 0 {
+		return models.Page{}, 0, invalidField("limit", "must not be negative")
+	}
+	if pageNumber < 0 {
+		return models.Page{}, 0, invalidField("page", "must not be negative")
+	}
+	if pageNumber > 1 && token != "" {
+		return models.Page{}, 0, invalidField("page", "cannot be combined with page_token")
+	}
+	var after *models.PageCursor
+	if token != "" {
+		var decoded pageToken
+		err := codec.Decode(token, &decoded)
+		if errors.Is(err, pagetoken.ErrExpired) {
+			return models.Page{}, 0, invalidField("page_token", "has expired; list again from the first page")
+		}
+		if err != nil || decoded.Query != query {
+			return models.Page{}, 0, invalidField("page_token", "is not a token returned by this method for the same filters and order")
+		}
+		after = &decoded.After
+	}
+
+	size := pageSize(limit)
+	page := models.Page{After: after, Limit: size + 1}
+	if pageNumber > 1 {
+		offset := int64(pageNumber-1) * int64(size)
+		if offset > math.MaxInt32 {
+			return models.Page{}, 0, invalidField("page", "is beyond the last page that can be listed; use page_token")
+		}
+		page.Offset = int32(offset)
+	}
+	return page, size, nil
+}
+
+// nextPageToken returns the token for the page after the row at after.
+func nextPageToken(codec *pagetoken.Codec, after models.PageCursor, query string) (string, error) {
+	return codec.Encode(pageToken{After: after, Query: query})
+}
+
+// pageSize returns the number of rows to return for a requested limit.
+func pageSize(limit int32) int32 {
+	switch {
+	case limit == 0:
+		return defaultPageSize
+	case limit > maxPageSize:
+		return maxPageSize
+	default:
+		return limit
+	}
+}
+
+// fingerprint hashes a request message with its paging fields cleared. The
+// message name is included so that tokens issued by one method are not
+// accepted by another.
+func fingerprint(query proto.Message) string {
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(query)
+	hash := sha256.New()
+	hash.Write([]byte(query.ProtoReflect().Descriptor().FullName()))
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
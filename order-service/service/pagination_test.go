@@ -0,0 +1,126 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"order-service/models"
+	"order-service/pagetoken"
+	pb "order-service/proto/order"
+	"order-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestListPageToken(t *testing.T) {
+	codec := pagetoken.NewCodec([]byte("secret"), time.Hour)
+	req := &pb.ListOrdersRequest{Limit: 5, Statuses: []pb.OrderStatus{pb.OrderStatus_PENDING}}
+	after := models.PageCursor{Key: "2026-01-02T03:04:05Z", ID: 42}
+
+	token, err := nextPageToken(codec, after, listQuery(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &pb.ListOrdersRequest{Limit: 20, PageToken: token, IncludeTotal: true, Statuses: req.Statuses}
+	page, size, err := listPage(codec, 0, next.Limit, token, listQuery(next))
+	if err != nil {
+		t.Fatalf("listPage rejected its own token: %v", err)
+	}
+	if size != 20 || page.Limit != 21 || page.After == nil || *page.After != after {
+		t.Errorf("listPage = %+v, %d", page, size)
+	}
+}
+
+func TestListPageRejectsForeignTokens(t *testing.T) {
+	codec := pagetoken.NewCodec([]byte("secret"), time.Hour)
+	req := &pb.ListOrdersRequest{UserId: 1}
+	after := models.PageCursor{ID: 42}
+
+	encode := func(codec *pagetoken.Codec, query string) string {
+		token, err := nextPageToken(codec, after, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for name, token := range map[string]string{
+		"GetUserOrders token": encode(codec, userOrdersQuery(&pb.GetUserOrdersRequest{UserId: 1})),
+		"other filters":       encode(codec, listQuery(&pb.ListOrdersRequest{UserId: 2})),
+		"other key":           encode(pagetoken.NewCodec([]byte("other"), time.Hour), listQuery(req)),
+		"garbage":             "not-a-token",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := listPage(codec, 0, 0, token, listQuery(req))
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("listPage = %v, want InvalidArgument", err)
+			}
+			if violations := rpcerror.Decode(err).FieldViolations; len(violations) != 1 || violations[0].Field != "page_token" {
+				t.Errorf("violations = %+v, want page_token", violations)
+			}
+		})
+	}
+}
+
+func TestListPageSize(t *testing.T) {
+	for _, tc := range []struct {
+		limit, size int32
+	}{
+		{0, defaultPageSize},
+		{1, 1},
+		{maxPageSize, maxPageSize},
+		{maxPageSize + 1, maxPageSize},
+	} {
+		page, size, err := listPage(nil, 0, tc.limit, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != tc.size || page.Limit != tc.size+1 {
+			t.Errorf("limit %d: size %d, page limit %d; want %d", tc.limit, size, page.Limit, tc.size)
+		}
+	}
+	if _, _, err := listPage(nil, 0, -1, "", ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("negative limit = %v, want InvalidArgument", err)
+	}
+	if _, _, err := listPage(nil, 2, 0, "token", ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("page with page_token = %v, want InvalidArgument", err)
+	}
+}
+
+func TestListPageOffset(t *testing.T) {
+	lastPage := int32(math.MaxInt32/maxPageSize + 1)
+	for _, tc := range []struct {
+		page, limit, offset int32
+	}{
+		{0, 10, 0},
+		{1, 10, 0},
+		{2, 10, 10},
+		{3, 0, 2 * defaultPageSize},
+		{lastPage, maxPageSize, (lastPage - 1) * maxPageSize},
+	} {
+		page, _, err := listPage(nil, tc.page, tc.limit, "", "")
+		if err != nil {
+			t.Errorf("page %d of %d: %v", tc.page, tc.limit, err)
+			continue
+		}
+		if page.Offset != tc.offset {
+			t.Errorf("page %d of %d: offset %d, want %d", tc.page, tc.limit, page.Offset, tc.offset)
+		}
+	}
+
+	for _, tc := range []struct {
+		page, limit int32
+	}{
+		{-1, 10},
+		{lastPage + 1, maxPageSize},
+		{math.MaxInt32, maxPageSize},
+		{math.MaxInt32, 0},
+	} {
+		_, _, err := listPage(nil, tc.page, tc.limit, "", "")
+		if violations := rpcerror.Decode(err).FieldViolations; status.Code(err) != codes.InvalidArgument || len(violations) != 1 || violations[0].Field != "page" {
+			t.Errorf("page %d of %d = %v, want InvalidArgument on page", tc.page, tc.limit, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+
+	"order-service/auth"
+	"order-service/models"
+	pb "order-service/proto/order"
+	"order-service/rpcerror"
+)
+
+var (
+	customers = auth.RoleCustomer
+	admins    = auth.RoleAdmin
+)
+
+// AccessPolicy lists the roles allowed to call each OrderService method.
+// Customers are further limited to their own orders by authorizeUser and
+// authorizeOrder.
+var AccessPolicy = auth.Policy{
+	pb.OrderService_CreateOrder_FullMethodName:       {customers, admins},
+	pb.OrderService_GetOrder_FullMethodName:          {customers, admins},
+	pb.OrderService_UpdateOrderStatus_FullMethodName: {admins},
+	pb.OrderService_ListOrders_FullMethodName:        {admins},
+	pb.OrderService_GetUserOrders_FullMethodName:     {customers, admins},
+	pb.OrderService_CancelOrder_FullMethodName:       {customers, admins},
+	pb.OrderService_GetOrderHistory_FullMethodName:   {customers, admins},
+}
+
+// authorizeUser checks that the caller may act on orders belonging to
+// userID: customers only on their own, admins on anyone's.
+func authorizeUser(ctx context.Context, userID int32) error {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return rpcerror.PermissionDenied(reasonAuthenticationRequired, "authentication required")
+	}
+	if id.Role == auth.RoleAdmin || id.UserID == userID {
+		return nil
+	}
+	return rpcerror.PermissionDenied(reasonNotOrderOwner, "not allowed to access another user's orders")
+}
+
+// authorizeOrder checks that the caller may act on order. Customers get the
+// same NOT_FOUND for other users' orders as for missing ones, so that they
+// cannot probe which order IDs exist.
+func authorizeOrder(ctx context.Context, order *models.Order) error {
+	err := authorizeUser(ctx, order.UserID)
+	if rpcerror.Reason(err) == reasonNotOrderOwner {
+		return orderNotFound(order.ID)
+	}
+	return err
+}
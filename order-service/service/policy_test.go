@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"order-service/auth"
+	pb "order-service/proto/order"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessPolicyCoversEveryMethod(t *testing.T) {
+	// The roles allowed to call each method; adding an RPC without
+	// deciding who may call it fails this test
+	want := map[string][]auth.Role{
+		pb.OrderService_CreateOrder_FullMethodName:       {auth.RoleCustomer, auth.RoleAdmin},
+		pb.OrderService_GetOrder_FullMethodName:          {auth.RoleCustomer, auth.RoleAdmin},
+		pb.OrderService_UpdateOrderStatus_FullMethodName: {auth.RoleAdmin},
+		pb.OrderService_ListOrders_FullMethodName:        {auth.RoleAdmin},
+		pb.OrderService_GetUserOrders_FullMethodName:     {auth.RoleCustomer, auth.RoleAdmin},
+		pb.OrderService_CancelOrder_FullMethodName:       {auth.RoleCustomer, auth.RoleAdmin},
+		pb.OrderService_GetOrderHistory_FullMethodName:   {auth.RoleCustomer, auth.RoleAdmin},
+	}
+
+	desc := pb.OrderService_ServiceDesc
+	methods := make(map[string]bool)
+	for _, method := range desc.Methods {
+		methods["/"+desc.ServiceName+"/"+method.MethodName] = true
+	}
+	for _, stream := range desc.Streams {
+		methods["/"+desc.ServiceName+"/"+stream.StreamName] = true
+	}
+
+	for method := range methods {
+		roles, ok := AccessPolicy[method]
+		if !ok {
+			t.Errorf("%s has no entry in AccessPolicy", method)
+			continue
+		}
+		if fmt.Sprint(roles) != fmt.Sprint(want[method]) {
+			t.Errorf("%s is allowed for %v, want %v", method, roles, want[method])
+		}
+	}
+	for method := range AccessPolicy {
+		if !methods[method] {
+			t.Errorf("AccessPolicy lists %s, which is not a method of OrderService", method)
+		}
+	}
+}
+
+func TestAccessPolicyDeniesCustomersAdminMethods(t *testing.T) {
+	customer := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+	admin := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 2, Role: auth.RoleAdmin})
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+
+	for _, method := range []string{
+		pb.OrderService_UpdateOrderStatus_FullMethodName,
+		pb.OrderService_ListOrders_FullMethodName,
+	} {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		if _, err := AccessPolicy.UnaryServerInterceptor(customer, nil, info, handler); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("customer calling %s: %v, want PermissionDenied", method, err)
+		}
+		if _, err := AccessPolicy.UnaryServerInterceptor(admin, nil, info, handler); err != nil {
+			t.Errorf("admin calling %s: %v", method, err)
+		}
+	}
+}
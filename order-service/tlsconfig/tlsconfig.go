@@ -0,0 +1,186 @@
+// Package tlsconfig builds gRPC transport credentials from PEM files.
+// Certificates and keys are re-read when the files change, so rotated
+// certificates are picked up without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config names the files used for TLS. Without Enabled, connections are
+// plaintext.
+type Config struct {
+	Enabled bool
+
+	CertFile string
+	KeyFile  string
+
+	// CAFile verifies the peer. On a server it verifies client
+	// certificates, enabling mutual TLS; on a client it verifies the
+	// server, and the system roots are used if it is empty.
+	CAFile string
+
+	// RequireClientCert rejects clients that do not present a valid
+	// certificate, rather than only verifying those that do. Servers only.
+	RequireClientCert bool
+
+	// ServerName overrides the name the server's certificate is checked
+	// against. Clients only.
+	ServerName string
+
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval time.Duration
+}
+
+// ServerConfigFromEnv reads TLS_CERT_FILE, TLS_KEY_FILE,
+// TLS_CLIENT_CA_FILE, TLS_REQUIRE_CLIENT_CERT and TLS_RELOAD_INTERVAL. TLS
+// is enabled when a certificate or key is configured.
+func ServerConfigFromEnv() Config {
+	cfg := Config{
+		CertFile:          os.Getenv("TLS_CERT_FILE"),
+		KeyFile:           os.Getenv("TLS_KEY_FILE"),
+		CAFile:            os.Getenv("TLS_CLIENT_CA_FILE"),
+		RequireClientCert: getEnvBool("TLS_REQUIRE_CLIENT_CERT", false),
+		ReloadInterval:    getEnvDuration("TLS_RELOAD_INTERVAL", time.Minute),
+	}
+	cfg.Enabled = cfg.CertFile != "" || cfg.KeyFile != ""
+	return cfg
+}
+
+// ClientConfigFromEnv reads the settings for calling another service from
+// variables starting with prefix: <prefix>TLS, <prefix>TLS_CA_FILE,
+// <prefix>TLS_CERT_FILE, <prefix>TLS_KEY_FILE and
+// <prefix>TLS_SERVER_NAME. TLS is enabled by default when a CA or client
+// certificate is configured.
+func ClientConfigFromEnv(prefix string) Config {
+	cfg := Config{
+		CAFile:         os.Getenv(prefix + "TLS_CA_FILE"),
+		CertFile:       os.Getenv(prefix + "TLS_CERT_FILE"),
+		KeyFile:        os.Getenv(prefix + "TLS_KEY_FILE"),
+		ServerName:     os.Getenv(prefix + "TLS_SERVER_NAME"),
+		ReloadInterval: getEnvDuration("TLS_RELOAD_INTERVAL", time.Minute),
+	}
+	cfg.Enabled = getEnvBool(prefix+"TLS", cfg.CAFile != "" || cfg.CertFile != "")
+	return cfg
+}
+
+// ServerCredentials returns the transport credentials for a gRPC server.
+// When a client CA is configured, client certificates are verified against
+// it and the verified chain is available to handlers through peer.Peer.
+func ServerCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("TLS needs both a certificate and a key file")
+	}
+	if cfg.RequireClientCert && cfg.CAFile == "" {
+		return nil, errors.New("requiring client certificates needs a client CA file")
+	}
+
+	keyPair, err := newKeyPairReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return keyPair.get(), nil
+		},
+	}
+
+	if cfg.CAFile != "" {
+		clientCAs, err := newCertPoolReloader(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clientAuth := tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		// The client CA pool can only be swapped per handshake
+		base := tlsConfig.Clone()
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := base.Clone()
+			config.ClientAuth = clientAuth
+			config.ClientCAs = clientCAs.get()
+			return config, nil
+		}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// ClientCredentials returns the transport credentials for calling a gRPC
+// server. The client certificate is reloaded when it changes; the CA file
+// is read once.
+func ClientCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		keyPair, err := newKeyPairReloader(cfg)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return keyPair.get(), nil
+		}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// LoopbackCredentials returns credentials for probing a server configured
+// with cfg on localhost, as the container health check does. The server's
+// certificate is not verified, since it need not name localhost; the
+// server's own key pair is presented in case client certificates are
+// required.
+func LoopbackCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{cert},
+	}), nil
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Init installs the global TracerProvider and W3C trace-context propagator.
+// The exporter is chosen by OTEL_TRACES_EXPORTER:
+//
+//	otlp   - OTLP/gRPC, configured by the standard OTEL_EXPORTER_OTLP_* variables
+//	stdout - pretty-printed spans on stdout
+//	file   - one JSON span per line appended to OTEL_TRACES_FILE
+//	none   - no export (default); trace context is still propagated
+//
+// The returned function flushes and stops the provider.
+func Init(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %v", err)
+	}
+
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	var closer io.Closer
+
+	exporterName := getEnv("OTEL_TRACES_EXPORTER", "none")
+	switch exporterName {
+	case "otlp":
+		exporter, err := otlptracegrpc.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creating OTLP exporter: %v", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("error creating stdout exporter: %v", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case "file":
+		path := getEnv("OTEL_TRACES_FILE", serviceName+"-traces.json")
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening trace file: %v", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error creating file exporter: %v", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+		closer = file
+	case "none", "":
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", exporterName)
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	slog.Info("Tracing initialised", "exporter", exporterName)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
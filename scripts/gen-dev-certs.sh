@@ -0,0 +1,60 @@
+#!/bin/bash
+
+# Development Certificate Script
+# Generates a local CA and certificates for running the services with TLS
+# and mutual TLS under docker-compose (see docker-compose.tls.yml).
+# Do not use these certificates in production.
+
+set -e
+
+CERT_DIR=${CERT_DIR:-certs}
+DAYS=${DAYS:-365}
+
+# Colors
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+RED='\033[0;31m'
+NC='\033[0m'
+
+if ! command -v openssl &> /dev/null; then
+    echo -e "${RED}Error: openssl is not installed${NC}"
+    exit 1
+fi
+
+mkdir -p "$CERT_DIR"
+cd "$CERT_DIR"
+
+if [ ! -f ca.pem ]; then
+    echo -e "${YELLOW}Creating development CA...${NC}"
+    openssl ecparam -name prime256v1 -genkey -noout -out ca-key.pem
+    openssl req -x509 -new -key ca-key.pem -sha256 -days "$DAYS" \
+        -subj "/CN=grpc-microservices dev CA" -out ca.pem
+else
+    echo -e "${YELLOW}Reusing existing CA in $CERT_DIR${NC}"
+fi
+
+# issue <name>: a certificate for <name> valid as both a server and a client
+# certificate, so each service can also call the others (and itself, for
+# the container health check) with it.
+issue() {
+    local name=$1
+    echo -e "${YELLOW}Issuing certificate for $name...${NC}"
+    openssl ecparam -name prime256v1 -genkey -noout -out "$name-key.pem"
+    openssl req -new -key "$name-key.pem" -subj "/CN=$name" -out "$name.csr"
+    openssl x509 -req -in "$name.csr" -CA ca.pem -CAkey ca-key.pem -CAcreateserial \
+        -days "$DAYS" -sha256 -out "$name.pem" -extfile <(printf '%s\n' \
+            "basicConstraints=CA:FALSE" \
+            "keyUsage=digitalSignature" \
+            "extendedKeyUsage=serverAuth,clientAuth" \
+            "subjectAltName=DNS:$name,DNS:localhost,IP:127.0.0.1")
+    rm -f "$name.csr"
+}
+
+issue user-service
+issue order-service
+issue api-gateway
+
+echo ""
+echo -e "${GREEN}Certificates written to $CERT_DIR${NC}"
+echo "Start the services with TLS using:"
+echo "  docker-compose -f docker-compose.yml -f docker-compose.tls.yml up --build"
@@ -10,6 +10,10 @@ echo.
 REM Configuration
 set USER_SERVICE_URL=localhost:50051
 set ORDER_SERVICE_URL=localhost:50052
+REM Admin created by user-service from INITIAL_ADMIN_EMAIL/INITIAL_ADMIN_PASSWORD
+if not defined ADMIN_EMAIL set ADMIN_EMAIL=admin@example.com
+if not defined ADMIN_PASSWORD set ADMIN_PASSWORD=dev-admin-password
+set TEST_PASSWORD=test-password-123
 
 REM Check if grpcurl is installed
 where grpcurl >nul 2>nul
@@ -18,70 +22,97 @@ if %ERRORLEVEL% NEQ 0 (
     echo Install it with: go install github.com/fullstorydev/grpcurl/cmd/grpcurl@latest
     exit /b 1
 )
+where jq >nul 2>nul
+if %ERRORLEVEL% NEQ 0 (
+    echo Error: jq is not installed
+    exit /b 1
+)
 
 echo Creating test users...
 echo.
 
 echo Creating User 1: Alice Johnson
-grpcurl -plaintext -d "{\"name\": \"Alice Johnson\", \"email\": \"alice.johnson@example.com\", \"phone\": \"+1-555-0101\", \"address\": \"123 Tech Street, San Francisco, CA 94102\"}" %USER_SERVICE_URL% user.UserService/CreateUser
+grpcurl -plaintext -d "{\"name\": \"Alice Johnson\", \"email\": \"alice.johnson@example.com\", \"phone\": \"+15555550101\", \"address\": \"123 Tech Street, San Francisco, CA 94102\", \"password\": \"%TEST_PASSWORD%\"}" %USER_SERVICE_URL% user.UserService/CreateUser
 echo.
 
 echo Creating User 2: Bob Smith
-grpcurl -plaintext -d "{\"name\": \"Bob Smith\", \"email\": \"bob.smith@example.com\", \"phone\": \"+1-555-0102\", \"address\": \"456 Innovation Avenue, New York, NY 10001\"}" %USER_SERVICE_URL% user.UserService/CreateUser
+grpcurl -plaintext -d "{\"name\": \"Bob Smith\", \"email\": \"bob.smith@example.com\", \"phone\": \"+15555550102\", \"address\": \"456 Innovation Avenue, New York, NY 10001\", \"password\": \"%TEST_PASSWORD%\"}" %USER_SERVICE_URL% user.UserService/CreateUser
 echo.
 
 echo Creating User 3: Carol White
-grpcurl -plaintext -d "{\"name\": \"Carol White\", \"email\": \"carol.white@example.com\", \"phone\": \"+1-555-0103\", \"address\": \"789 Developer Road, Austin, TX 73301\"}" %USER_SERVICE_URL% user.UserService/CreateUser
+grpcurl -plaintext -d "{\"name\": \"Carol White\", \"email\": \"carol.white@example.com\", \"phone\": \"+15555550103\", \"address\": \"789 Developer Road, Austin, TX 73301\", \"password\": \"%TEST_PASSWORD%\"}" %USER_SERVICE_URL% user.UserService/CreateUser
 echo.
 
 echo Creating User 4: David Brown
-grpcurl -plaintext -d "{\"name\": \"David Brown\", \"email\": \"david.brown@example.com\", \"phone\": \"+1-555-0104\", \"address\": \"321 Startup Lane, Seattle, WA 98101\"}" %USER_SERVICE_URL% user.UserService/CreateUser
+grpcurl -plaintext -d "{\"name\": \"David Brown\", \"email\": \"david.brown@example.com\", \"phone\": \"+15555550104\", \"address\": \"321 Startup Lane, Seattle, WA 98101\", \"password\": \"%TEST_PASSWORD%\"}" %USER_SERVICE_URL% user.UserService/CreateUser
 echo.
 
 echo Creating User 5: Emma Davis
-grpcurl -plaintext -d "{\"name\": \"Emma Davis\", \"email\": \"emma.davis@example.com\", \"phone\": \"+1-555-0105\", \"address\": \"654 Cloud Drive, Boston, MA 02101\"}" %USER_SERVICE_URL% user.UserService/CreateUser
+grpcurl -plaintext -d "{\"name\": \"Emma Davis\", \"email\": \"emma.davis@example.com\", \"phone\": \"+15555550105\", \"address\": \"654 Cloud Drive, Boston, MA 02101\", \"password\": \"%TEST_PASSWORD%\"}" %USER_SERVICE_URL% user.UserService/CreateUser
+echo.
+
+echo Logging in as %ADMIN_EMAIL%...
+grpcurl -plaintext -d "{\"email\": \"%ADMIN_EMAIL%\", \"password\": \"%ADMIN_PASSWORD%\"}" %USER_SERVICE_URL% user.UserService/Authenticate > "%TEMP%\admin-login.json"
+set ADMIN_TOKEN=
+for /f "usebackq delims=" %%t in (`jq -r ".tokens.accessToken // empty" "%TEMP%\admin-login.json"`) do set ADMIN_TOKEN=%%t
+del "%TEMP%\admin-login.json"
+if not defined ADMIN_TOKEN (
+    echo Error: could not log in as %ADMIN_EMAIL%; set ADMIN_EMAIL and ADMIN_PASSWORD
+    exit /b 1
+)
 echo.
 
+REM Orders are created as the admin, who may order on behalf of any user
 echo Creating test orders...
 echo.
 
 echo Creating Order 1 for Alice: Electronics
-grpcurl -plaintext -d "{\"user_id\": 1, \"items\": [{\"product_name\": \"MacBook Pro 16\"\"\", \"quantity\": 1, \"price\": 2499.99}, {\"product_name\": \"Magic Mouse\", \"quantity\": 1, \"price\": 79.99}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"user_id\": 1, \"items\": [{\"product_name\": \"MacBook Pro 16\"\"\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 2499, \"nanos\": 990000000}}, {\"product_name\": \"Magic Mouse\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 79, \"nanos\": 990000000}}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder > "%TEMP%\order.json"
+for /f "usebackq delims=" %%i in (`jq -r ".order.id" "%TEMP%\order.json"`) do set ORDER1_ID=%%i
+echo Created order %ORDER1_ID%
 echo.
 
 echo Creating Order 2 for Alice: Accessories
-grpcurl -plaintext -d "{\"user_id\": 1, \"items\": [{\"product_name\": \"USB-C Hub\", \"quantity\": 2, \"price\": 49.99}, {\"product_name\": \"Monitor Stand\", \"quantity\": 1, \"price\": 89.99}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"user_id\": 1, \"items\": [{\"product_name\": \"USB-C Hub\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 49, \"nanos\": 990000000}}, {\"product_name\": \"Monitor Stand\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 89, \"nanos\": 990000000}}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder > "%TEMP%\order.json"
+for /f "usebackq delims=" %%i in (`jq -r ".order.id" "%TEMP%\order.json"`) do set ORDER2_ID=%%i
+echo Created order %ORDER2_ID%
 echo.
 
 echo Creating Order 3 for Bob: Programming Books
-grpcurl -plaintext -d "{\"user_id\": 2, \"items\": [{\"product_name\": \"Clean Code\", \"quantity\": 1, \"price\": 45.99}, {\"product_name\": \"Design Patterns\", \"quantity\": 1, \"price\": 54.99}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"user_id\": 2, \"items\": [{\"product_name\": \"Clean Code\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 45, \"nanos\": 990000000}}, {\"product_name\": \"Design Patterns\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 54, \"nanos\": 990000000}}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder > "%TEMP%\order.json"
+for /f "usebackq delims=" %%i in (`jq -r ".order.id" "%TEMP%\order.json"`) do set ORDER3_ID=%%i
+echo Created order %ORDER3_ID%
 echo.
 
+del "%TEMP%\order.json"
+
 echo Creating Order 4 for Carol: Office Setup
-grpcurl -plaintext -d "{\"user_id\": 3, \"items\": [{\"product_name\": \"Ergonomic Chair\", \"quantity\": 1, \"price\": 399.99}, {\"product_name\": \"Standing Desk\", \"quantity\": 1, \"price\": 599.99}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"user_id\": 3, \"items\": [{\"product_name\": \"Ergonomic Chair\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 399, \"nanos\": 990000000}}, {\"product_name\": \"Standing Desk\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 599, \"nanos\": 990000000}}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
 echo.
 
 echo Creating Order 5 for David: Gaming Setup
-grpcurl -plaintext -d "{\"user_id\": 4, \"items\": [{\"product_name\": \"Gaming Monitor 27\"\"\", \"quantity\": 2, \"price\": 349.99}, {\"product_name\": \"Mechanical Keyboard RGB\", \"quantity\": 1, \"price\": 159.99}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"user_id\": 4, \"items\": [{\"product_name\": \"Gaming Monitor 27\"\"\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 349, \"nanos\": 990000000}}, {\"product_name\": \"Mechanical Keyboard RGB\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 159, \"nanos\": 990000000}}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
 echo.
 
 echo Creating Order 6 for Emma: Mobile Devices
-grpcurl -plaintext -d "{\"user_id\": 5, \"items\": [{\"product_name\": \"iPhone 15 Pro\", \"quantity\": 1, \"price\": 999.99}, {\"product_name\": \"AirPods Pro\", \"quantity\": 1, \"price\": 249.99}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"user_id\": 5, \"items\": [{\"product_name\": \"iPhone 15 Pro\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 999, \"nanos\": 990000000}}, {\"product_name\": \"AirPods Pro\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 249, \"nanos\": 990000000}}]}" %ORDER_SERVICE_URL% order.OrderService/CreateOrder
 echo.
 
 echo Updating some order statuses...
 echo.
 
-echo Updating Order 1 to PROCESSING
-grpcurl -plaintext -d "{\"id\": 1, \"status\": 1}" %ORDER_SERVICE_URL% order.OrderService/UpdateOrderStatus
-echo.
+REM Statuses move one legal step at a time: PENDING, PROCESSING, SHIPPED, DELIVERED
+echo Updating Order %ORDER1_ID% to PROCESSING
+call :update_status %ORDER1_ID% PROCESSING
 
-echo Updating Order 2 to SHIPPED
-grpcurl -plaintext -d "{\"id\": 2, \"status\": 2}" %ORDER_SERVICE_URL% order.OrderService/UpdateOrderStatus
-echo.
+echo Updating Order %ORDER2_ID% to SHIPPED
+call :update_status %ORDER2_ID% PROCESSING
+call :update_status %ORDER2_ID% SHIPPED
 
-echo Updating Order 3 to DELIVERED
-grpcurl -plaintext -d "{\"id\": 3, \"status\": 3}" %ORDER_SERVICE_URL% order.OrderService/UpdateOrderStatus
+echo Updating Order %ORDER3_ID% to DELIVERED
+call :update_status %ORDER3_ID% PROCESSING
+call :update_status %ORDER3_ID% SHIPPED
+call :update_status %ORDER3_ID% DELIVERED
 echo.
 
 echo ========================================
@@ -93,10 +124,14 @@ echo   - Created 5 users
 echo   - Created 6 orders
 echo   - Updated 3 order statuses
 echo.
-echo You can now test with:
-echo   - List users: grpcurl -plaintext -d "{\"page\": 1, \"limit\": 10}" %USER_SERVICE_URL% user.UserService/ListUsers
-echo   - List orders: grpcurl -plaintext -d "{\"page\": 1, \"limit\": 10}" %ORDER_SERVICE_URL% order.OrderService/ListOrders
+echo Test users have the password %TEST_PASSWORD%. You can now test with:
+echo   - List users: grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"page\": 1, \"limit\": 10}" %USER_SERVICE_URL% user.UserService/ListUsers
+echo   - List orders: grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"page\": 1, \"limit\": 10}" %ORDER_SERVICE_URL% order.OrderService/ListOrders
 echo.
 
 pause
+exit /b 0
 
+:update_status
+grpcurl -plaintext -H "authorization: Bearer %ADMIN_TOKEN%" -d "{\"id\": %1, \"status\": \"%2\"}" %ORDER_SERVICE_URL% order.OrderService/UpdateOrderStatus > nul
+exit /b 0
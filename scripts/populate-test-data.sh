@@ -17,6 +17,11 @@ NC='\033[0m'
 # Configuration
 USER_SERVICE_URL=${USER_SERVICE_URL:-localhost:50051}
 ORDER_SERVICE_URL=${ORDER_SERVICE_URL:-localhost:50052}
+# Admin created by user-service from INITIAL_ADMIN_EMAIL/INITIAL_ADMIN_PASSWORD
+ADMIN_EMAIL=${ADMIN_EMAIL:-admin@example.com}
+ADMIN_PASSWORD=${ADMIN_PASSWORD:-dev-admin-password}
+# Password given to every test user
+TEST_PASSWORD=${TEST_PASSWORD:-test-password-123}
 
 # Check if grpcurl is installed
 if ! command -v grpcurl &> /dev/null; then
@@ -24,6 +29,16 @@ if ! command -v grpcurl &> /dev/null; then
     echo "Install it with: go install github.com/fullstorydev/grpcurl/cmd/grpcurl@latest"
     exit 1
 fi
+if ! command -v jq &> /dev/null; then
+    echo -e "${RED}Error: jq is not installed${NC}"
+    exit 1
+fi
+
+# login EMAIL PASSWORD prints an access token for the account
+login() {
+    grpcurl -plaintext -d "{\"email\": \"$1\", \"password\": \"$2\"}" \
+        $USER_SERVICE_URL user.UserService/Authenticate | jq -r '.tokens.accessToken // empty'
+}
 
 echo -e "${YELLOW}Creating test users...${NC}"
 
@@ -32,144 +47,165 @@ echo -e "${GREEN}Creating User 1: Alice Johnson${NC}"
 ALICE_ID=$(grpcurl -plaintext -d '{
   "name": "Alice Johnson",
   "email": "alice.johnson@example.com",
-  "phone": "+1-555-0101",
-  "address": "123 Tech Street, San Francisco, CA 94102"
-}' $USER_SERVICE_URL user.UserService/CreateUser | grep -o '"id":[0-9]*' | grep -o '[0-9]*')
+  "phone": "+15555550101",
+  "address": "123 Tech Street, San Francisco, CA 94102",
+  "password": "'"$TEST_PASSWORD"'"
+}' $USER_SERVICE_URL user.UserService/CreateUser | jq -r '.user.id')
 echo "Created user with ID: $ALICE_ID"
 
 echo -e "${GREEN}Creating User 2: Bob Smith${NC}"
 BOB_ID=$(grpcurl -plaintext -d '{
   "name": "Bob Smith",
   "email": "bob.smith@example.com",
-  "phone": "+1-555-0102",
-  "address": "456 Innovation Avenue, New York, NY 10001"
-}' $USER_SERVICE_URL user.UserService/CreateUser | grep -o '"id":[0-9]*' | grep -o '[0-9]*')
+  "phone": "+15555550102",
+  "address": "456 Innovation Avenue, New York, NY 10001",
+  "password": "'"$TEST_PASSWORD"'"
+}' $USER_SERVICE_URL user.UserService/CreateUser | jq -r '.user.id')
 echo "Created user with ID: $BOB_ID"
 
 echo -e "${GREEN}Creating User 3: Carol White${NC}"
 CAROL_ID=$(grpcurl -plaintext -d '{
   "name": "Carol White",
   "email": "carol.white@example.com",
-  "phone": "+1-555-0103",
-  "address": "789 Developer Road, Austin, TX 73301"
-}' $USER_SERVICE_URL user.UserService/CreateUser | grep -o '"id":[0-9]*' | grep -o '[0-9]*')
+  "phone": "+15555550103",
+  "address": "789 Developer Road, Austin, TX 73301",
+  "password": "'"$TEST_PASSWORD"'"
+}' $USER_SERVICE_URL user.UserService/CreateUser | jq -r '.user.id')
 echo "Created user with ID: $CAROL_ID"
 
 echo -e "${GREEN}Creating User 4: David Brown${NC}"
 DAVID_ID=$(grpcurl -plaintext -d '{
   "name": "David Brown",
   "email": "david.brown@example.com",
-  "phone": "+1-555-0104",
-  "address": "321 Startup Lane, Seattle, WA 98101"
-}' $USER_SERVICE_URL user.UserService/CreateUser | grep -o '"id":[0-9]*' | grep -o '[0-9]*')
+  "phone": "+15555550104",
+  "address": "321 Startup Lane, Seattle, WA 98101",
+  "password": "'"$TEST_PASSWORD"'"
+}' $USER_SERVICE_URL user.UserService/CreateUser | jq -r '.user.id')
 echo "Created user with ID: $DAVID_ID"
 
 echo -e "${GREEN}Creating User 5: Emma Davis${NC}"
 EMMA_ID=$(grpcurl -plaintext -d '{
   "name": "Emma Davis",
   "email": "emma.davis@example.com",
-  "phone": "+1-555-0105",
-  "address": "654 Cloud Drive, Boston, MA 02101"
-}' $USER_SERVICE_URL user.UserService/CreateUser | grep -o '"id":[0-9]*' | grep -o '[0-9]*')
+  "phone": "+15555550105",
+  "address": "654 Cloud Drive, Boston, MA 02101",
+  "password": "'"$TEST_PASSWORD"'"
+}' $USER_SERVICE_URL user.UserService/CreateUser | jq -r '.user.id')
 echo "Created user with ID: $EMMA_ID"
 
+echo ""
+echo -e "${YELLOW}Logging in...${NC}"
+ADMIN_TOKEN=$(login "$ADMIN_EMAIL" "$ADMIN_PASSWORD")
+if [ -z "$ADMIN_TOKEN" ]; then
+    echo -e "${RED}Error: could not log in as $ADMIN_EMAIL; set ADMIN_EMAIL and ADMIN_PASSWORD${NC}"
+    exit 1
+fi
+ALICE_TOKEN=$(login alice.johnson@example.com "$TEST_PASSWORD")
+BOB_TOKEN=$(login bob.smith@example.com "$TEST_PASSWORD")
+CAROL_TOKEN=$(login carol.white@example.com "$TEST_PASSWORD")
+DAVID_TOKEN=$(login david.brown@example.com "$TEST_PASSWORD")
+EMMA_TOKEN=$(login emma.davis@example.com "$TEST_PASSWORD")
+
 echo ""
 echo -e "${YELLOW}Creating test orders...${NC}"
 
+# OrderService takes prices as Money messages: whole units plus nanos
+# (billionths of a unit), so 2499.99 USD is units 2499, nanos 990000000
+
 # Create Orders for Alice (Electronics)
 echo -e "${GREEN}Creating Order 1 for Alice: Electronics${NC}"
-grpcurl -plaintext -d "{
+ORDER1_ID=$(grpcurl -plaintext -H "authorization: Bearer $ALICE_TOKEN" -d "{
   \"user_id\": $ALICE_ID,
   \"items\": [
-    {\"product_name\": \"MacBook Pro 16\\\"\", \"quantity\": 1, \"price\": 2499.99},
-    {\"product_name\": \"Magic Mouse\", \"quantity\": 1, \"price\": 79.99},
-    {\"product_name\": \"Magic Keyboard\", \"quantity\": 1, \"price\": 129.99}
+    {\"product_name\": \"MacBook Pro 16\\\"\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 2499, \"nanos\": 990000000}},
+    {\"product_name\": \"Magic Mouse\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 79, \"nanos\": 990000000}},
+    {\"product_name\": \"Magic Keyboard\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 129, \"nanos\": 990000000}}
   ]
-}" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
+}" $ORDER_SERVICE_URL order.OrderService/CreateOrder | jq -r '.order.id')
 echo "Created electronics order for Alice"
 
 # Create Orders for Alice (Accessories)
 echo -e "${GREEN}Creating Order 2 for Alice: Accessories${NC}"
-grpcurl -plaintext -d "{
+ORDER2_ID=$(grpcurl -plaintext -H "authorization: Bearer $ALICE_TOKEN" -d "{
   \"user_id\": $ALICE_ID,
   \"items\": [
-    {\"product_name\": \"USB-C Hub\", \"quantity\": 2, \"price\": 49.99},
-    {\"product_name\": \"Monitor Stand\", \"quantity\": 1, \"price\": 89.99}
+    {\"product_name\": \"USB-C Hub\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 49, \"nanos\": 990000000}},
+    {\"product_name\": \"Monitor Stand\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 89, \"nanos\": 990000000}}
   ]
-}" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
+}" $ORDER_SERVICE_URL order.OrderService/CreateOrder | jq -r '.order.id')
 echo "Created accessories order for Alice"
 
 # Create Order for Bob (Books)
 echo -e "${GREEN}Creating Order 3 for Bob: Programming Books${NC}"
-grpcurl -plaintext -d "{
+ORDER3_ID=$(grpcurl -plaintext -H "authorization: Bearer $BOB_TOKEN" -d "{
   \"user_id\": $BOB_ID,
   \"items\": [
-    {\"product_name\": \"Clean Code\", \"quantity\": 1, \"price\": 45.99},
-    {\"product_name\": \"Design Patterns\", \"quantity\": 1, \"price\": 54.99},
-    {\"product_name\": \"Refactoring\", \"quantity\": 1, \"price\": 49.99},
-    {\"product_name\": \"The Pragmatic Programmer\", \"quantity\": 1, \"price\": 39.99}
+    {\"product_name\": \"Clean Code\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 45, \"nanos\": 990000000}},
+    {\"product_name\": \"Design Patterns\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 54, \"nanos\": 990000000}},
+    {\"product_name\": \"Refactoring\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 49, \"nanos\": 990000000}},
+    {\"product_name\": \"The Pragmatic Programmer\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 39, \"nanos\": 990000000}}
   ]
-}" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
+}" $ORDER_SERVICE_URL order.OrderService/CreateOrder | jq -r '.order.id')
 echo "Created books order for Bob"
 
 # Create Order for Carol (Office Supplies)
 echo -e "${GREEN}Creating Order 4 for Carol: Office Setup${NC}"
-grpcurl -plaintext -d "{
+ORDER4_ID=$(grpcurl -plaintext -H "authorization: Bearer $CAROL_TOKEN" -d "{
   \"user_id\": $CAROL_ID,
   \"items\": [
-    {\"product_name\": \"Ergonomic Chair\", \"quantity\": 1, \"price\": 399.99},
-    {\"product_name\": \"Standing Desk\", \"quantity\": 1, \"price\": 599.99},
-    {\"product_name\": \"Desk Lamp\", \"quantity\": 2, \"price\": 45.99},
-    {\"product_name\": \"Cable Management Kit\", \"quantity\": 1, \"price\": 29.99}
+    {\"product_name\": \"Ergonomic Chair\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 399, \"nanos\": 990000000}},
+    {\"product_name\": \"Standing Desk\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 599, \"nanos\": 990000000}},
+    {\"product_name\": \"Desk Lamp\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 45, \"nanos\": 990000000}},
+    {\"product_name\": \"Cable Management Kit\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 29, \"nanos\": 990000000}}
   ]
-}" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
+}" $ORDER_SERVICE_URL order.OrderService/CreateOrder | jq -r '.order.id')
 echo "Created office supplies order for Carol"
 
 # Create Order for David (Gaming)
 echo -e "${GREEN}Creating Order 5 for David: Gaming Setup${NC}"
-grpcurl -plaintext -d "{
+grpcurl -plaintext -H "authorization: Bearer $DAVID_TOKEN" -d "{
   \"user_id\": $DAVID_ID,
   \"items\": [
-    {\"product_name\": \"Gaming Monitor 27\\\"\", \"quantity\": 2, \"price\": 349.99},
-    {\"product_name\": \"Mechanical Keyboard RGB\", \"quantity\": 1, \"price\": 159.99},
-    {\"product_name\": \"Gaming Mouse\", \"quantity\": 1, \"price\": 79.99},
-    {\"product_name\": \"Gaming Headset\", \"quantity\": 1, \"price\": 129.99}
+    {\"product_name\": \"Gaming Monitor 27\\\"\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 349, \"nanos\": 990000000}},
+    {\"product_name\": \"Mechanical Keyboard RGB\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 159, \"nanos\": 990000000}},
+    {\"product_name\": \"Gaming Mouse\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 79, \"nanos\": 990000000}},
+    {\"product_name\": \"Gaming Headset\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 129, \"nanos\": 990000000}}
   ]
 }" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
 echo "Created gaming order for David"
 
 # Create Order for Emma (Mobile Devices)
 echo -e "${GREEN}Creating Order 6 for Emma: Mobile Devices${NC}"
-grpcurl -plaintext -d "{
+grpcurl -plaintext -H "authorization: Bearer $EMMA_TOKEN" -d "{
   \"user_id\": $EMMA_ID,
   \"items\": [
-    {\"product_name\": \"iPhone 15 Pro\", \"quantity\": 1, \"price\": 999.99},
-    {\"product_name\": \"AirPods Pro\", \"quantity\": 1, \"price\": 249.99},
-    {\"product_name\": \"MagSafe Charger\", \"quantity\": 1, \"price\": 39.99},
-    {\"product_name\": \"Phone Case\", \"quantity\": 2, \"price\": 29.99}
+    {\"product_name\": \"iPhone 15 Pro\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 999, \"nanos\": 990000000}},
+    {\"product_name\": \"AirPods Pro\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 249, \"nanos\": 990000000}},
+    {\"product_name\": \"MagSafe Charger\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 39, \"nanos\": 990000000}},
+    {\"product_name\": \"Phone Case\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 29, \"nanos\": 990000000}}
   ]
 }" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
 echo "Created mobile devices order for Emma"
 
 # Create Order for Bob (Second Order - Software)
 echo -e "${GREEN}Creating Order 7 for Bob: Software Licenses${NC}"
-grpcurl -plaintext -d "{
+grpcurl -plaintext -H "authorization: Bearer $BOB_TOKEN" -d "{
   \"user_id\": $BOB_ID,
   \"items\": [
-    {\"product_name\": \"JetBrains All Products Pack\", \"quantity\": 1, \"price\": 649.00},
-    {\"product_name\": \"Adobe Creative Cloud\", \"quantity\": 1, \"price\": 599.88}
+    {\"product_name\": \"JetBrains All Products Pack\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 649, \"nanos\": 0}},
+    {\"product_name\": \"Adobe Creative Cloud\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 599, \"nanos\": 880000000}}
   ]
 }" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
 echo "Created software order for Bob"
 
 # Create Order for David (Second Order - Components)
 echo -e "${GREEN}Creating Order 8 for David: PC Components${NC}"
-grpcurl -plaintext -d "{
+grpcurl -plaintext -H "authorization: Bearer $DAVID_TOKEN" -d "{
   \"user_id\": $DAVID_ID,
   \"items\": [
-    {\"product_name\": \"RTX 4080 Graphics Card\", \"quantity\": 1, \"price\": 1199.99},
-    {\"product_name\": \"32GB DDR5 RAM\", \"quantity\": 2, \"price\": 179.99},
-    {\"product_name\": \"2TB NVMe SSD\", \"quantity\": 1, \"price\": 199.99}
+    {\"product_name\": \"RTX 4080 Graphics Card\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 1199, \"nanos\": 990000000}},
+    {\"product_name\": \"32GB DDR5 RAM\", \"quantity\": 2, \"price\": {\"currency_code\": \"USD\", \"units\": 179, \"nanos\": 990000000}},
+    {\"product_name\": \"2TB NVMe SSD\", \"quantity\": 1, \"price\": {\"currency_code\": \"USD\", \"units\": 199, \"nanos\": 990000000}}
   ]
 }" $ORDER_SERVICE_URL order.OrderService/CreateOrder > /dev/null
 echo "Created PC components order for David"
@@ -177,18 +213,27 @@ echo "Created PC components order for David"
 echo ""
 echo -e "${YELLOW}Updating some order statuses...${NC}"
 
-# Update order statuses
-echo -e "${GREEN}Updating Order 1 to PROCESSING${NC}"
-grpcurl -plaintext -d '{"id": 1, "status": 1}' $ORDER_SERVICE_URL order.OrderService/UpdateOrderStatus > /dev/null
+# Update order statuses one legal step at a time:
+# PENDING -> PROCESSING -> SHIPPED -> DELIVERED
+update_status() {
+    grpcurl -plaintext -H "authorization: Bearer $ADMIN_TOKEN" -d "{\"id\": $1, \"status\": \"$2\"}" \
+        $ORDER_SERVICE_URL order.OrderService/UpdateOrderStatus > /dev/null
+}
+
+echo -e "${GREEN}Updating Order $ORDER1_ID to PROCESSING${NC}"
+update_status "$ORDER1_ID" PROCESSING
 
-echo -e "${GREEN}Updating Order 2 to SHIPPED${NC}"
-grpcurl -plaintext -d '{"id": 2, "status": 2}' $ORDER_SERVICE_URL order.OrderService/UpdateOrderStatus > /dev/null
+echo -e "${GREEN}Updating Order $ORDER2_ID to SHIPPED${NC}"
+update_status "$ORDER2_ID" PROCESSING
+update_status "$ORDER2_ID" SHIPPED
 
-echo -e "${GREEN}Updating Order 3 to DELIVERED${NC}"
-grpcurl -plaintext -d '{"id": 3, "status": 3}' $ORDER_SERVICE_URL order.OrderService/UpdateOrderStatus > /dev/null
+echo -e "${GREEN}Updating Order $ORDER3_ID to DELIVERED${NC}"
+update_status "$ORDER3_ID" PROCESSING
+update_status "$ORDER3_ID" SHIPPED
+update_status "$ORDER3_ID" DELIVERED
 
-echo -e "${GREEN}Updating Order 4 to PROCESSING${NC}"
-grpcurl -plaintext -d '{"id": 4, "status": 1}' $ORDER_SERVICE_URL order.OrderService/UpdateOrderStatus > /dev/null
+echo -e "${GREEN}Updating Order $ORDER4_ID to PROCESSING${NC}"
+update_status "$ORDER4_ID" PROCESSING
 
 echo ""
 echo -e "${GREEN}========================================"
@@ -200,9 +245,10 @@ echo "  • Created 5 users"
 echo "  • Created 8 orders"
 echo "  • Updated 4 order statuses"
 echo ""
-echo "You can now test with:"
-echo "  • List users: grpcurl -plaintext -d '{\"page\": 1, \"limit\": 10}' $USER_SERVICE_URL user.UserService/ListUsers"
-echo "  • List orders: grpcurl -plaintext -d '{\"page\": 1, \"limit\": 10}' $ORDER_SERVICE_URL order.OrderService/ListOrders"
-echo "  • Get user orders: grpcurl -plaintext -d '{\"user_id\": 1}' $ORDER_SERVICE_URL order.OrderService/GetUserOrders"
+echo "You can now test with (every test user's password is $TEST_PASSWORD):"
+echo "  • Log in: TOKEN=\$(grpcurl -plaintext -d '{\"email\": \"$ADMIN_EMAIL\", \"password\": \"...\"}' $USER_SERVICE_URL user.UserService/Authenticate | jq -r .tokens.accessToken)"
+echo "  • List users: grpcurl -plaintext -H \"authorization: Bearer \$TOKEN\" -d '{\"limit\": 10}' $USER_SERVICE_URL user.UserService/ListUsers"
+echo "  • List orders: grpcurl -plaintext -H \"authorization: Bearer \$TOKEN\" -d '{\"limit\": 10}' $ORDER_SERVICE_URL order.OrderService/ListOrders"
+echo "  • Get user orders: grpcurl -plaintext -H \"authorization: Bearer \$TOKEN\" -d '{\"user_id\": $ALICE_ID}' $ORDER_SERVICE_URL order.OrderService/GetUserOrders"
 echo ""
 
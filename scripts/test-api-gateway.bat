@@ -2,6 +2,9 @@
 REM Quick test script for API Gateway
 
 set API_URL=http://localhost:3000
+REM Admin created by user-service from INITIAL_ADMIN_EMAIL/INITIAL_ADMIN_PASSWORD
+if not defined ADMIN_EMAIL set ADMIN_EMAIL=admin@example.com
+if not defined ADMIN_PASSWORD set ADMIN_PASSWORD=dev-admin-password
 
 echo ================================
 echo API Gateway Quick Test
@@ -24,13 +27,27 @@ REM Test 1: Create User
 echo Test 1: Creating a user...
 curl -s -X POST %API_URL%/api/users ^
   -H "Content-Type: application/json" ^
-  -d "{\"name\": \"Test User\", \"email\": \"test@example.com\", \"phone\": \"+1234567890\", \"address\": \"123 Test Street\"}"
+  -d "{\"name\": \"Test User\", \"email\": \"test@example.com\", \"phone\": \"+1234567890\", \"address\": \"123 Test Street\", \"password\": \"test-password-123\"}"
 echo.
 echo.
 
+REM Log in as the admin; listing users and orders is admin-only
+echo Logging in as %ADMIN_EMAIL%...
+curl -s -X POST %API_URL%/api/auth/login ^
+  -H "Content-Type: application/json" ^
+  -d "{\"email\": \"%ADMIN_EMAIL%\", \"password\": \"%ADMIN_PASSWORD%\"}" > "%TEMP%\admin-login.json"
+set TOKEN=
+for /f "usebackq delims=" %%t in (`jq -r ".tokens.access_token // empty" "%TEMP%\admin-login.json"`) do set TOKEN=%%t
+del "%TEMP%\admin-login.json"
+if not defined TOKEN (
+    echo Error: could not log in as %ADMIN_EMAIL%; set ADMIN_EMAIL and ADMIN_PASSWORD
+    exit /b 1
+)
+echo.
+
 REM Test 2: List Users
 echo Test 2: Listing users...
-curl -s "%API_URL%/api/users?page=1&limit=5"
+curl -s "%API_URL%/api/users?limit=5" -H "Authorization: Bearer %TOKEN%"
 echo.
 echo.
 
@@ -38,13 +55,14 @@ REM Test 3: Create Order
 echo Test 3: Creating an order...
 curl -s -X POST %API_URL%/api/orders ^
   -H "Content-Type: application/json" ^
+  -H "Authorization: Bearer %TOKEN%" ^
   -d "{\"user_id\": 1, \"items\": [{\"product_name\": \"Laptop\", \"quantity\": 1, \"price\": 999.99}]}"
 echo.
 echo.
 
 REM Test 4: List Orders
 echo Test 4: Listing orders...
-curl -s "%API_URL%/api/orders?page=1&limit=5"
+curl -s "%API_URL%/api/orders?limit=5" -H "Authorization: Bearer %TOKEN%"
 echo.
 echo.
 
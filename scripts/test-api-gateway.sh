@@ -3,6 +3,10 @@
 # Quick test script for API Gateway
 
 API_URL="http://localhost:3000"
+# Admin created by user-service from INITIAL_ADMIN_EMAIL/INITIAL_ADMIN_PASSWORD
+ADMIN_EMAIL=${ADMIN_EMAIL:-admin@example.com}
+ADMIN_PASSWORD=${ADMIN_PASSWORD:-dev-admin-password}
+TEST_PASSWORD="test-password-123"
 
 echo "🧪 API Gateway Quick Test"
 echo "================================"
@@ -32,7 +36,8 @@ USER_RESPONSE=$(curl -s -X POST $API_URL/api/users \
     "name": "Test User",
     "email": "test@example.com",
     "phone": "+1234567890",
-    "address": "123 Test Street"
+    "address": "123 Test Street",
+    "password": "'"$TEST_PASSWORD"'"
   }')
 
 if echo "$USER_RESPONSE" | jq -e '.success' > /dev/null 2>&1; then
@@ -45,9 +50,25 @@ else
 fi
 echo ""
 
+# Log in as the new user, and as the admin for admin-only endpoints
+login() {
+    curl -s -X POST $API_URL/api/auth/login \
+      -H "Content-Type: application/json" \
+      -d "{\"email\": \"$1\", \"password\": \"$2\"}" | jq -r '.tokens.access_token // empty'
+}
+echo -e "${YELLOW}Logging in...${NC}"
+TOKEN=$(login test@example.com "$TEST_PASSWORD")
+ADMIN_TOKEN=$(login "$ADMIN_EMAIL" "$ADMIN_PASSWORD")
+if [ -z "$TOKEN" ] || [ -z "$ADMIN_TOKEN" ]; then
+    echo "❌ Failed to log in; set ADMIN_EMAIL and ADMIN_PASSWORD to the initial admin"
+    exit 1
+fi
+echo -e "${GREEN}✅ Logged in${NC}"
+echo ""
+
 # Test 2: Get User
 echo -e "${YELLOW}Test 2: Getting user details...${NC}"
-curl -s $API_URL/api/users/$USER_ID | jq
+curl -s $API_URL/api/users/$USER_ID -H "Authorization: Bearer $TOKEN" | jq
 echo -e "${GREEN}✅ User retrieved successfully${NC}"
 echo ""
 
@@ -55,6 +76,7 @@ echo ""
 echo -e "${YELLOW}Test 3: Creating an order...${NC}"
 ORDER_RESPONSE=$(curl -s -X POST $API_URL/api/orders \
   -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $TOKEN" \
   -d "{
     \"user_id\": $USER_ID,
     \"items\": [
@@ -73,10 +95,11 @@ else
 fi
 echo ""
 
-# Test 4: Update Order Status
+# Test 4: Update Order Status (admin only)
 echo -e "${YELLOW}Test 4: Updating order status...${NC}"
 STATUS_RESPONSE=$(curl -s -X PATCH $API_URL/api/orders/$ORDER_ID/status \
   -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $ADMIN_TOKEN" \
   -d '{"status": "PROCESSING"}')
 
 if echo "$STATUS_RESPONSE" | jq -e '.success' > /dev/null 2>&1; then
@@ -89,7 +112,7 @@ echo ""
 
 # Test 5: Get User Orders
 echo -e "${YELLOW}Test 5: Getting user orders...${NC}"
-USER_ORDERS=$(curl -s $API_URL/api/orders/user/$USER_ID)
+USER_ORDERS=$(curl -s $API_URL/api/orders/user/$USER_ID -H "Authorization: Bearer $TOKEN")
 ORDER_COUNT=$(echo "$USER_ORDERS" | jq '.total')
 echo -e "${GREEN}✅ User has $ORDER_COUNT order(s)${NC}"
 echo ""
@@ -100,6 +123,6 @@ echo ""
 echo "Try these endpoints:"
 echo "  • API Docs:    $API_URL/"
 echo "  • Health:      $API_URL/health"
-echo "  • List Users:  $API_URL/api/users"
-echo "  • List Orders: $API_URL/api/orders"
+echo "  • List Users:  $API_URL/api/users (admin token required)"
+echo "  • List Orders: $API_URL/api/orders (admin token required)"
 
@@ -106,6 +106,7 @@ echo 1. Start all services with Docker:
 echo    docker-compose up --build
 echo.
 echo 2. OR run services individually:
+echo    (set the variables listed in WINDOWS-SETUP.md first)
 echo    Terminal 1: cd user-service ^&^& go run main.go
 echo    Terminal 2: cd order-service ^&^& go run main.go
 echo    Terminal 3: cd api-gateway ^&^& npm start
@@ -124,8 +124,8 @@ echo "1. Start all services with Docker:"
 echo "   docker-compose up --build"
 echo ""
 echo "2. OR run services individually:"
-echo "   Terminal 1: cd user-service && go run main.go"
-echo "   Terminal 2: cd order-service && go run main.go"  
+echo "   Terminal 1: make run-user"
+echo "   Terminal 2: make run-order"  
 echo "   Terminal 3: cd api-gateway && npm start"
 echo ""
 echo "3. Test the system:"
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+)
+
+// Role is what an authenticated caller is allowed to do.
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleAdmin    Role = "admin"
+	RoleService  Role = "service"
+)
+
+// Identity is the authenticated caller of an RPC: either an end user,
+// identified by a bearer token, or another service.
+type Identity struct {
+	UserID  int32  // set for end users
+	Service string // set for service callers
+	Role    Role
+}
+
+// IsService reports whether the caller is another service rather than a user.
+func (id *Identity) IsService() bool {
+	return id.Service != ""
+}
+
+// String describes the caller for logs and audit trails, e.g. "user:42" or
+// "service:order-service".
+func (id *Identity) String() string {
+	if id.IsService() {
+		return "service:" + id.Service
+	}
+	return "user:" + strconv.Itoa(int(id.UserID))
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the caller's identity, if the RPC was authenticated.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"os"
+	"strings"
+
+	"user-service/rpcerror"
+	"user-service/token"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+
+	// ServiceTokenHeader carries the shared token other services use to
+	// call this one on their own behalf.
+	ServiceTokenHeader = "x-service-token"
+)
+
+// Reason codes sent in the ErrorInfo of authentication and authorization
+// errors.
+const (
+	reasonMissingCredentials  = "MISSING_CREDENTIALS"
+	reasonInvalidToken        = "INVALID_TOKEN"
+	reasonInvalidServiceToken = "INVALID_SERVICE_TOKEN"
+	reasonRoleNotAllowed      = "ROLE_NOT_ALLOWED"
+)
+
+// exemptPrefixes are infrastructure services that never require a token.
+var exemptPrefixes = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// Authenticator checks the credentials on every incoming RPC and stores the
+// caller's Identity in the context.
+type Authenticator struct {
+	tokens        *token.Manager
+	serviceTokens map[string]string // token -> service name
+	serviceCerts  map[string]bool
+	public        map[string]bool
+}
+
+// NewAuthenticator verifies bearer tokens with tokens and service tokens
+// against serviceTokens (service name -> token). Callers presenting a
+// verified client certificate for one of serviceCerts are also accepted as
+// that service. publicMethods, given as full method names, may also be
+// called without credentials.
+func NewAuthenticator(tokens *token.Manager, serviceTokens map[string]string, serviceCerts []string, publicMethods ...string) *Authenticator {
+	a := &Authenticator{
+		tokens:        tokens,
+		serviceTokens: make(map[string]string, len(serviceTokens)),
+		serviceCerts:  make(map[string]bool, len(serviceCerts)),
+		public:        make(map[string]bool, len(publicMethods)),
+	}
+	for name, value := range serviceTokens {
+		a.serviceTokens[value] = name
+	}
+	for _, name := range serviceCerts {
+		a.serviceCerts[name] = true
+	}
+	for _, method := range publicMethods {
+		a.public[method] = true
+	}
+	return a
+}
+
+// ServiceTokensFromEnv parses SERVICE_TOKENS, a comma-separated list of
+// name:token pairs, e.g. "order-service:s3cret".
+func ServiceTokensFromEnv() map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("SERVICE_TOKENS"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if ok && name != "" && value != "" {
+			tokens[name] = value
+		}
+	}
+	return tokens
+}
+
+// ServiceCertNamesFromEnv parses SERVICE_CERT_NAMES, a comma-separated list
+// of the client certificate names that identify services, e.g.
+// "order-service". Certificates must also be signed by the client CA.
+func ServiceCertNamesFromEnv() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("SERVICE_CERT_NAMES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// UnaryServerInterceptor rejects unauthenticated calls with
+// codes.Unauthenticated.
+func (a *Authenticator) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func (a *Authenticator) StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate verifies the caller's credentials: a service token, a bearer
+// token, or failing those a service's client certificate. Public methods
+// may be called without credentials, but any tokens that are sent must be
+// valid, so that handlers can still tell who the caller is.
+func (a *Authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.exempt(fullMethod) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if a.public[fullMethod] && len(md.Get(ServiceTokenHeader)) == 0 && len(md.Get(authorizationHeader)) == 0 {
+		return ctx, nil
+	}
+
+	if values := md.Get(ServiceTokenHeader); len(values) > 0 {
+		if name, ok := a.lookupServiceToken(values[0]); ok {
+			return WithIdentity(ctx, &Identity{Service: name, Role: RoleService}), nil
+		}
+		slog.WarnContext(ctx, "Rejected invalid service token", "method", fullMethod)
+		return nil, rpcerror.Unauthenticated(reasonInvalidServiceToken, "invalid service token")
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		if name, ok := peerCertName(ctx); ok && a.serviceCerts[name] {
+			return WithIdentity(ctx, &Identity{Service: name, Role: RoleService}), nil
+		}
+		return nil, rpcerror.Unauthenticated(reasonMissingCredentials, "missing bearer token")
+	}
+	if len(values[0]) <= len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return nil, rpcerror.Unauthenticated(reasonInvalidToken, "authorization must be a bearer token")
+	}
+
+	claims, err := a.tokens.Verify(values[0][len(bearerPrefix):])
+	if err != nil {
+		slog.DebugContext(ctx, "Rejected bearer token", "method", fullMethod, "error", err)
+		return nil, rpcerror.Unauthenticated(reasonInvalidToken, "invalid or expired token")
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, rpcerror.Unauthenticated(reasonInvalidToken, "invalid or expired token")
+	}
+	return WithIdentity(ctx, &Identity{UserID: userID, Role: Role(claims.Role)}), nil
+}
+
+func (a *Authenticator) exempt(fullMethod string) bool {
+	for _, prefix := range exemptPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupServiceToken compares value against every configured token in
+// constant time.
+func (a *Authenticator) lookupServiceToken(value string) (string, bool) {
+	var name string
+	for candidate, service := range a.serviceTokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(value)) == 1 {
+			name = service
+		}
+	}
+	return name, name != ""
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
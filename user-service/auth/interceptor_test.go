@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"user-service/models"
+	"user-service/rpcerror"
+	"user-service/token"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSigningKeyRepository keeps a single generation of signing keys.
+type fakeSigningKeyRepository struct {
+	keys []*models.SigningKey
+}
+
+func (r *fakeSigningKeyRepository) Create(ctx context.Context, key *models.SigningKey) error {
+	key.CreatedAt = time.Now()
+	r.keys = append([]*models.SigningKey{key}, r.keys...)
+	return nil
+}
+
+func (r *fakeSigningKeyRepository) List(ctx context.Context, retention time.Duration) ([]*models.SigningKey, error) {
+	return r.keys, nil
+}
+
+func (r *fakeSigningKeyRepository) RetireAllExcept(ctx context.Context, kid string) error {
+	return nil
+}
+
+const (
+	testMethod   = "/user.UserService/GetUser"
+	publicMethod = "/user.UserService/Authenticate"
+)
+
+// withCert returns ctx as seen by a server that verified a client
+// certificate with the given common name and DNS names.
+func withCert(ctx context.Context, verified bool, commonName string, dnsNames ...string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}, DNSNames: dnsNames}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestAuthenticator(t *testing.T) {
+	tokens, err := token.NewManager(context.Background(), token.Config{
+		Issuer:              "user-service",
+		Audience:            "grpc-microservices",
+		AccessTokenTTL:      15 * time.Minute,
+		KeyRotationInterval: 24 * time.Hour,
+	}, &fakeSigningKeyRepository{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, _, err := tokens.Issue(7, "customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator(tokens, map[string]string{"order-service": "s3cret"}, []string{"order-service"}, publicMethod)
+
+	withMetadata := func(pairs ...string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+	}
+
+	for _, tc := range []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   *Identity // nil for no identity
+		reason string    // set if the call is rejected
+	}{
+		{"service token", withMetadata(ServiceTokenHeader, "s3cret"), testMethod,
+			&Identity{Service: "order-service", Role: RoleService}, ""},
+		{"invalid service token", withMetadata(ServiceTokenHeader, "guess"), testMethod, nil, reasonInvalidServiceToken},
+		{"bearer token", withMetadata(authorizationHeader, "Bearer "+accessToken), testMethod,
+			&Identity{UserID: 7, Role: RoleCustomer}, ""},
+		{"lower-case bearer", withMetadata(authorizationHeader, "bearer "+accessToken), testMethod,
+			&Identity{UserID: 7, Role: RoleCustomer}, ""},
+		{"basic auth", withMetadata(authorizationHeader, "Basic dXNlcjpwYXNz"), testMethod, nil, reasonInvalidToken},
+		{"invalid bearer token", withMetadata(authorizationHeader, "Bearer not-a-token"), testMethod, nil, reasonInvalidToken},
+		{"client certificate", withCert(context.Background(), true, "order-service"), testMethod,
+			&Identity{Service: "order-service", Role: RoleService}, ""},
+		{"client certificate DNS name", withCert(context.Background(), true, "", "order-service"), testMethod,
+			&Identity{Service: "order-service", Role: RoleService}, ""},
+		{"unknown client certificate", withCert(context.Background(), true, "billing-service"), testMethod, nil, reasonMissingCredentials},
+		{"unverified client certificate", withCert(context.Background(), false, "order-service"), testMethod, nil, reasonMissingCredentials},
+		{"no credentials", context.Background(), testMethod, nil, reasonMissingCredentials},
+		{"public method", context.Background(), publicMethod, nil, ""},
+		{"public method with a bearer token", withMetadata(authorizationHeader, "Bearer "+accessToken), publicMethod,
+			&Identity{UserID: 7, Role: RoleCustomer}, ""},
+		{"public method with an invalid token", withMetadata(authorizationHeader, "Bearer not-a-token"), publicMethod, nil, reasonInvalidToken},
+		{"health check", context.Background(), "/grpc.health.v1.Health/Check", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *Identity
+			handler := func(ctx context.Context, req any) (any, error) {
+				got, _ = FromContext(ctx)
+				return nil, nil
+			}
+			_, err := a.UnaryServerInterceptor(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+
+			if tc.reason != "" {
+				if status.Code(err) != codes.Unauthenticated || rpcerror.Reason(err) != tc.reason {
+					t.Fatalf("err = %v, want Unauthenticated with reason %s", err, tc.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("identity = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestServiceTokensFromEnv(t *testing.T) {
+	t.Setenv("SERVICE_TOKENS", " order-service:s3cret, billing:b:c ,broken,:empty,nameless:")
+	got := ServiceTokensFromEnv()
+	want := map[string]string{"order-service": "s3cret", "billing": "b:c"}
+	if len(got) != len(want) || got["order-service"] != want["order-service"] || got["billing"] != want["billing"] {
+		t.Errorf("ServiceTokensFromEnv = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// peerCertName returns the name in the caller's client certificate, if it
+// presented one that the server verified against its client CA. The
+// subject common name is used, falling back to the first DNS name.
+func peerCertName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	leaf := info.State.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName, true
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0], true
+	}
+	return "", false
+}
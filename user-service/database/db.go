@@ -3,10 +3,12 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 var DB *sql.DB
@@ -22,7 +24,8 @@ func InitDB() error {
 		host, port, user, password, dbname)
 
 	var err error
-	DB, err = sql.Open("postgres", connStr)
+	DB, err = otelsql.Open("postgres", connStr,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(dbname)))
 	if err != nil {
 		return fmt.Errorf("error opening database: %v", err)
 	}
@@ -31,7 +34,7 @@ func InitDB() error {
 		return fmt.Errorf("error connecting to database: %v", err)
 	}
 
-	log.Println("Successfully connected to PostgreSQL database")
+	slog.Info("Successfully connected to PostgreSQL database", "host", host, "database", dbname)
 
 	// Create tables
 	if err := createTables(); err != nil {
@@ -43,6 +46,8 @@ func InitDB() error {
 
 func createTables() error {
 	query := `
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 	CREATE TABLE IF NOT EXISTS users (
 		id SERIAL PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
@@ -53,7 +58,60 @@ func createTables() error {
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'customer';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+	-- Search documents for SearchUsers: words for prefix matching, weighted
+	-- so that name and email matches rank above address matches, and the
+	-- raw text for trigram similarity
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', name), 'A') ||
+		setweight(to_tsvector('simple', email), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(phone, '')), 'B') ||
+		setweight(to_tsvector('simple', COALESCE(address, '')), 'C')
+	) STORED;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+		name || ' ' || email || ' ' || COALESCE(phone, '') || ' ' || COALESCE(address, '')
+	) STORED;
+
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		owner VARCHAR(100) NOT NULL,
+		method VARCHAR(100) NOT NULL,
+		key VARCHAR(255) NOT NULL,
+		request_hash VARCHAR(64) NOT NULL,
+		response BYTEA,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (owner, method, key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		kid VARCHAR(64) PRIMARY KEY,
+		algorithm VARCHAR(16) NOT NULL,
+		private_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		retired_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		secret_hash VARCHAR(64) NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP,
+		replaced_by VARCHAR(64),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+	CREATE INDEX IF NOT EXISTS idx_users_created_at_id_active ON users(created_at DESC, id DESC) WHERE deleted_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector) WHERE deleted_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_users_search_text ON users USING GIN (search_text gin_trgm_ops) WHERE deleted_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
 	`
 
 	_, err := DB.Exec(query)
@@ -61,7 +119,7 @@ func createTables() error {
 		return err
 	}
 
-	log.Println("Tables created successfully")
+	slog.Info("Tables created successfully")
 	return nil
 }
 
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// redactedKeys lists attribute keys whose values are personal data and must
+// never reach the logs.
+var redactedKeys = map[string]bool{
+	"email":      true,
+	"user_email": true,
+	"phone":      true,
+	"address":    true,
+	"user_name":  true,
+	"password":   true,
+}
+
+const redacted = "[REDACTED]"
+
+// Init installs a JSON slog logger as the default, at the level named by
+// LOG_LEVEL (debug, info, warn or error; default info). Output from the
+// standard log package is routed through it as well.
+func Init(service string) {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       parseLevel(os.Getenv("LOG_LEVEL")),
+		ReplaceAttr: redact,
+	})
+	logger := slog.New(&contextHandler{Handler: handler}).With("service", service)
+	slog.SetDefault(logger)
+}
+
+// Fatal logs msg at error level and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func parseLevel(value string) slog.Level {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if redactedKeys[attr.Key] {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+// contextHandler adds the request ID carried by the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -1,28 +1,38 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"user-service/auth"
 	"user-service/database"
+	"user-service/healthcheck"
+	"user-service/logging"
+	"user-service/metrics"
 	"user-service/models"
+	"user-service/pagetoken"
 	pb "user-service/proto/user"
 	"user-service/service"
+	"user-service/tlsconfig"
+	"user-service/token"
+	"user-service/tracing"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
 func main() {
-	// Initialize database
-	if err := database.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
-	defer database.CloseDB()
+	logging.Init("user-service")
 
 	// Get port from environment or use default
 	port := os.Getenv("GRPC_PORT")
@@ -30,22 +40,121 @@ func main() {
 		port = "50051"
 	}
 
+	tlsConfig := tlsconfig.ServerConfigFromEnv()
+
+	// "main healthcheck" probes a running server, for container health checks
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		creds, err := tlsconfig.LoopbackCredentials(tlsConfig)
+		if err != nil {
+			logging.Fatal("Failed to load TLS credentials", "error", err)
+		}
+		if err := healthcheck.CheckAddr("localhost:"+port, pb.UserService_ServiceDesc.ServiceName, creds); err != nil {
+			logging.Fatal("Health check failed", "error", err)
+		}
+		return
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background(), "user-service")
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Initialize database
+	if err := database.InitDB(); err != nil {
+		logging.Fatal("Failed to initialize database", "error", err)
+	}
+	defer database.CloseDB()
+
 	// Create listener
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		logging.Fatal("Failed to listen", "error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Load token signing keys, creating the first one if needed
+	tokens, err := token.NewManager(ctx, token.ConfigFromEnv(), models.NewSigningKeyRepository(database.DB))
+	if err != nil {
+		logging.Fatal("Failed to initialize token manager", "error", err)
+	}
+	go tokens.Run(ctx)
+
+	// Require a bearer token, or a service token or certificate, on every
+	// RPC except sign-up, login and the token endpoints
+	authenticator := auth.NewAuthenticator(tokens, auth.ServiceTokensFromEnv(), auth.ServiceCertNamesFromEnv(),
+		pb.UserService_CreateUser_FullMethodName,
+		pb.UserService_Authenticate_FullMethodName,
+		pb.UserService_RefreshToken_FullMethodName,
+		pb.UserService_RevokeToken_FullMethodName,
+		pb.UserService_GetJWKS_FullMethodName,
+	)
+
+	// Serve TLS, and verify client certificates, if configured
+	creds, err := tlsconfig.ServerCredentials(tlsConfig)
+	if err != nil {
+		logging.Fatal("Failed to load TLS credentials", "error", err)
 	}
 
 	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)),
+		grpc.ChainUnaryInterceptor(
+			logging.UnaryServerInterceptor,
+			metrics.UnaryServerInterceptor,
+			authenticator.UnaryServerInterceptor,
+			service.AccessPolicy.UnaryServerInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			logging.StreamServerInterceptor,
+			metrics.StreamServerInterceptor,
+			authenticator.StreamServerInterceptor,
+			service.AccessPolicy.StreamServerInterceptor,
+		),
+	)
 
 	// Create repository and service
 	userRepo := models.NewUserRepository(database.DB)
-	userService := service.NewUserServiceServer(userRepo)
+	idempotencyRepo := models.NewIdempotencyRepository(database.DB)
+	refreshTokenRepo := models.NewRefreshTokenRepository(database.DB)
+	pageTokens, err := pagetoken.CodecFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to configure page tokens", "error", err)
+	}
+	userService := service.NewUserServiceServer(userRepo, idempotencyRepo, refreshTokenRepo, tokens, pageTokens)
+
+	// Create the first admin on a fresh database, if one is configured
+	if err := service.BootstrapAdmin(ctx, userRepo); err != nil {
+		logging.Fatal("Failed to create initial admin", "error", err)
+	}
 
 	// Register service
 	pb.RegisterUserServiceServer(grpcServer, userService)
 
+	// Register health service, driven by periodic database pings
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	checker := healthcheck.NewChecker(healthServer, healthCheckInterval(),
+		map[string][]string{pb.UserService_ServiceDesc.ServiceName: {"database"}},
+		map[string]healthcheck.Probe{"database": database.DB.PingContext})
+
+	go checker.Run(ctx)
+	go userService.Run(ctx)
+
+	// Expose Prometheus metrics on a separate HTTP listener
+	metrics.RegisterDB(database.DB, "userdb")
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9091"
+	}
+	go metrics.Serve(ctx, fmt.Sprintf(":%s", metricsPort))
+
 	// Register reflection service (for grpcurl and debugging)
 	reflection.Register(grpcServer)
 
@@ -54,13 +163,22 @@ func main() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 		<-sigCh
-		log.Println("Shutting down gRPC server...")
+		slog.Info("Shutting down gRPC server")
+		cancel()
+		checker.Shutdown()
+		userService.Shutdown()
 		grpcServer.GracefulStop()
 	}()
 
-	log.Printf("User Service gRPC server listening on port %s", port)
+	slog.Info("User Service gRPC server listening", "port", port, "tls", tlsConfig.Enabled)
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+		logging.Fatal("Failed to serve", "error", err)
 	}
 }
 
+func healthCheckInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return 10 * time.Second
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	serverHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, by status code.",
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+
+	serverHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Latency of RPCs handled by the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_service", "grpc_method"})
+)
+
+// UnaryServerInterceptor records request counts, status codes and latency
+// for every unary RPC.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeServer(info.FullMethod, start, err)
+	return resp, err
+}
+
+// StreamServerInterceptor records the same metrics for streaming RPCs,
+// measured over the lifetime of the stream.
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeServer(info.FullMethod, start, err)
+	return err
+}
+
+func observeServer(fullMethod string, start time.Time, err error) {
+	service, method := splitMethodName(fullMethod)
+	serverHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	serverHandlingSeconds.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+// RegisterDB exports connection pool statistics from db.Stats().
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Serve exposes /metrics on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Metrics server listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Metrics server failed", "error", err)
+	}
+}
+
+// splitMethodName splits "/package.Service/Method" into its parts.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptorCountsByCode(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUser"}
+	notFound := func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	counter := serverHandled.WithLabelValues("user.UserService", "GetUser", "NotFound")
+	before := testutil.ToFloat64(counter)
+
+	if _, err := UnaryServerInterceptor(context.Background(), nil, info, notFound); status.Code(err) != codes.NotFound {
+		t.Fatalf("interceptor error = %v, want the handler's NotFound", err)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("grpc_server_handled_total{grpc_code=\"NotFound\"} grew by %v, want 1", got)
+	}
+}
+
+func TestSplitMethodName(t *testing.T) {
+	for _, tc := range []struct {
+		fullMethod, service, method string
+	}{
+		{"/user.UserService/GetUser", "user.UserService", "GetUser"},
+		{"/grpc.health.v1.Health/Check", "grpc.health.v1.Health", "Check"},
+		{"Check", "unknown", "Check"},
+	} {
+		service, method := splitMethodName(tc.fullMethod)
+		if service != tc.service || method != tc.method {
+			t.Errorf("splitMethodName(%q) = %q, %q, want %q, %q", tc.fullMethod, service, method, tc.service, tc.method)
+		}
+	}
+}
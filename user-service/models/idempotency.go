@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// IdempotencyRecord is a stored request/response pair keyed by a client
+// supplied idempotency key. Keys are scoped to their Owner, the caller that
+// chose them. Response is nil while the original request is still being
+// processed.
+type IdempotencyRecord struct {
+	Owner       string
+	Key         string
+	Method      string
+	RequestHash string
+	Response    []byte
+	CreatedAt   time.Time
+}
+
+type IdempotencyRepository interface {
+	// Reserve claims owner's key for method. Records older than ttl are
+	// expired and may be claimed again. When the key is already taken, the
+	// existing record is returned and reserved is false.
+	Reserve(ctx context.Context, owner, key, method, requestHash string, ttl time.Duration) (record *IdempotencyRecord, reserved bool, err error)
+	Complete(ctx context.Context, owner, key, method string, response []byte) error
+	Release(ctx context.Context, owner, key, method string) error
+	// DeleteExpired removes records older than ttl and returns how many
+	// there were.
+	DeleteExpired(ctx context.Context, ttl time.Duration) (int64, error)
+}
+
+// idempotencyLeaseTimeout is how long a reservation without a stored
+// response blocks other callers before it is considered abandoned.
+const idempotencyLeaseTimeout = time.Minute
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Reserve(ctx context.Context, owner, key, method, requestHash string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	ctx, span := tracer.Start(ctx, "idempotencyRepository.Reserve")
+	defer span.End()
+
+	// Take over abandoned reservations and expired records
+	query := `
+		INSERT INTO idempotency_keys (owner, key, method, request_hash)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (owner, method, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, response = NULL, created_at = CURRENT_TIMESTAMP
+		WHERE (idempotency_keys.response IS NULL
+		    AND idempotency_keys.created_at < CURRENT_TIMESTAMP - $5 * INTERVAL '1 second')
+		  OR idempotency_keys.created_at < CURRENT_TIMESTAMP - $6 * INTERVAL '1 second'
+		RETURNING created_at
+	`
+	record := &IdempotencyRecord{Owner: owner, Key: key, Method: method, RequestHash: requestHash}
+	err := r.db.QueryRowContext(ctx, query, owner, key, method, requestHash, idempotencyLeaseTimeout.Seconds(), ttl.Seconds()).
+		Scan(&record.CreatedAt)
+	if err == nil {
+		return record, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	// The key is held by an earlier request
+	query = `
+		SELECT owner, key, method, request_hash, response, created_at
+		FROM idempotency_keys
+		WHERE owner = $1 AND method = $2 AND key = $3
+	`
+	existing := &IdempotencyRecord{}
+	err = r.db.QueryRowContext(ctx, query, owner, method, key).Scan(
+		&existing.Owner, &existing.Key, &existing.Method, &existing.RequestHash,
+		&existing.Response, &existing.CreatedAt,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, owner, key, method string, response []byte) error {
+	ctx, span := tracer.Start(ctx, "idempotencyRepository.Complete")
+	defer span.End()
+
+	query := `
+		UPDATE idempotency_keys
+		SET response = $1
+		WHERE owner = $2 AND method = $3 AND key = $4
+	`
+	_, err := r.db.ExecContext(ctx, query, response, owner, method, key)
+	return err
+}
+
+func (r *idempotencyRepository) Release(ctx context.Context, owner, key, method string) error {
+	ctx, span := tracer.Start(ctx, "idempotencyRepository.Release")
+	defer span.End()
+
+	query := `DELETE FROM idempotency_keys WHERE owner = $1 AND method = $2 AND key = $3 AND response IS NULL`
+	_, err := r.db.ExecContext(ctx, query, owner, method, key)
+	return err
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, ttl time.Duration) (int64, error) {
+	ctx, span := tracer.Start(ctx, "idempotencyRepository.DeleteExpired")
+	defer span.End()
+
+	query := `DELETE FROM idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`
+	result, err := r.db.ExecContext(ctx, query, ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PageCursor is the position of the last row of a page in a list ordered
+// by (created_at, id), newest first.
+type PageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int32     `json:"id"`
+}
+
+// Page selects the rows of a list to return.
+type Page struct {
+	// After starts the page after this row. Reading from a cursor is
+	// unaffected by rows added or removed since the previous page.
+	After *PageCursor
+
+	// Offset skips rows instead, for callers still using page numbers.
+	Offset int32
+
+	Limit int32
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", argon2.Version, argon2Memory, argon2Time, argon2Threads)
+	if !strings.HasPrefix(hash, prefix) {
+		t.Errorf("hash %q does not start with %q", hash, prefix)
+	}
+
+	if ok, err := VerifyPassword(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("VerifyPassword(right password) = %v, %v", ok, err)
+	}
+	if ok, err := VerifyPassword(hash, "correct horse "); err != nil || ok {
+		t.Errorf("VerifyPassword(wrong password) = %v, %v", ok, err)
+	}
+
+	again, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Error("two hashes of the same password are equal; the salt is not random")
+	}
+}
+
+func TestVerifyPasswordUsesStoredParameters(t *testing.T) {
+	// A hash made with other parameters than the current ones still verifies
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("correct horse"), salt, 2, 8*1024, 1, 16)
+	hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 8*1024, 2, 1,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	if ok, err := VerifyPassword(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("VerifyPassword = %v, %v", ok, err)
+	}
+}
+
+func TestVerifyPasswordRejectsInvalidHashes(t *testing.T) {
+	valid, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+
+	for name, hash := range map[string]string{
+		"empty":         "",
+		"bcrypt":        "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"argon2i":       strings.Replace(valid, "$argon2id$", "$argon2i$", 1),
+		"other version": strings.Replace(valid, fmt.Sprintf("v=%d", argon2.Version), "v=16", 1),
+		"bad params":    strings.Join([]string{"", parts[1], parts[2], "m=x,t=1,p=1", parts[4], parts[5]}, "$"),
+		"bad salt":      strings.Join([]string{"", parts[1], parts[2], parts[3], "!!", parts[5]}, "$"),
+		"bad key":       strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], "!!"}, "$"),
+		"missing key":   strings.Join(parts[:5], "$"),
+	} {
+		if ok, err := VerifyPassword(hash, "correct horse"); err != ErrInvalidPasswordHash || ok {
+			t.Errorf("%s: VerifyPassword = %v, %v; want ErrInvalidPasswordHash", name, ok, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// SearchCursor is the position of the last result of a search page, in
+// results ordered by (rank, id), best first.
+type SearchCursor struct {
+	Rank float32 `json:"r"`
+	ID   int32   `json:"id"`
+}
+
+// SearchResult is a user matching a search, with the rank it was sorted by.
+type SearchResult struct {
+	User *User
+	Rank float32
+}
+
+// SearchWords splits a search query into the words it is matched by:
+// lower-cased runs of letters and digits. Punctuation only separates words,
+// so "alice@example" and "alice example" search alike.
+func SearchWords(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Search returns up to limit users matching query, best match first,
+// starting after the cursor if one is given. A user matches if every word
+// of the query starts a word of their name, email, phone or address, or if
+// the query is similar enough to part of those fields to catch typos and
+// fragments. Deleted users are never returned.
+func (r *userRepository) Search(ctx context.Context, query string, after *SearchCursor, limit int32) ([]*SearchResult, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.Search")
+	defer span.End()
+
+	words := SearchWords(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	// Words hold only letters and digits, so they need no escaping in
+	// to_tsquery syntax
+	prefixes := make([]string, len(words))
+	for i, word := range words {
+		prefixes[i] = word + ":*"
+	}
+
+	sqlQuery := `
+		WITH matches AS (
+			SELECT id, name, email, phone, address, role, version, created_at, updated_at,
+				(ts_rank(search_vector, to_tsquery('simple', $1)) + word_similarity($2, search_text))::REAL AS rank
+			FROM users
+			WHERE deleted_at IS NULL
+				AND (search_vector @@ to_tsquery('simple', $1) OR $2 <% search_text)
+		)
+		SELECT id, name, email, phone, address, role, version, created_at, updated_at, rank
+		FROM matches
+	`
+	args := []any{strings.Join(prefixes, " & "), strings.Join(words, " "), limit}
+	if after != nil {
+		sqlQuery += ` WHERE (rank, id) < ($4::REAL, $5)`
+		args = append(args, after.Rank, after.ID)
+	}
+	sqlQuery += ` ORDER BY rank DESC, id DESC LIMIT $3`
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		result := &SearchResult{User: &User{}}
+		user := result.User
+		err := rows.Scan(
+			&user.ID, &user.Name, &user.Email, &user.Phone,
+			&user.Address, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SigningKey is a private key used to sign access tokens. Retired keys no
+// longer sign anything but stay published until tokens they signed expire.
+type SigningKey struct {
+	KID        string
+	Algorithm  string
+	PrivateKey string // PKCS#8, PEM encoded
+	CreatedAt  time.Time
+	Retired    bool
+}
+
+type SigningKeyRepository interface {
+	Create(ctx context.Context, key *SigningKey) error
+	// List returns active keys and keys retired less than retention ago,
+	// newest first.
+	List(ctx context.Context, retention time.Duration) ([]*SigningKey, error)
+	// RetireAllExcept retires every active key other than kid.
+	RetireAllExcept(ctx context.Context, kid string) error
+}
+
+type signingKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSigningKeyRepository(db *sql.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+func (r *signingKeyRepository) Create(ctx context.Context, key *SigningKey) error {
+	ctx, span := tracer.Start(ctx, "signingKeyRepository.Create")
+	defer span.End()
+
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, private_key)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`
+	return r.db.QueryRowContext(ctx, query, key.KID, key.Algorithm, key.PrivateKey).Scan(&key.CreatedAt)
+}
+
+func (r *signingKeyRepository) List(ctx context.Context, retention time.Duration) ([]*SigningKey, error) {
+	ctx, span := tracer.Start(ctx, "signingKeyRepository.List")
+	defer span.End()
+
+	query := `
+		SELECT kid, algorithm, private_key, created_at, retired_at IS NOT NULL
+		FROM signing_keys
+		WHERE retired_at IS NULL OR retired_at > CURRENT_TIMESTAMP - make_interval(secs => $1)
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*SigningKey
+	for rows.Next() {
+		key := &SigningKey{}
+		if err := rows.Scan(&key.KID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt, &key.Retired); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *signingKeyRepository) RetireAllExcept(ctx context.Context, kid string) error {
+	ctx, span := tracer.Start(ctx, "signingKeyRepository.RetireAllExcept")
+	defer span.End()
+
+	query := `
+		UPDATE signing_keys
+		SET retired_at = CURRENT_TIMESTAMP
+		WHERE retired_at IS NULL AND kid <> $1
+	`
+	_, err := r.db.ExecContext(ctx, query, kid)
+	return err
+}
+
+// RefreshToken is a long-lived, revocable credential exchanged for new
+// access tokens. Only a hash of its secret is stored.
+type RefreshToken struct {
+	ID         string
+	UserID     int32
+	SecretHash string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	Expired    bool
+	Revoked    bool
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *RefreshToken, ttl time.Duration) error
+	GetByID(ctx context.Context, id string) (*RefreshToken, error)
+	// Rotate revokes id in favour of replacement, returning false if id
+	// had already been revoked.
+	Rotate(ctx context.Context, id string, replacement *RefreshToken, ttl time.Duration) (bool, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeAllForUser(ctx context.Context, userID int32) error
+}
+
+type refreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) Create(ctx context.Context, token *RefreshToken, ttl time.Duration) error {
+	ctx, span := tracer.Start(ctx, "refreshTokenRepository.Create")
+	defer span.End()
+
+	return insertRefreshToken(ctx, r.db, token, ttl)
+}
+
+func (r *refreshTokenRepository) GetByID(ctx context.Context, id string) (*RefreshToken, error) {
+	ctx, span := tracer.Start(ctx, "refreshTokenRepository.GetByID")
+	defer span.End()
+
+	query := `
+		SELECT id, user_id, secret_hash, expires_at, created_at,
+			expires_at <= CURRENT_TIMESTAMP, revoked_at IS NOT NULL
+		FROM refresh_tokens
+		WHERE id = $1
+	`
+	token := &RefreshToken{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&token.ID, &token.UserID, &token.SecretHash, &token.ExpiresAt,
+		&token.CreatedAt, &token.Expired, &token.Revoked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *refreshTokenRepository) Rotate(ctx context.Context, id string, replacement *RefreshToken, ttl time.Duration) (bool, error) {
+	ctx, span := tracer.Start(ctx, "refreshTokenRepository.Rotate")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id, replacement.ID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	if err := insertRefreshToken(ctx, tx, replacement, ttl); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *refreshTokenRepository) Revoke(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "refreshTokenRepository.Revoke")
+	defer span.End()
+
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *refreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int32) error {
+	ctx, span := tracer.Start(ctx, "refreshTokenRepository.RevokeAllForUser")
+	defer span.End()
+
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertRefreshToken(ctx context.Context, db rowQuerier, token *RefreshToken, ttl time.Duration) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, secret_hash, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+		RETURNING expires_at, created_at
+	`
+	return db.QueryRowContext(ctx, query, token.ID, token.UserID, token.SecretHash, ttl.Seconds()).
+		Scan(&token.ExpiresAt, &token.CreatedAt)
+}
@@ -0,0 +1,7 @@
+package models
+
+import "go.opentelemetry.io/otel"
+
+// tracer creates a span per repository operation. The SQL statements it
+// issues are traced by otelsql and appear as children of that span.
+var tracer = otel.Tracer("user-service/models")
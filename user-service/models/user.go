@@ -1,8 +1,20 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+// User roles. Customers may only act on their own data; admins may act on
+// anyone's.
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
 )
 
 type User struct {
@@ -11,17 +23,58 @@ type User struct {
 	Email     string
 	Phone     string
 	Address   string
+	Role      string
+	Version   int32 // incremented by every update
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Credentials holds a user's password hash and login-failure state. It is
+// kept apart from User so that the hash is never loaded by ordinary reads.
+type Credentials struct {
+	UserID         int32
+	PasswordHash   string // empty if the user has no password yet
+	FailedAttempts int32
+	Locked         bool // locked out after too many failed logins
+}
+
+var (
+	// ErrEmailTaken is returned by Create and Update when another user,
+	// including a soft-deleted one, already has the email address.
+	ErrEmailTaken = errors.New("email address is already in use")
+
+	// ErrUserNotDeleted is returned when purging a user that has not been
+	// soft-deleted.
+	ErrUserNotDeleted = errors.New("user is not deleted")
+
+	// ErrRetentionPending is returned when purging a user whose retention
+	// window has not passed yet.
+	ErrRetentionPending = errors.New("user was deleted too recently to purge")
+
+	// ErrVersionConflict is returned by Update when the user was changed
+	// since it was read.
+	ErrVersionConflict = errors.New("user was modified concurrently")
+)
+
+// UserRepository reads and writes users. Deleted users are soft-deleted:
+// every read except Restore and Purge ignores them.
 type UserRepository interface {
-	Create(user *User) error
-	GetByID(id int32) (*User, error)
-	Update(user *User) error
-	Delete(id int32) error
-	List(page, limit int32) ([]*User, int32, error)
-	GetByEmail(email string) (*User, error)
+	Create(ctx context.Context, user *User, passwordHash string) error
+	GetByID(ctx context.Context, id int32) (*User, error)
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id int32) error
+	Restore(ctx context.Context, id int32) (*User, error)
+	Purge(ctx context.Context, id int32, retention time.Duration) error
+	List(ctx context.Context, page Page) ([]*User, error)
+	Count(ctx context.Context) (int32, error)
+	Search(ctx context.Context, query string, after *SearchCursor, limit int32) ([]*SearchResult, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	HasRole(ctx context.Context, role string) (bool, error)
+	GetCredentialsByID(ctx context.Context, id int32) (*Credentials, error)
+	GetCredentialsByEmail(ctx context.Context, email string) (*Credentials, error)
+	SetPasswordHash(ctx context.Context, id int32, passwordHash string) error
+	RecordLoginFailure(ctx context.Context, id int32, maxAttempts int32, lockout time.Duration) error
+	ResetLoginFailures(ctx context.Context, id int32) error
 }
 
 type userRepository struct {
@@ -32,26 +85,35 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) Create(user *User) error {
+// Create inserts user. passwordHash may be empty for users without a
+// password.
+func (r *userRepository) Create(ctx context.Context, user *User, passwordHash string) error {
+	ctx, span := tracer.Start(ctx, "userRepository.Create")
+	defer span.End()
+
 	query := `
-		INSERT INTO users (name, email, phone, address)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at
+		INSERT INTO users (name, email, phone, address, role, password_hash)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'customer'), NULLIF($6, ''))
+		RETURNING id, role, version, created_at, updated_at
 	`
-	return r.db.QueryRow(query, user.Name, user.Email, user.Phone, user.Address).
-		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, user.Name, user.Email, user.Phone, user.Address, user.Role, passwordHash).
+		Scan(&user.ID, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt)
+	return mapEmailConflict(err)
 }
 
-func (r *userRepository) GetByID(id int32) (*User, error) {
+func (r *userRepository) GetByID(ctx context.Context, id int32) (*User, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.GetByID")
+	defer span.End()
+
 	query := `
-		SELECT id, name, email, phone, address, created_at, updated_at
+		SELECT id, name, email, phone, address, role, version, created_at, updated_at
 		FROM users
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 	user := &User{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.Name, &user.Email, &user.Phone,
-		&user.Address, &user.CreatedAt, &user.UpdatedAt,
+		&user.Address, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -59,20 +121,67 @@ func (r *userRepository) GetByID(id int32) (*User, error) {
 	return user, nil
 }
 
-func (r *userRepository) Update(user *User) error {
+// Update saves user if it is still at user.Version, and advances the
+// version. It returns ErrVersionConflict if the user was changed in the
+// meantime, and sql.ErrNoRows if it no longer exists.
+func (r *userRepository) Update(ctx context.Context, user *User) error {
+	ctx, span := tracer.Start(ctx, "userRepository.Update")
+	defer span.End()
+
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, phone = $3, address = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5
-		RETURNING updated_at
+		SET name = $1, email = $2, phone = $3, address = $4, role = $5,
+			version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6 AND version = $7 AND deleted_at IS NULL
+		RETURNING version, updated_at
 	`
-	return r.db.QueryRow(query, user.Name, user.Email, user.Phone, user.Address, user.ID).
-		Scan(&user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, user.Name, user.Email, user.Phone, user.Address, user.Role, user.ID, user.Version).
+		Scan(&user.Version, &user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return r.versionConflict(ctx, user.ID)
+	}
+	return mapEmailConflict(err)
+}
+
+// versionConflict explains why a conditional update matched no rows:
+// ErrVersionConflict if the user still exists, sql.ErrNoRows otherwise.
+func (r *userRepository) versionConflict(ctx context.Context, id int32) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return sql.ErrNoRows
 }
 
-func (r *userRepository) Delete(id int32) error {
-	query := `DELETE FROM users WHERE id = $1`
-	result, err := r.db.Exec(query, id)
+// uniqueViolation is the PostgreSQL error code for a UNIQUE constraint
+// failure.
+const uniqueViolation = "23505"
+
+// mapEmailConflict turns a violation of the unique email constraint into
+// ErrEmailTaken.
+func mapEmailConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "users_email_key" {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// Delete soft-deletes the user.
+func (r *userRepository) Delete(ctx context.Context, id int32) error {
+	ctx, span := tracer.Start(ctx, "userRepository.Delete")
+	defer span.End()
+
+	query := `
+		UPDATE users
+		SET deleted_at = CURRENT_TIMESTAMP, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -89,34 +198,84 @@ func (r *userRepository) Delete(id int32) error {
 	return nil
 }
 
-func (r *userRepository) List(page, limit int32) ([]*User, int32, error) {
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 {
-		limit = 10
+// Restore undoes a soft delete and returns the restored user. It returns
+// sql.ErrNoRows if the user does not exist or is not deleted.
+func (r *userRepository) Restore(ctx context.Context, id int32) (*User, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.Restore")
+	defer span.End()
+
+	query := `
+		UPDATE users
+		SET deleted_at = NULL, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, name, email, phone, address, role, version, created_at, updated_at
+	`
+	user := &User{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Name, &user.Email, &user.Phone,
+		&user.Address, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
 	}
+	return user, nil
+}
 
-	offset := (page - 1) * limit
+// Purge permanently deletes a user that was soft-deleted at least
+// retention ago. It returns sql.ErrNoRows if the user does not exist,
+// ErrUserNotDeleted or ErrRetentionPending.
+func (r *userRepository) Purge(ctx context.Context, id int32, retention time.Duration) error {
+	ctx, span := tracer.Start(ctx, "userRepository.Purge")
+	defer span.End()
 
-	// Get total count
-	var total int32
-	countQuery := `SELECT COUNT(*) FROM users`
-	err := r.db.QueryRow(countQuery).Scan(&total)
-	if err != nil {
-		return nil, 0, err
+	query := `
+		WITH target AS (
+			SELECT id,
+				deleted_at IS NOT NULL AS deleted,
+				COALESCE(deleted_at <= CURRENT_TIMESTAMP - make_interval(secs => $2), FALSE) AS expired
+			FROM users
+			WHERE id = $1
+		), purged AS (
+			DELETE FROM users
+			USING target
+			WHERE users.id = target.id AND target.deleted AND target.expired
+		)
+		SELECT deleted, expired FROM target
+	`
+	var deleted, expired bool
+	if err := r.db.QueryRowContext(ctx, query, id, retention.Seconds()).Scan(&deleted, &expired); err != nil {
+		return err
 	}
+	if !deleted {
+		return ErrUserNotDeleted
+	}
+	if !expired {
+		return ErrRetentionPending
+	}
+	return nil
+}
+
+// List returns a page of users, newest first.
+func (r *userRepository) List(ctx context.Context, page Page) ([]*User, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.List")
+	defer span.End()
 
-	// Get users
 	query := `
-		SELECT id, name, email, phone, address, created_at, updated_at
+		SELECT id, name, email, phone, address, role, version, created_at, updated_at
 		FROM users
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		WHERE deleted_at IS NULL
 	`
-	rows, err := r.db.Query(query, limit, offset)
+	var args []any
+	if page.After != nil {
+		query += ` AND (created_at, id) < ($1, $2)`
+		args = append(args, page.After.CreatedAt, page.After.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	args = append(args, page.Limit, page.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -125,27 +284,40 @@ func (r *userRepository) List(page, limit int32) ([]*User, int32, error) {
 		user := &User{}
 		err := rows.Scan(
 			&user.ID, &user.Name, &user.Email, &user.Phone,
-			&user.Address, &user.CreatedAt, &user.UpdatedAt,
+			&user.Address, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 		users = append(users, user)
 	}
 
-	return users, total, nil
+	return users, rows.Err()
 }
 
-func (r *userRepository) GetByEmail(email string) (*User, error) {
+// Count returns the number of users that have not been deleted.
+func (r *userRepository) Count(ctx context.Context) (int32, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.Count")
+	defer span.End()
+
+	var total int32
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE deleted_at IS NULL`).Scan(&total)
+	return total, err
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.GetByEmail")
+	defer span.End()
+
 	query := `
-		SELECT id, name, email, phone, address, created_at, updated_at
+		SELECT id, name, email, phone, address, role, version, created_at, updated_at
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 	user := &User{}
-	err := r.db.QueryRow(query, email).Scan(
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID, &user.Name, &user.Email, &user.Phone,
-		&user.Address, &user.CreatedAt, &user.UpdatedAt,
+		&user.Address, &user.Role, &user.Version, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -153,3 +325,104 @@ func (r *userRepository) GetByEmail(email string) (*User, error) {
 	return user, nil
 }
 
+// HasRole reports whether any user that has not been deleted has role.
+func (r *userRepository) HasRole(ctx context.Context, role string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.HasRole")
+	defer span.End()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE role = $1 AND deleted_at IS NULL)`
+	err := r.db.QueryRowContext(ctx, query, role).Scan(&exists)
+	return exists, err
+}
+
+// credentialColumns evaluates the lockout in the database so that it is
+// judged against the same clock that set it.
+const credentialColumns = `id, COALESCE(password_hash, ''), failed_login_attempts,
+	COALESCE(locked_until > CURRENT_TIMESTAMP, FALSE)`
+
+func scanCredentials(row *sql.Row) (*Credentials, error) {
+	creds := &Credentials{}
+	if err := row.Scan(&creds.UserID, &creds.PasswordHash, &creds.FailedAttempts, &creds.Locked); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (r *userRepository) GetCredentialsByID(ctx context.Context, id int32) (*Credentials, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.GetCredentialsByID")
+	defer span.End()
+
+	query := `SELECT ` + credentialColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
+	return scanCredentials(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *userRepository) GetCredentialsByEmail(ctx context.Context, email string) (*Credentials, error) {
+	ctx, span := tracer.Start(ctx, "userRepository.GetCredentialsByEmail")
+	defer span.End()
+
+	query := `SELECT ` + credentialColumns + ` FROM users WHERE email = $1 AND deleted_at IS NULL`
+	return scanCredentials(r.db.QueryRowContext(ctx, query, email))
+}
+
+// SetPasswordHash replaces the user's password hash and clears any lockout.
+func (r *userRepository) SetPasswordHash(ctx context.Context, id int32, passwordHash string) error {
+	ctx, span := tracer.Start(ctx, "userRepository.SetPasswordHash")
+	defer span.End()
+
+	query := `
+		UPDATE users
+		SET password_hash = $1, failed_login_attempts = 0, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND deleted_at IS NULL
+	`
+	result, err := r.db.ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed login. Once maxAttempts consecutive
+// failures have been recorded the account is locked for lockout and the
+// counter starts again.
+func (r *userRepository) RecordLoginFailure(ctx context.Context, id int32, maxAttempts int32, lockout time.Duration) error {
+	ctx, span := tracer.Start(ctx, "userRepository.RecordLoginFailure")
+	defer span.End()
+
+	query := `
+		UPDATE users
+		SET failed_login_attempts = CASE
+				WHEN failed_login_attempts + 1 >= $2 THEN 0
+				ELSE failed_login_attempts + 1
+			END,
+			locked_until = CASE
+				WHEN failed_login_attempts + 1 >= $2 THEN CURRENT_TIMESTAMP + make_interval(secs => $3)
+				ELSE locked_until
+			END
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, maxAttempts, lockout.Seconds())
+	return err
+}
+
+// ResetLoginFailures clears the failure counter after a successful login.
+func (r *userRepository) ResetLoginFailures(ctx context.Context, id int32) error {
+	ctx, span := tracer.Start(ctx, "userRepository.ResetLoginFailures")
+	defer span.End()
+
+	query := `
+		UPDATE users
+		SET failed_login_attempts = 0, locked_until = NULL
+		WHERE id = $1 AND (failed_login_attempts <> 0 OR locked_until IS NOT NULL)
+	`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
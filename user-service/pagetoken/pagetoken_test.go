@@ -0,0 +1,153 @@
+package pagetoken
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+type position struct {
+	ID    int32  `json:"id"`
+	Query string `json:"q"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	codec := NewCodec([]byte("secret"), time.Hour)
+	token, err := codec.Encode(position{ID: 42, Query: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got position
+	if err := codec.Decode(token, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (position{ID: 42, Query: "alice"}) {
+		t.Errorf("Decode = %+v", got)
+	}
+}
+
+func TestDecodeRejectsTamperedTokens(t *testing.T) {
+	codec := NewCodec([]byte("secret"), time.Hour)
+	token, err := codec.Encode(position{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Forge a position with the signature of the real one
+	forged, err := codec.Encode(position{ID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedData, _ := base64.RawURLEncoding.DecodeString(forged)
+	signature := data[len(data)-sha256.Size:]
+	swapped := append(append([]byte(nil), forgedData[:len(forgedData)-sha256.Size]...), signature...)
+
+	flipped := append([]byte(nil), data...)
+	flipped[0] ^= 1
+
+	for name, tampered := range map[string]string{
+		"payload bit flipped": base64.RawURLEncoding.EncodeToString(flipped),
+		"payload replaced":    base64.RawURLEncoding.EncodeToString(swapped),
+		"signature dropped":   base64.RawURLEncoding.EncodeToString(data[:len(data)-sha256.Size]),
+		"truncated":           token[:len(token)-1],
+		"not base64":          token + "!",
+		"empty":               "",
+		"shorter than a MAC":  base64.RawURLEncoding.EncodeToString([]byte("short")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got position
+			if err := codec.Decode(tampered, &got); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Decode = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsTokensSignedWithAnotherKey(t *testing.T) {
+	token, err := NewCodec([]byte("other service"), time.Hour).Encode(position{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got position
+	if err := NewCodec([]byte("secret"), time.Hour).Decode(token, &got); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Decode = %v, want ErrInvalid", err)
+	}
+}
+
+func TestDecodeRejectsStaleTokens(t *testing.T) {
+	issued := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	codec := NewCodec([]byte("secret"), time.Hour)
+	codec.now = func() time.Time { return issued }
+	token, err := codec.Encode(position{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		now  time.Time
+		want error
+	}{
+		{"fresh", issued.Add(time.Minute), nil},
+		{"at max age", issued.Add(time.Hour), nil},
+		{"stale", issued.Add(time.Hour + time.Second), ErrExpired},
+		{"issued within clock skew", issued.Add(-maxClockSkew), nil},
+		{"issued in the future", issued.Add(-maxClockSkew - time.Second), ErrInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			codec.now = func() time.Time { return tc.now }
+			var got position
+			if err := codec.Decode(token, &got); !errors.Is(err, tc.want) {
+				t.Errorf("Decode = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCodecFromEnv(t *testing.T) {
+	t.Run("secret", func(t *testing.T) {
+		t.Setenv("PAGE_TOKEN_SECRET", "secret")
+		t.Setenv("PAGE_TOKEN_MAX_AGE", "5m")
+		codec, err := CodecFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec.maxAge != 5*time.Minute {
+			t.Errorf("maxAge = %v, want 5m", codec.maxAge)
+		}
+		// Replicas sharing the secret accept each other's tokens
+		token, _ := NewCodec([]byte("secret"), time.Hour).Encode(position{ID: 42})
+		var got position
+		if err := codec.Decode(token, &got); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("no secret", func(t *testing.T) {
+		t.Setenv("PAGE_TOKEN_SECRET", "")
+		t.Setenv("APP_ENV", "")
+		if _, err := CodecFromEnv(); err == nil {
+			t.Error("CodecFromEnv succeeded without PAGE_TOKEN_SECRET")
+		}
+	})
+
+	t.Run("no secret in development", func(t *testing.T) {
+		t.Setenv("PAGE_TOKEN_SECRET", "")
+		t.Setenv("APP_ENV", "development")
+		codec, err := CodecFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec.maxAge != DefaultMaxAge {
+			t.Errorf("maxAge = %v, want %v", codec.maxAge, DefaultMaxAge)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package rpcerror
+
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Details is the decoded form of an error returned by a gRPC call. Fields
+// for details the error does not carry are left empty.
+type Details struct {
+	Code    codes.Code
+	Message string
+
+	// From ErrorInfo
+	Reason   string
+	Domain   string
+	Metadata map[string]string
+
+	Resource               *errdetails.ResourceInfo
+	FieldViolations        []*errdetails.BadRequest_FieldViolation
+	PreconditionViolations []*errdetails.PreconditionFailure_Violation
+
+	// RetryDelay is the delay suggested by RetryInfo, and HasRetryInfo
+	// whether there was one, since a zero delay is meaningful.
+	RetryDelay   time.Duration
+	HasRetryInfo bool
+}
+
+// Decode extracts the status and details of err. Errors that are not gRPC
+// statuses decode as codes.Unknown, and nil as codes.OK.
+func Decode(err error) Details {
+	st := status.Convert(err)
+	d := Details{Code: st.Code(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			d.Reason = detail.Reason
+			d.Domain = detail.Domain
+			d.Metadata = detail.Metadata
+		case *errdetails.ResourceInfo:
+			d.Resource = detail
+		case *errdetails.BadRequest:
+			d.FieldViolations = append(d.FieldViolations, detail.FieldViolations...)
+		case *errdetails.PreconditionFailure:
+			d.PreconditionViolations = append(d.PreconditionViolations, detail.Violations...)
+		case *errdetails.RetryInfo:
+			d.RetryDelay = detail.RetryDelay.AsDuration()
+			d.HasRetryInfo = true
+		}
+	}
+	return d
+}
+
+// Reason returns the ErrorInfo reason of err, or "" if it has none.
+func Reason(err error) string {
+	return Decode(err).Reason
+}
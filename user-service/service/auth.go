@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"user-service/models"
+	pb "user-service/proto/user"
+	"user-service/rpcerror"
+)
+
+// errInvalidCredentials is returned for every failed login, whatever the
+// cause, so that callers cannot probe which emails are registered.
+var errInvalidCredentials = rpcerror.Unauthenticated(reasonInvalidCredentials, "invalid email or password")
+
+// dummyPasswordHash is verified against when a login names an unknown user,
+// so that the response takes as long as for a wrong password.
+var dummyPasswordHash, _ = models.HashPassword("dummy password for timing")
+
+// lockoutPolicy locks an account for duration after maxAttempts
+// consecutive failed logins.
+type lockoutPolicy struct {
+	maxAttempts int32
+	duration    time.Duration
+}
+
+// lockoutPolicyFromEnv reads AUTH_MAX_FAILED_ATTEMPTS (default 5) and
+// AUTH_LOCKOUT_DURATION (default 15m).
+func lockoutPolicyFromEnv() lockoutPolicy {
+	policy := lockoutPolicy{maxAttempts: 5, duration: 15 * time.Minute}
+	if n, err := strconv.Atoi(os.Getenv("AUTH_MAX_FAILED_ATTEMPTS")); err == nil && n > 0 {
+		policy.maxAttempts = int32(n)
+	}
+	if d, err := time.ParseDuration(os.Getenv("AUTH_LOCKOUT_DURATION")); err == nil && d > 0 {
+		policy.duration = d
+	}
+	return policy
+}
+
+// Authenticate checks an email and password and returns the matching user
+// with a new access and refresh token pair.
+func (s *UserServiceServer) Authenticate(ctx context.Context, req *pb.AuthenticateRequest) (*pb.AuthenticateResponse, error) {
+	slog.InfoContext(ctx, "Authenticating user", "email", req.Email)
+
+	v := &validator{}
+	v.required("email", req.Email)
+	v.required("password", req.Password)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	creds, err := s.repo.GetCredentialsByEmail(ctx, req.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			models.VerifyPassword(dummyPasswordHash, req.Password)
+			return nil, errInvalidCredentials
+		}
+		slog.ErrorContext(ctx, "Error getting credentials", "error", err)
+		return nil, internalError("failed to authenticate")
+	}
+
+	if err := s.checkPassword(ctx, creds, req.Password); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByID(ctx, creds.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user", "error", err)
+		return nil, internalError("failed to authenticate")
+	}
+
+	tokens, err := s.issueTokens(ctx, user)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error issuing tokens", "error", err)
+		return nil, internalError("failed to authenticate")
+	}
+
+	return &pb.AuthenticateResponse{
+		User:   modelToProto(user),
+		Tokens: tokens,
+	}, nil
+}
+
+// ChangePassword sets a new password after verifying the current one. All
+// of the user's refresh tokens are revoked.
+func (s *UserServiceServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	slog.InfoContext(ctx, "Changing password", "user_id", req.UserId)
+
+	if err := authorizeUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	v.password("new_password", req.NewPassword)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	creds, err := s.repo.GetCredentialsByID(ctx, req.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, userNotFound(req.UserId)
+		}
+		slog.ErrorContext(ctx, "Error getting credentials", "error", err)
+		return nil, internalError("failed to change password")
+	}
+
+	if creds.PasswordHash != "" {
+		if req.CurrentPassword == "" {
+			return nil, rpcerror.InvalidArgument(reasonInvalidFields, "current password is required",
+				rpcerror.FieldViolation("current_password", "is required"))
+		}
+		if err := s.checkPassword(ctx, creds, req.CurrentPassword); err != nil {
+			return nil, rpcerror.PermissionDenied(reasonCurrentPasswordIncorrect, "current password is incorrect")
+		}
+	}
+
+	hash, err := models.HashPassword(req.NewPassword)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error hashing password", "error", err)
+		return nil, internalError("failed to change password")
+	}
+	if err := s.repo.SetPasswordHash(ctx, req.UserId, hash); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, userNotFound(req.UserId)
+		}
+		slog.ErrorContext(ctx, "Error setting password", "error", err)
+		return nil, internalError("failed to change password")
+	}
+	if err := s.refreshTokens.RevokeAllForUser(ctx, req.UserId); err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh tokens", "error", err)
+	}
+
+	return &pb.ChangePasswordResponse{
+		Message: "Password changed successfully",
+		Success: true,
+	}, nil
+}
+
+// checkPassword verifies password against creds, applying the lockout
+// policy. The hash is always verified, even for locked accounts, so that
+// a lockout cannot be detected from response times.
+func (s *UserServiceServer) checkPassword(ctx context.Context, creds *models.Credentials, password string) error {
+	hash := creds.PasswordHash
+	if hash == "" {
+		hash = dummyPasswordHash
+	}
+	ok, err := models.VerifyPassword(hash, password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error verifying password", "user_id", creds.UserID, "error", err)
+		return internalError("failed to authenticate")
+	}
+
+	if creds.Locked {
+		slog.WarnContext(ctx, "Login attempt on locked account", "user_id", creds.UserID)
+		return errInvalidCredentials
+	}
+	if !ok || creds.PasswordHash == "" {
+		if err := s.repo.RecordLoginFailure(ctx, creds.UserID, s.lockout.maxAttempts, s.lockout.duration); err != nil {
+			slog.ErrorContext(ctx, "Error recording login failure", "error", err)
+		}
+		if creds.FailedAttempts+1 >= s.lockout.maxAttempts {
+			slog.WarnContext(ctx, "Account locked after repeated login failures", "user_id", creds.UserID)
+		}
+		return errInvalidCredentials
+	}
+
+	if creds.FailedAttempts > 0 {
+		if err := s.repo.ResetLoginFailures(ctx, creds.UserID); err != nil {
+			slog.ErrorContext(ctx, "Error resetting login failures", "error", err)
+		}
+	}
+	return nil
+}
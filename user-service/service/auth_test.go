@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service/models"
+	pb "user-service/proto/user"
+	"user-service/rpcerror"
+	"user-service/token"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAccountRepository holds a single user with a password and applies
+// the lockout rules of the SQL repository.
+type fakeAccountRepository struct {
+	models.UserRepository
+	user  *models.User
+	creds models.Credentials
+}
+
+func (r *fakeAccountRepository) GetByID(ctx context.Context, id int32) (*models.User, error) {
+	if id != r.user.ID {
+		return nil, sql.ErrNoRows
+	}
+	user := *r.user
+	return &user, nil
+}
+
+func (r *fakeAccountRepository) GetCredentialsByEmail(ctx context.Context, email string) (*models.Credentials, error) {
+	if email != r.user.Email {
+		return nil, sql.ErrNoRows
+	}
+	creds := r.creds
+	return &creds, nil
+}
+
+func (r *fakeAccountRepository) RecordLoginFailure(ctx context.Context, id int32, maxAttempts int32, lockout time.Duration) error {
+	r.creds.FailedAttempts++
+	if r.creds.FailedAttempts >= maxAttempts {
+		r.creds.FailedAttempts = 0
+		r.creds.Locked = true
+	}
+	return nil
+}
+
+func (r *fakeAccountRepository) ResetLoginFailures(ctx context.Context, id int32) error {
+	r.creds.FailedAttempts = 0
+	return nil
+}
+
+// fakeRefreshTokenRepository keeps refresh tokens in memory.
+type fakeRefreshTokenRepository struct {
+	tokens map[string]*models.RefreshToken
+}
+
+func (r *fakeRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken, ttl time.Duration) error {
+	stored := *token
+	r.tokens[token.ID] = &stored
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) GetByID(ctx context.Context, id string) (*models.RefreshToken, error) {
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (r *fakeRefreshTokenRepository) Rotate(ctx context.Context, id string, replacement *models.RefreshToken, ttl time.Duration) (bool, error) {
+	if r.tokens[id].Revoked {
+		return false, nil
+	}
+	r.tokens[id].Revoked = true
+	return true, r.Create(ctx, replacement, ttl)
+}
+
+func (r *fakeRefreshTokenRepository) Revoke(ctx context.Context, id string) error {
+	r.tokens[id].Revoked = true
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int32) error {
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+// fakeSigningKeyRepository keeps a single generation of signing keys.
+type fakeSigningKeyRepository struct {
+	keys []*models.SigningKey
+}
+
+func (r *fakeSigningKeyRepository) Create(ctx context.Context, key *models.SigningKey) error {
+	key.CreatedAt = time.Now()
+	r.keys = append([]*models.SigningKey{key}, r.keys...)
+	return nil
+}
+
+func (r *fakeSigningKeyRepository) List(ctx context.Context, retention time.Duration) ([]*models.SigningKey, error) {
+	return r.keys, nil
+}
+
+func (r *fakeSigningKeyRepository) RetireAllExcept(ctx context.Context, kid string) error {
+	return nil
+}
+
+// newAuthTestServer returns a server with one customer, alice@example.com,
+// whose password is "correct horse". Accounts lock after 3 failures.
+func newAuthTestServer(t *testing.T) (*UserServiceServer, *fakeAccountRepository, *fakeRefreshTokenRepository) {
+	t.Helper()
+	hash, err := models.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeAccountRepository{
+		user:  &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Role: models.RoleCustomer},
+		creds: models.Credentials{UserID: 1, PasswordHash: hash},
+	}
+	tokens, err := token.NewManager(context.Background(), token.Config{
+		Issuer:              "user-service",
+		Audience:            "grpc-microservices",
+		AccessTokenTTL:      15 * time.Minute,
+		RefreshTokenTTL:     24 * time.Hour,
+		KeyRotationInterval: 24 * time.Hour,
+	}, &fakeSigningKeyRepository{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshTokens := &fakeRefreshTokenRepository{tokens: map[string]*models.RefreshToken{}}
+
+	s := &UserServiceServer{
+		repo:          repo,
+		refreshTokens: refreshTokens,
+		tokens:        tokens,
+		lockout:       lockoutPolicy{maxAttempts: 3, duration: 15 * time.Minute},
+	}
+	return s, repo, refreshTokens
+}
+
+func isInvalidCredentials(err error) bool {
+	return status.Code(err) == codes.Unauthenticated && rpcerror.Reason(err) == reasonInvalidCredentials
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, _, _ := newAuthTestServer(t)
+	ctx := context.Background()
+
+	resp, err := s.Authenticate(ctx, &pb.AuthenticateRequest{Email: "alice@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Authenticate = %v", err)
+	}
+	claims, err := s.tokens.Verify(resp.Tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("access token rejected: %v", err)
+	}
+	if id, _ := claims.UserID(); id != 1 || claims.Role != models.RoleCustomer {
+		t.Errorf("claims = user %d, role %q", id, claims.Role)
+	}
+
+	for name, req := range map[string]*pb.AuthenticateRequest{
+		"wrong password": {Email: "alice@example.com", Password: "wrong horse"},
+		"unknown email":  {Email: "bob@example.com", Password: "correct horse"},
+	} {
+		if _, err := s.Authenticate(ctx, req); !isInvalidCredentials(err) {
+			t.Errorf("%s: Authenticate = %v, want INVALID_CREDENTIALS", name, err)
+		}
+	}
+}
+
+func TestAuthenticateLocksOutAfterRepeatedFailures(t *testing.T) {
+	s, repo, _ := newAuthTestServer(t)
+	ctx := context.Background()
+	wrong := &pb.AuthenticateRequest{Email: "alice@example.com", Password: "wrong horse"}
+	right := &pb.AuthenticateRequest{Email: "alice@example.com", Password: "correct horse"}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := s.Authenticate(ctx, wrong); !isInvalidCredentials(err) {
+			t.Fatalf("failure %d: Authenticate = %v, want INVALID_CREDENTIALS", i, err)
+		}
+		if locked := repo.creds.Locked; locked != (i == 3) {
+			t.Fatalf("locked after %d failures = %v", i, locked)
+		}
+	}
+
+	// A locked account looks the same as a wrong password
+	if _, err := s.Authenticate(ctx, right); !isInvalidCredentials(err) {
+		t.Errorf("locked account: Authenticate = %v, want INVALID_CREDENTIALS", err)
+	}
+
+	repo.creds.Locked = false
+	if _, err := s.Authenticate(ctx, right); err != nil {
+		t.Errorf("Authenticate after the lockout = %v", err)
+	}
+}
+
+func TestAuthenticateResetsFailuresOnSuccess(t *testing.T) {
+	s, repo, _ := newAuthTestServer(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		s.Authenticate(ctx, &pb.AuthenticateRequest{Email: "alice@example.com", Password: "wrong horse"})
+	}
+	if _, err := s.Authenticate(ctx, &pb.AuthenticateRequest{Email: "alice@example.com", Password: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	if repo.creds.FailedAttempts != 0 {
+		t.Errorf("failed attempts = %d after a successful login, want 0", repo.creds.FailedAttempts)
+	}
+
+	// Only consecutive failures count towards the lockout
+	for i := 0; i < 2; i++ {
+		s.Authenticate(ctx, &pb.AuthenticateRequest{Email: "alice@example.com", Password: "wrong horse"})
+	}
+	if repo.creds.Locked {
+		t.Error("account locked by failures on either side of a successful login")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, _, _ := newAuthTestServer(t)
+	ctx := context.Background()
+
+	login, err := s.Authenticate(ctx, &pb.AuthenticateRequest{Email: "alice@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := login.Tokens.RefreshToken
+
+	refreshed, err := s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: first})
+	if err != nil {
+		t.Fatalf("RefreshToken = %v", err)
+	}
+	second := refreshed.Tokens.RefreshToken
+	if second == first {
+		t.Fatal("refresh token was not rotated")
+	}
+	if _, err := s.tokens.Verify(refreshed.Tokens.AccessToken); err != nil {
+		t.Errorf("new access token rejected: %v", err)
+	}
+
+	third, err := s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: second})
+	if err != nil {
+		t.Fatalf("RefreshToken with the rotated token = %v", err)
+	}
+
+	// Presenting a rotated token again revokes every session
+	_, err = s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: first})
+	if status.Code(err) != codes.Unauthenticated || rpcerror.Reason(err) != reasonInvalidRefreshToken {
+		t.Fatalf("reused token: RefreshToken = %v, want INVALID_REFRESH_TOKEN", err)
+	}
+	if _, err := s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: third.Tokens.RefreshToken}); err == nil {
+		t.Error("latest refresh token still works after a reused token was presented")
+	}
+}
+
+func TestRefreshTokenRejectsInvalidTokens(t *testing.T) {
+	s, _, refreshTokens := newAuthTestServer(t)
+	ctx := context.Background()
+
+	login, err := s.Authenticate(ctx, &pb.AuthenticateRequest{Email: "alice@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, _ := strings.Cut(login.Tokens.RefreshToken, ".")
+
+	expiredValue, expired, err := newRefreshToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Expired = true
+	refreshTokens.tokens[expired.ID] = expired
+
+	for name, value := range map[string]string{
+		"empty":        "",
+		"no secret":    id + ".",
+		"wrong secret": id + ".AAAA",
+		"unknown id":   "0123456789abcdef.AAAA",
+		"expired":      expiredValue,
+	} {
+		_, err := s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: value})
+		if status.Code(err) != codes.Unauthenticated || rpcerror.Reason(err) != reasonInvalidRefreshToken {
+			t.Errorf("%s: RefreshToken = %v, want INVALID_REFRESH_TOKEN", name, err)
+		}
+	}
+	if _, err := s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.Tokens.RefreshToken}); err != nil {
+		t.Errorf("valid token rejected after invalid attempts: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"user-service/models"
+)
+
+// initialAdmin is the account BootstrapAdmin creates on a fresh database.
+type initialAdmin struct {
+	name     string
+	email    string
+	password string
+}
+
+// initialAdminFromEnv reads INITIAL_ADMIN_EMAIL, INITIAL_ADMIN_PASSWORD and
+// INITIAL_ADMIN_NAME (default "Administrator").
+func initialAdminFromEnv() initialAdmin {
+	admin := initialAdmin{
+		name:     os.Getenv("INITIAL_ADMIN_NAME"),
+		email:    os.Getenv("INITIAL_ADMIN_EMAIL"),
+		password: os.Getenv("INITIAL_ADMIN_PASSWORD"),
+	}
+	if admin.name == "" {
+		admin.name = "Administrator"
+	}
+	return admin
+}
+
+// BootstrapAdmin creates the admin configured by INITIAL_ADMIN_EMAIL and
+// INITIAL_ADMIN_PASSWORD if no admin exists yet. Creating admins through
+// CreateUser requires an admin, so without this a new deployment has none.
+// Once any admin exists the variables are ignored, and may be removed.
+func BootstrapAdmin(ctx context.Context, repo models.UserRepository) error {
+	exists, err := repo.HasRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("checking for admins: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	admin := initialAdminFromEnv()
+	if admin.email == "" {
+		slog.Warn("No admin user exists and INITIAL_ADMIN_EMAIL is not set, admin-only methods cannot be called")
+		return nil
+	}
+
+	v := &validator{}
+	validateUserFields(v, admin.name, admin.email, "", "")
+	v.required("password", admin.password)
+	if admin.password != "" {
+		v.password("password", admin.password)
+	}
+	if err := v.err(); err != nil {
+		return fmt.Errorf("invalid initial admin: %w", err)
+	}
+
+	hash, err := models.HashPassword(admin.password)
+	if err != nil {
+		return fmt.Errorf("hashing initial admin password: %w", err)
+	}
+	user := &models.User{Name: admin.name, Email: admin.email, Role: models.RoleAdmin}
+	if err := repo.Create(ctx, user, hash); err != nil {
+		if errors.Is(err, models.ErrEmailTaken) {
+			// Never promote an existing account: anyone could have signed up
+			// with the address before the service was configured
+			return fmt.Errorf("initial admin %s: email belongs to an existing non-admin user", admin.email)
+		}
+		return fmt.Errorf("creating initial admin: %w", err)
+	}
+
+	slog.Info("Created initial admin user", "user_id", user.ID, "email", admin.email)
+	return nil
+}
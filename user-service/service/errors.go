@@ -0,0 +1,52 @@
+package service
+
+import (
+	"strconv"
+
+	"user-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Reason codes sent in the ErrorInfo of errors returned by
+// UserServiceServer. Clients may rely on them, so they must not change.
+const (
+	reasonInvalidFields            = "INVALID_FIELDS"
+	reasonUserNotFound             = "USER_NOT_FOUND"
+	reasonEmailTaken               = "EMAIL_TAKEN"
+	reasonAuthenticationRequired   = "AUTHENTICATION_REQUIRED"
+	reasonNotAccountOwner          = "NOT_ACCOUNT_OWNER"
+	reasonAdminRequired            = "ADMIN_REQUIRED"
+	reasonUserNotDeleted           = "USER_NOT_DELETED"
+	reasonRetentionPending         = "RETENTION_PENDING"
+	reasonInvalidCredentials       = "INVALID_CREDENTIALS"
+	reasonCurrentPasswordIncorrect = "CURRENT_PASSWORD_INCORRECT"
+	reasonInvalidRefreshToken      = "INVALID_REFRESH_TOKEN"
+	reasonIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	reasonIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	reasonEventStreamClosed        = "EVENT_STREAM_CLOSED"
+	reasonVersionConflict          = "VERSION_CONFLICT"
+	reasonInternal                 = "INTERNAL"
+)
+
+// internalError reports a failure the caller cannot fix. The cause is
+// logged where it happened and not sent to the client.
+func internalError(message string) error {
+	return rpcerror.New(codes.Internal, reasonInternal, message)
+}
+
+func invalidField(field, description string) error {
+	return rpcerror.InvalidArgument(reasonInvalidFields, field+" "+description,
+		rpcerror.FieldViolation(field, description))
+}
+
+func userNotFound(id int32) error {
+	return rpcerror.NotFound(reasonUserNotFound, "user", strconv.Itoa(int(id)), "user not found")
+}
+
+// userConflict reports that the user changed since the caller read it;
+// they should read it again and retry.
+func userConflict(id int32) error {
+	return rpcerror.New(codes.Aborted, reasonVersionConflict, "user was modified concurrently, read it again and retry",
+		rpcerror.Resource("user", strconv.Itoa(int(id))))
+}
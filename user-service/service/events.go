@@ -0,0 +1,83 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	pb "user-service/proto/user"
+)
+
+// eventBufferSize is how many events a subscriber may lag behind before it
+// is disconnected.
+const eventBufferSize = 64
+
+// userEventBroker fans out user change events to WatchUserEvents streams.
+type userEventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan *pb.UserEvent]struct{}
+	closed      bool
+}
+
+func newUserEventBroker() *userEventBroker {
+	return &userEventBroker{subscribers: make(map[chan *pb.UserEvent]struct{})}
+}
+
+func (b *userEventBroker) subscribe() chan *pb.UserEvent {
+	ch := make(chan *pb.UserEvent, eventBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+	return ch
+}
+
+// close disconnects every subscriber and rejects new ones. It lets the
+// long-lived WatchUserEvents streams finish so the server can drain.
+func (b *userEventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *userEventBroker) unsubscribe(ch chan *pb.UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish delivers an event to every subscriber without blocking. A
+// subscriber whose buffer is full is dropped; its channel is closed so the
+// stream ends and the client knows to resynchronise.
+func (b *userEventBroker) publish(eventType pb.UserEventType, userID int32) {
+	event := &pb.UserEvent{
+		Type:       eventType,
+		UserId:     userID,
+		OccurredAt: time.Now().UTC().Format("2006-01-02 15:04:05"),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	pb "user-service/proto/user"
+)
+
+func TestUserEventBrokerPublish(t *testing.T) {
+	b := newUserEventBroker()
+	ch := b.subscribe()
+
+	b.publish(pb.UserEventType_USER_UPDATED, 7)
+
+	event := <-ch
+	if event.Type != pb.UserEventType_USER_UPDATED || event.UserId != 7 {
+		t.Errorf("event = %v, want UPDATED for user 7", event)
+	}
+
+	b.unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after unsubscribe")
+	}
+	b.unsubscribe(ch)
+}
+
+func TestUserEventBrokerDropsSlowSubscriber(t *testing.T) {
+	b := newUserEventBroker()
+	slow := b.subscribe()
+
+	for i := 0; i <= eventBufferSize; i++ {
+		b.publish(pb.UserEventType_USER_UPDATED, int32(i))
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != eventBufferSize {
+		t.Errorf("slow subscriber received %d events, want %d", received, eventBufferSize)
+	}
+	if len(b.subscribers) != 0 {
+		t.Errorf("%d subscribers left, want 0", len(b.subscribers))
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+
+	"user-service/auth"
+	"user-service/models"
+	pb "user-service/proto/user"
+	"user-service/rpcerror"
+)
+
+var (
+	customers = auth.RoleCustomer
+	admins    = auth.RoleAdmin
+	services  = auth.RoleService
+)
+
+// AccessPolicy lists the roles allowed to call each UserService method.
+// Customers are further limited to their own account by authorizeUser.
+// Public methods (CreateUser, Authenticate and the token endpoints) can
+// also be called anonymously.
+var AccessPolicy = auth.Policy{
+	pb.UserService_CreateUser_FullMethodName:      {customers, admins},
+	pb.UserService_GetUser_FullMethodName:         {customers, admins, services},
+	pb.UserService_UpdateUser_FullMethodName:      {customers, admins},
+	pb.UserService_DeleteUser_FullMethodName:      {admins},
+	pb.UserService_RestoreUser_FullMethodName:     {admins},
+	pb.UserService_PurgeUser_FullMethodName:       {admins},
+	pb.UserService_ListUsers_FullMethodName:       {admins},
+	pb.UserService_SearchUsers_FullMethodName:     {admins},
+	pb.UserService_ValidateUser_FullMethodName:    {customers, admins, services},
+	pb.UserService_WatchUserEvents_FullMethodName: {admins, services},
+	pb.UserService_ChangePassword_FullMethodName:  {customers, admins},
+	pb.UserService_Authenticate_FullMethodName:    {customers, admins},
+	pb.UserService_RefreshToken_FullMethodName:    {customers, admins},
+	pb.UserService_RevokeToken_FullMethodName:     {customers, admins},
+	pb.UserService_GetJWKS_FullMethodName:         {customers, admins, services},
+}
+
+// authorizeUser checks that the caller may act on userID's account:
+// customers only on their own, admins and services on any.
+func authorizeUser(ctx context.Context, userID int32) error {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return rpcerror.PermissionDenied(reasonAuthenticationRequired, "authentication required")
+	}
+	if id.Role == auth.RoleAdmin || id.Role == auth.RoleService || id.UserID == userID {
+		return nil
+	}
+	return rpcerror.PermissionDenied(reasonNotAccountOwner, "not allowed to access another user's account")
+}
+
+// isAdmin reports whether the caller is an authenticated admin.
+func isAdmin(ctx context.Context) bool {
+	id, ok := auth.FromContext(ctx)
+	return ok && id.Role == auth.RoleAdmin
+}
+
+func roleFromProto(role pb.UserRole) string {
+	switch role {
+	case pb.UserRole_ADMIN:
+		return models.RoleAdmin
+	case pb.UserRole_CUSTOMER:
+		return models.RoleCustomer
+	default:
+		return ""
+	}
+}
+
+func roleToProto(role string) pb.UserRole {
+	switch role {
+	case models.RoleAdmin:
+		return pb.UserRole_ADMIN
+	case models.RoleCustomer:
+		return pb.UserRole_CUSTOMER
+	default:
+		return pb.UserRole_USER_ROLE_UNSPECIFIED
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"user-service/auth"
+	pb "user-service/proto/user"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessPolicyCoversEveryMethod(t *testing.T) {
+	// The roles allowed to call each method; adding an RPC without
+	// deciding who may call it fails this test
+	want := map[string][]auth.Role{
+		pb.UserService_CreateUser_FullMethodName:      {auth.RoleCustomer, auth.RoleAdmin},
+		pb.UserService_GetUser_FullMethodName:         {auth.RoleCustomer, auth.RoleAdmin, auth.RoleService},
+		pb.UserService_UpdateUser_FullMethodName:      {auth.RoleCustomer, auth.RoleAdmin},
+		pb.UserService_DeleteUser_FullMethodName:      {auth.RoleAdmin},
+		pb.UserService_RestoreUser_FullMethodName:     {auth.RoleAdmin},
+		pb.UserService_PurgeUser_FullMethodName:       {auth.RoleAdmin},
+		pb.UserService_ListUsers_FullMethodName:       {auth.RoleAdmin},
+		pb.UserService_SearchUsers_FullMethodName:     {auth.RoleAdmin},
+		pb.UserService_ValidateUser_FullMethodName:    {auth.RoleCustomer, auth.RoleAdmin, auth.RoleService},
+		pb.UserService_WatchUserEvents_FullMethodName: {auth.RoleAdmin, auth.RoleService},
+		pb.UserService_ChangePassword_FullMethodName:  {auth.RoleCustomer, auth.RoleAdmin},
+		pb.UserService_Authenticate_FullMethodName:    {auth.RoleCustomer, auth.RoleAdmin},
+		pb.UserService_RefreshToken_FullMethodName:    {auth.RoleCustomer, auth.RoleAdmin},
+		pb.UserService_RevokeToken_FullMethodName:     {auth.RoleCustomer, auth.RoleAdmin},
+		pb.UserService_GetJWKS_FullMethodName:         {auth.RoleCustomer, auth.RoleAdmin, auth.RoleService},
+	}
+
+	desc := pb.UserService_ServiceDesc
+	methods := make(map[string]bool)
+	for _, method := range desc.Methods {
+		methods["/"+desc.ServiceName+"/"+method.MethodName] = true
+	}
+	for _, stream := range desc.Streams {
+		methods["/"+desc.ServiceName+"/"+stream.StreamName] = true
+	}
+
+	for method := range methods {
+		roles, ok := AccessPolicy[method]
+		if !ok {
+			t.Errorf("%s has no entry in AccessPolicy", method)
+			continue
+		}
+		if fmt.Sprint(roles) != fmt.Sprint(want[method]) {
+			t.Errorf("%s is allowed for %v, want %v", method, roles, want[method])
+		}
+	}
+	for method := range AccessPolicy {
+		if !methods[method] {
+			t.Errorf("AccessPolicy lists %s, which is not a method of UserService", method)
+		}
+	}
+}
+
+func TestAccessPolicyDeniesCustomersAdminMethods(t *testing.T) {
+	customer := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+	admin := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 2, Role: auth.RoleAdmin})
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+
+	for _, method := range []string{
+		pb.UserService_DeleteUser_FullMethodName,
+		pb.UserService_RestoreUser_FullMethodName,
+		pb.UserService_PurgeUser_FullMethodName,
+		pb.UserService_ListUsers_FullMethodName,
+		pb.UserService_SearchUsers_FullMethodName,
+	} {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		if _, err := AccessPolicy.UnaryServerInterceptor(customer, nil, info, handler); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("customer calling %s: %v, want PermissionDenied", method, err)
+		}
+		if _, err := AccessPolicy.UnaryServerInterceptor(admin, nil, info, handler); err != nil {
+			t.Errorf("admin calling %s: %v", method, err)
+		}
+	}
+}
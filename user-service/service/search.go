@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"user-service/models"
+	"user-service/pagetoken"
+	pb "user-service/proto/user"
+)
+
+// maxSearchQueryLength bounds the text of a search, which is compared with
+// every user's fields.
+const maxSearchQueryLength = 200
+
+// searchToken is the content of a SearchUsers page token. Query
+// fingerprints the search, so that a token cannot continue a different
+// search or be passed to another method.
+type searchToken struct {
+	After models.SearchCursor `json:"a"`
+	Query string              `json:"q"`
+}
+
+// searchQuery fingerprints a SearchUsers request for the given query text.
+func searchQuery(query string) string {
+	return fingerprint(&pb.SearchUsersRequest{Query: query})
+}
+
+// SearchUsers finds users by partial name, email, phone or address, best
+// match first.
+func (s *UserServiceServer) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.SearchUsersResponse, error) {
+	query := strings.TrimSpace(req.Query)
+	slog.InfoContext(ctx, "Searching users", "limit", req.Limit, "page_token", req.PageToken != "")
+
+	v := &validator{}
+	v.required("query", query)
+	v.maxLength("query", query, maxSearchQueryLength)
+	if query != "" && len(models.SearchWords(query)) == 0 {
+		v.add("query", "must contain a letter or digit")
+	}
+	if req.Limit < 0 {
+		v.add("limit", "must not be negative")
+	}
+	var after *models.SearchCursor
+	if req.PageToken != "" {
+		var token searchToken
+		if err := s.pageTokens.Decode(req.PageToken, &token); errors.Is(err, pagetoken.ErrExpired) {
+			v.add("page_token", "has expired; search again from the first page")
+		} else if err != nil || token.Query != searchQuery(query) {
+			v.add("page_token", "is not a token returned by this method for this query")
+		}
+		after = &token.After
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	// Ask for one extra result to tell whether another page follows
+	size := pageSize(req.Limit)
+	results, err := s.repo.Search(ctx, query, after, size+1)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error searching users", "error", err)
+		return nil, internalError("failed to search users")
+	}
+
+	resp := &pb.SearchUsersResponse{}
+	if len(results) > int(size) {
+		results = results[:size]
+		last := results[size-1]
+		resp.NextPageToken, err = s.pageTokens.Encode(searchToken{
+			After: models.SearchCursor{Rank: last.Rank, ID: last.User.ID},
+			Query: searchQuery(query),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error creating page token", "error", err)
+			return nil, internalError("failed to search users")
+		}
+	}
+
+	resp.Users = make([]*pb.User, len(results))
+	for i, result := range results {
+		resp.Users[i] = modelToProto(result.User)
+	}
+	return resp, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service/models"
+	"user-service/pagetoken"
+	pb "user-service/proto/user"
+	"user-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSearchRepository returns the results after the cursor, best first.
+type fakeSearchRepository struct {
+	models.UserRepository
+	results []*models.SearchResult
+}
+
+func (r *fakeSearchRepository) Search(ctx context.Context, query string, after *models.SearchCursor, limit int32) ([]*models.SearchResult, error) {
+	results := r.results
+	if after != nil {
+		for i, result := range results {
+			if result.User.ID == after.ID {
+				results = results[i+1:]
+				break
+			}
+		}
+	}
+	if len(results) > int(limit) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func newSearchTestServer() *UserServiceServer {
+	repo := &fakeSearchRepository{}
+	for id := int32(1); id <= 3; id++ {
+		repo.results = append(repo.results, &models.SearchResult{
+			User: &models.User{ID: id, Name: "Alice", Email: "alice@example.com"},
+			Rank: 1 / float32(id),
+		})
+	}
+	return &UserServiceServer{repo: repo, pageTokens: pagetoken.NewCodec([]byte("secret"), time.Hour)}
+}
+
+func TestSearchUsersValidatesQuery(t *testing.T) {
+	s := newSearchTestServer()
+
+	for name, req := range map[string]*pb.SearchUsersRequest{
+		"empty":          {Query: ""},
+		"blank":          {Query: "   "},
+		"punctuation":    {Query: "@-+"},
+		"too long":       {Query: strings.Repeat("a", maxSearchQueryLength+1)},
+		"negative limit": {Query: "alice", Limit: -1},
+	} {
+		_, err := s.SearchUsers(context.Background(), req)
+		if status.Code(err) != codes.InvalidArgument || rpcerror.Reason(err) != reasonInvalidFields {
+			t.Errorf("%s: SearchUsers = %v, want INVALID_FIELDS", name, err)
+		}
+	}
+
+	if _, err := s.SearchUsers(context.Background(), &pb.SearchUsersRequest{Query: strings.Repeat("é", maxSearchQueryLength)}); err != nil {
+		t.Errorf("query of %d characters rejected: %v", maxSearchQueryLength, err)
+	}
+}
+
+func TestSearchUsersPages(t *testing.T) {
+	s := newSearchTestServer()
+	ctx := context.Background()
+
+	first, err := s.SearchUsers(ctx, &pb.SearchUsersRequest{Query: "alice", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Users) != 2 || first.NextPageToken == "" {
+		t.Fatalf("first page = %d users, token %q", len(first.Users), first.NextPageToken)
+	}
+
+	// Surrounding spaces do not change the search
+	second, err := s.SearchUsers(ctx, &pb.SearchUsersRequest{Query: " alice ", Limit: 2, PageToken: first.NextPageToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Users) != 1 || second.Users[0].Id != 3 || second.NextPageToken != "" {
+		t.Errorf("second page = %v, token %q", second.Users, second.NextPageToken)
+	}
+}
+
+func TestSearchUsersRejectsForeignTokens(t *testing.T) {
+	s := newSearchTestServer()
+	ctx := context.Background()
+
+	first, err := s.SearchUsers(ctx, &pb.SearchUsersRequest{Query: "alice", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listToken, err := nextPageToken(s.pageTokens, models.PageCursor{ID: 2}, listQuery(&pb.ListUsersRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, req := range map[string]*pb.SearchUsersRequest{
+		"other query":     {Query: "bob", PageToken: first.NextPageToken},
+		"ListUsers token": {Query: "alice", PageToken: listToken},
+		"malformed token": {Query: "alice", PageToken: "not-a-token"},
+		"token as query":  {Query: listQuery(&pb.ListUsersRequest{}), PageToken: listToken},
+	} {
+		_, err := s.SearchUsers(ctx, req)
+		violations := rpcerror.Decode(err).FieldViolations
+		if status.Code(err) != codes.InvalidArgument || len(violations) != 1 || violations[0].Field != "page_token" {
+			t.Errorf("%s: SearchUsers = %v, want InvalidArgument on page_token", name, err)
+		}
+	}
+
+	// Nor is a SearchUsers token accepted by ListUsers
+	_, _, err = listPage(s.pageTokens, 0, 0, first.NextPageToken, listQuery(&pb.ListUsersRequest{}))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListUsers with a SearchUsers token = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+
+	"user-service/models"
+	pb "user-service/proto/user"
+	"user-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errInvalidRefreshToken = rpcerror.Unauthenticated(reasonInvalidRefreshToken, "invalid refresh token")
+
+// newRefreshToken creates a refresh token for userID. The returned string,
+// "<id>.<secret>", is given to the client; only a hash of the secret is
+// stored.
+func newRefreshToken(userID int32) (string, *models.RefreshToken, error) {
+	id := make([]byte, 16)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	token := &models.RefreshToken{
+		ID:         hex.EncodeToString(id),
+		UserID:     userID,
+		SecretHash: hashSecret(encodedSecret),
+	}
+	return token.ID + "." + encodedSecret, token, nil
+}
+
+// lookupRefreshToken parses value and loads the stored token it names,
+// checking the secret.
+func (s *UserServiceServer) lookupRefreshToken(ctx context.Context, value string) (*models.RefreshToken, error) {
+	id, secret, ok := strings.Cut(value, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, errInvalidRefreshToken
+	}
+
+	token, err := s.refreshTokens.GetByID(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidRefreshToken
+		}
+		slog.ErrorContext(ctx, "Error getting refresh token", "error", err)
+		return nil, internalError("failed to check refresh token")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(token.SecretHash)) != 1 {
+		return nil, errInvalidRefreshToken
+	}
+	return token, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens creates a new access and refresh token pair for user.
+func (s *UserServiceServer) issueTokens(ctx context.Context, user *models.User) (*pb.TokenPair, error) {
+	refreshValue, refresh, err := newRefreshToken(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refreshTokens.Create(ctx, refresh, s.tokens.Config().RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+	return s.tokenPair(user, refreshValue)
+}
+
+func (s *UserServiceServer) tokenPair(user *models.User, refreshValue string) (*pb.TokenPair, error) {
+	accessToken, _, err := s.tokens.Issue(user.ID, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	cfg := s.tokens.Config()
+	return &pb.TokenPair{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(cfg.AccessTokenTTL.Seconds()),
+		RefreshToken:     refreshValue,
+		RefreshExpiresIn: int64(cfg.RefreshTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. The old
+// refresh token is revoked; presenting it again is treated as theft and
+// revokes every session of the user.
+func (s *UserServiceServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	token, err := s.lookupRefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Refreshing token", "user_id", token.UserID)
+
+	if token.Expired {
+		return nil, errInvalidRefreshToken
+	}
+	if token.Revoked {
+		return nil, s.refreshTokenReused(ctx, token.UserID)
+	}
+
+	// Reload the user so that the new access token carries their current role
+	user, err := s.repo.GetByID(ctx, token.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidRefreshToken
+		}
+		slog.ErrorContext(ctx, "Error getting user", "error", err)
+		return nil, internalError("failed to refresh token")
+	}
+
+	refreshValue, replacement, err := newRefreshToken(token.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating refresh token", "error", err)
+		return nil, internalError("failed to refresh token")
+	}
+	rotated, err := s.refreshTokens.Rotate(ctx, token.ID, replacement, s.tokens.Config().RefreshTokenTTL)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error rotating refresh token", "error", err)
+		return nil, internalError("failed to refresh token")
+	}
+	if !rotated {
+		// Revoked by a concurrent request using the same token
+		return nil, s.refreshTokenReused(ctx, token.UserID)
+	}
+
+	tokens, err := s.tokenPair(user, refreshValue)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error issuing access token", "error", err)
+		return nil, internalError("failed to refresh token")
+	}
+	return &pb.RefreshTokenResponse{Tokens: tokens}, nil
+}
+
+func (s *UserServiceServer) refreshTokenReused(ctx context.Context, userID int32) error {
+	slog.WarnContext(ctx, "Revoked refresh token reused, revoking all sessions", "user_id", userID)
+	if err := s.refreshTokens.RevokeAllForUser(ctx, userID); err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh tokens", "error", err)
+	}
+	return errInvalidRefreshToken
+}
+
+// RevokeToken revokes a refresh token, and optionally all others held by
+// the same user. Unknown tokens are not an error, as in RFC 7009.
+func (s *UserServiceServer) RevokeToken(ctx context.Context, req *pb.RevokeTokenRequest) (*pb.RevokeTokenResponse, error) {
+	token, err := s.lookupRefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			return &pb.RevokeTokenResponse{Success: true}, nil
+		}
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Revoking token", "user_id", token.UserID, "all_sessions", req.AllSessions)
+
+	if req.AllSessions {
+		err = s.refreshTokens.RevokeAllForUser(ctx, token.UserID)
+	} else {
+		err = s.refreshTokens.Revoke(ctx, token.ID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh token", "error", err)
+		return nil, internalError("failed to revoke token")
+	}
+	return &pb.RevokeTokenResponse{Success: true}, nil
+}
+
+// GetJWKS publishes the public keys used to sign access tokens, so that
+// other services can verify them without calling back here.
+func (s *UserServiceServer) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	keys := s.tokens.JWKS()
+	resp := &pb.GetJWKSResponse{Keys: make([]*pb.JSONWebKey, len(keys))}
+	for i, key := range keys {
+		resp.Keys[i] = &pb.JSONWebKey{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			Crv: key.Crv,
+			X:   key.X,
+			Y:   key.Y,
+		}
+	}
+	return resp, nil
+}
@@ -3,42 +3,125 @@ package service
 import (
 	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
 
 	"user-service/models"
+	"user-service/pagetoken"
 	pb "user-service/proto/user"
+	"user-service/rpcerror"
+	"user-service/token"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type UserServiceServer struct {
 	pb.UnimplementedUserServiceServer
-	repo models.UserRepository
+	repo          models.UserRepository
+	refreshTokens models.RefreshTokenRepository
+	tokens        *token.Manager
+	idempotency   *idempotencyGuard
+	events        *userEventBroker
+	lockout       lockoutPolicy
+	pageTokens    *pagetoken.Codec
+
+	// purgeRetention is how long a deleted user can still be restored
+	// before PurgeUser may remove it for good.
+	purgeRetention time.Duration
 }
 
-func NewUserServiceServer(repo models.UserRepository) *UserServiceServer {
-	return &UserServiceServer{repo: repo}
+func NewUserServiceServer(repo models.UserRepository, idempotencyRepo models.IdempotencyRepository, refreshTokenRepo models.RefreshTokenRepository, tokens *token.Manager, pageTokens *pagetoken.Codec) *UserServiceServer {
+	return &UserServiceServer{
+		repo:           repo,
+		refreshTokens:  refreshTokenRepo,
+		tokens:         tokens,
+		idempotency:    newIdempotencyGuard(idempotencyRepo),
+		events:         newUserEventBroker(),
+		lockout:        lockoutPolicyFromEnv(),
+		pageTokens:     pageTokens,
+		purgeRetention: purgeRetentionFromEnv(),
+	}
+}
+
+// purgeRetentionFromEnv reads USER_PURGE_RETENTION, defaulting to 30 days.
+func purgeRetentionFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("USER_PURGE_RETENTION")); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
 }
 
 func (s *UserServiceServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
-	log.Printf("Creating user: %s", req.Name)
+	slog.InfoContext(ctx, "Creating user", "user_name", req.Name, "email", req.Email)
 
-	if req.Name == "" || req.Email == "" {
-		return nil, status.Error(codes.InvalidArgument, "name and email are required")
+	v := &validator{}
+	v.required("name", req.Name)
+	v.required("email", req.Email)
+	validateUserFields(v, req.Name, req.Email, req.Phone, req.Address)
+	if req.Password != "" {
+		v.password("password", req.Password)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	if req.Role == pb.UserRole_ADMIN && !isAdmin(ctx) {
+		return nil, rpcerror.PermissionDenied(reasonAdminRequired, "only admins may create admin users")
+	}
+
+	key := idempotencyKey(ctx, req.IdempotencyKey)
+	if key == "" {
+		return s.createUser(ctx, req)
+	}
+
+	replay := &pb.CreateUserResponse{}
+	replayed, err := s.idempotency.begin(ctx, "CreateUser", key, req, replay)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return replay, nil
 	}
 
+	resp, err := s.createUser(ctx, req)
+	if err != nil {
+		s.idempotency.abort(ctx, "CreateUser", key)
+		return nil, err
+	}
+	s.idempotency.finish(ctx, "CreateUser", key, resp)
+	return resp, nil
+}
+
+func (s *UserServiceServer) createUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
 	user := &models.User{
 		Name:    req.Name,
 		Email:   req.Email,
 		Phone:   req.Phone,
 		Address: req.Address,
+		Role:    roleFromProto(req.Role),
+	}
+
+	var passwordHash string
+	if req.Password != "" {
+		hash, err := models.HashPassword(req.Password)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error hashing password", "error", err)
+			return nil, internalError("failed to create user")
+		}
+		passwordHash = hash
 	}
 
-	if err := s.repo.Create(user); err != nil {
-		log.Printf("Error creating user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to create user")
+	if err := s.repo.Create(ctx, user, passwordHash); err != nil {
+		if errors.Is(err, models.ErrEmailTaken) {
+			return nil, rpcerror.AlreadyExists(reasonEmailTaken, "user", user.Email, "a user with this email already exists")
+		}
+		slog.ErrorContext(ctx, "Error creating user", "error", err)
+		return nil, internalError("failed to create user")
 	}
+	s.events.publish(pb.UserEventType_USER_CREATED, user.ID)
 
 	return &pb.CreateUserResponse{
 		User:    modelToProto(user),
@@ -47,15 +130,19 @@ func (s *UserServiceServer) CreateUser(ctx context.Context, req *pb.CreateUserRe
 }
 
 func (s *UserServiceServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
-	log.Printf("Getting user with ID: %d", req.Id)
+	slog.InfoContext(ctx, "Getting user", "user_id", req.Id)
+
+	if err := authorizeUser(ctx, req.Id); err != nil {
+		return nil, err
+	}
 
-	user, err := s.repo.GetByID(req.Id)
+	user, err := s.repo.GetByID(ctx, req.Id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Error(codes.NotFound, "user not found")
+			return nil, userNotFound(req.Id)
 		}
-		log.Printf("Error getting user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to get user")
+		slog.ErrorContext(ctx, "Error getting user", "error", err)
+		return nil, internalError("failed to get user")
 	}
 
 	return &pb.GetUserResponse{
@@ -64,35 +151,66 @@ func (s *UserServiceServer) GetUser(ctx context.Context, req *pb.GetUserRequest)
 }
 
 func (s *UserServiceServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UpdateUserResponse, error) {
-	log.Printf("Updating user with ID: %d", req.Id)
+	slog.InfoContext(ctx, "Updating user", "user_id", req.Id)
+
+	if err := authorizeUser(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	paths, err := updatePaths(req)
+	if err != nil {
+		return nil, err
+	}
+	if paths["role"] && !isAdmin(ctx) {
+		return nil, rpcerror.PermissionDenied(reasonAdminRequired, "only admins may change roles")
+	}
+
+	if err := validateUpdate(req, paths); err != nil {
+		return nil, err
+	}
 
 	// Check if user exists
-	existingUser, err := s.repo.GetByID(req.Id)
+	existingUser, err := s.repo.GetByID(ctx, req.Id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Error(codes.NotFound, "user not found")
+			return nil, userNotFound(req.Id)
 		}
-		return nil, status.Error(codes.Internal, "failed to get user")
+		return nil, internalError("failed to get user")
+	}
+	if req.Etag != "" && req.Etag != etag(existingUser.Version) {
+		return nil, userConflict(req.Id)
 	}
 
 	// Update fields
-	if req.Name != "" {
+	if paths["name"] {
 		existingUser.Name = req.Name
 	}
-	if req.Email != "" {
+	if paths["email"] {
 		existingUser.Email = req.Email
 	}
-	if req.Phone != "" {
+	if paths["phone"] {
 		existingUser.Phone = req.Phone
 	}
-	if req.Address != "" {
+	if paths["address"] {
 		existingUser.Address = req.Address
 	}
+	if paths["role"] {
+		existingUser.Role = roleFromProto(req.Role)
+	}
 
-	if err := s.repo.Update(existingUser); err != nil {
-		log.Printf("Error updating user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to update user")
+	if err := s.repo.Update(ctx, existingUser); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			return nil, userConflict(req.Id)
+		}
+		if err == sql.ErrNoRows {
+			return nil, userNotFound(req.Id)
+		}
+		if errors.Is(err, models.ErrEmailTaken) {
+			return nil, rpcerror.AlreadyExists(reasonEmailTaken, "user", existingUser.Email, "a user with this email already exists")
+		}
+		slog.ErrorContext(ctx, "Error updating user", "error", err)
+		return nil, internalError("failed to update user")
 	}
+	s.events.publish(pb.UserEventType_USER_UPDATED, existingUser.ID)
 
 	return &pb.UpdateUserResponse{
 		User:    modelToProto(existingUser),
@@ -101,14 +219,20 @@ func (s *UserServiceServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRe
 }
 
 func (s *UserServiceServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
-	log.Printf("Deleting user with ID: %d", req.Id)
+	slog.InfoContext(ctx, "Deleting user", "user_id", req.Id)
 
-	if err := s.repo.Delete(req.Id); err != nil {
+	if err := s.repo.Delete(ctx, req.Id); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Error(codes.NotFound, "user not found")
+			return nil, userNotFound(req.Id)
 		}
-		log.Printf("Error deleting user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to delete user")
+		slog.ErrorContext(ctx, "Error deleting user", "error", err)
+		return nil, internalError("failed to delete user")
+	}
+	s.events.publish(pb.UserEventType_USER_DELETED, req.Id)
+
+	// Deleted users can no longer refresh their sessions
+	if err := s.refreshTokens.RevokeAllForUser(ctx, req.Id); err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh tokens", "error", err)
 	}
 
 	return &pb.DeleteUserResponse{
@@ -117,30 +241,110 @@ func (s *UserServiceServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRe
 	}, nil
 }
 
-func (s *UserServiceServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
-	log.Printf("Listing users: page=%d, limit=%d", req.Page, req.Limit)
+func (s *UserServiceServer) RestoreUser(ctx context.Context, req *pb.RestoreUserRequest) (*pb.RestoreUserResponse, error) {
+	slog.InfoContext(ctx, "Restoring user", "user_id", req.Id)
 
-	users, total, err := s.repo.List(req.Page, req.Limit)
+	user, err := s.repo.Restore(ctx, req.Id)
 	if err != nil {
-		log.Printf("Error listing users: %v", err)
-		return nil, status.Error(codes.Internal, "failed to list users")
+		if err == sql.ErrNoRows {
+			return nil, rpcerror.NotFound(reasonUserNotDeleted, "user", strconv.Itoa(int(req.Id)), "deleted user not found")
+		}
+		slog.ErrorContext(ctx, "Error restoring user", "error", err)
+		return nil, internalError("failed to restore user")
 	}
+	s.events.publish(pb.UserEventType_USER_RESTORED, user.ID)
 
-	pbUsers := make([]*pb.User, len(users))
-	for i, user := range users {
-		pbUsers[i] = modelToProto(user)
+	return &pb.RestoreUserResponse{
+		User:    modelToProto(user),
+		Message: "User restored successfully",
+	}, nil
+}
+
+// PurgeUser permanently removes a soft-deleted user, along with its
+// sessions, once the retention window has passed.
+func (s *UserServiceServer) PurgeUser(ctx context.Context, req *pb.PurgeUserRequest) (*pb.PurgeUserResponse, error) {
+	slog.InfoContext(ctx, "Purging user", "user_id", req.Id)
+
+	if err := s.repo.Purge(ctx, req.Id, s.purgeRetention); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			return nil, userNotFound(req.Id)
+		case errors.Is(err, models.ErrUserNotDeleted):
+			return nil, rpcerror.FailedPrecondition(reasonUserNotDeleted, "user must be deleted before it can be purged",
+				rpcerror.PreconditionViolation("NOT_DELETED", "user/"+strconv.Itoa(int(req.Id)), "the user has not been deleted"))
+		case errors.Is(err, models.ErrRetentionPending):
+			return nil, rpcerror.FailedPrecondition(reasonRetentionPending, fmt.Sprintf("user can only be purged %s after deletion", s.purgeRetention),
+				rpcerror.PreconditionViolation("RETENTION", "user/"+strconv.Itoa(int(req.Id)), "the retention window has not passed"))
+		}
+		slog.ErrorContext(ctx, "Error purging user", "error", err)
+		return nil, internalError("failed to purge user")
 	}
 
-	return &pb.ListUsersResponse{
-		Users: pbUsers,
-		Total: total,
+	return &pb.PurgeUserResponse{
+		Message: "User purged successfully",
+		Success: true,
 	}, nil
 }
 
+// listQuery fingerprints a ListUsers request, so that its page tokens are
+// not accepted by other methods.
+func listQuery(req *pb.ListUsersRequest) string {
+	query := proto.Clone(req).(*pb.ListUsersRequest)
+	query.Page = 0
+	query.Limit = 0
+	query.PageToken = ""
+	query.IncludeTotal = false
+	return fingerprint(query)
+}
+
+func (s *UserServiceServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	slog.InfoContext(ctx, "Listing users", "page", req.Page, "limit", req.Limit, "page_token", req.PageToken != "")
+
+	query := listQuery(req)
+	page, size, err := listPage(s.pageTokens, req.Page, req.Limit, req.PageToken, query)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.repo.List(ctx, page)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing users", "error", err)
+		return nil, internalError("failed to list users")
+	}
+
+	resp := &pb.ListUsersResponse{}
+	if len(users) > int(size) {
+		users = users[:size]
+		last := users[size-1]
+		resp.NextPageToken, err = nextPageToken(s.pageTokens, models.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, query)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error creating page token", "error", err)
+			return nil, internalError("failed to list users")
+		}
+	}
+
+	if req.IncludeTotal {
+		if resp.Total, err = s.repo.Count(ctx); err != nil {
+			slog.ErrorContext(ctx, "Error counting users", "error", err)
+			return nil, internalError("failed to list users")
+		}
+	}
+
+	resp.Users = make([]*pb.User, len(users))
+	for i, user := range users {
+		resp.Users[i] = modelToProto(user)
+	}
+	return resp, nil
+}
+
 func (s *UserServiceServer) ValidateUser(ctx context.Context, req *pb.ValidateUserRequest) (*pb.ValidateUserResponse, error) {
-	log.Printf("Validating user with ID: %d", req.UserId)
+	slog.InfoContext(ctx, "Validating user", "user_id", req.UserId)
+
+	if err := authorizeUser(ctx, req.UserId); err != nil {
+		return nil, err
+	}
 
-	user, err := s.repo.GetByID(req.UserId)
+	user, err := s.repo.GetByID(ctx, req.UserId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return &pb.ValidateUserResponse{
@@ -148,8 +352,8 @@ func (s *UserServiceServer) ValidateUser(ctx context.Context, req *pb.ValidateUs
 				User:    nil,
 			}, nil
 		}
-		log.Printf("Error validating user: %v", err)
-		return nil, status.Error(codes.Internal, "failed to validate user")
+		slog.ErrorContext(ctx, "Error validating user", "error", err)
+		return nil, internalError("failed to validate user")
 	}
 
 	return &pb.ValidateUserResponse{
@@ -158,6 +362,100 @@ func (s *UserServiceServer) ValidateUser(ctx context.Context, req *pb.ValidateUs
 	}, nil
 }
 
+// WatchUserEvents streams user change events until the client disconnects.
+func (s *UserServiceServer) WatchUserEvents(req *pb.WatchUserEventsRequest, stream pb.UserService_WatchUserEventsServer) error {
+	slog.InfoContext(stream.Context(), "User event subscriber connected")
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			slog.InfoContext(stream.Context(), "User event subscriber disconnected")
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				// Closed on shutdown or because this subscriber fell behind
+				return rpcerror.Unavailable(reasonEventStreamClosed, "user event stream closed, resubscribe", time.Second)
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Run deletes expired idempotency keys until ctx is cancelled.
+func (s *UserServiceServer) Run(ctx context.Context) {
+	s.idempotency.run(ctx)
+}
+
+// Shutdown ends all WatchUserEvents streams so that GracefulStop can finish.
+func (s *UserServiceServer) Shutdown() {
+	s.events.close()
+}
+
+// updatePaths returns the set of fields UpdateUser should change. Without an
+// update_mask these are the non-empty fields, as before masks were
+// supported; with one they are exactly the masked paths.
+func updatePaths(req *pb.UpdateUserRequest) (map[string]bool, error) {
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return map[string]bool{
+			"name":    req.Name != "",
+			"email":   req.Email != "",
+			"phone":   req.Phone != "",
+			"address": req.Address != "",
+			"role":    req.Role != pb.UserRole_USER_ROLE_UNSPECIFIED,
+		}, nil
+	}
+
+	v := &validator{}
+	paths := make(map[string]bool, len(req.UpdateMask.Paths))
+	for _, path := range req.UpdateMask.Paths {
+		switch path {
+		case "name", "email", "phone", "address", "role":
+			paths[path] = true
+		default:
+			v.add("update_mask", fmt.Sprintf("contains unknown path %q", path))
+		}
+	}
+	return paths, v.err()
+}
+
+// validateUpdate checks the fields UpdateUser will change. Fields outside
+// paths are left alone, so they are not validated either.
+func validateUpdate(req *pb.UpdateUserRequest, paths map[string]bool) error {
+	v := &validator{}
+	if paths["name"] {
+		v.required("name", req.Name)
+		v.maxLength("name", req.Name, maxNameLength)
+	}
+	if paths["email"] {
+		v.required("email", req.Email)
+		v.email("email", req.Email)
+	}
+	if paths["phone"] {
+		v.phone("phone", req.Phone)
+	}
+	if paths["address"] {
+		v.maxLength("address", req.Address, maxAddressLength)
+	}
+	if paths["role"] && req.Role == pb.UserRole_USER_ROLE_UNSPECIFIED {
+		v.add("role", "is required")
+	}
+	return v.err()
+}
+
+// validateUserFields checks the format and length of the user fields that
+// are set. Whether they are required is up to the caller.
+func validateUserFields(v *validator, name, email, phone, address string) {
+	v.maxLength("name", name, maxNameLength)
+	v.email("email", email)
+	v.phone("phone", phone)
+	v.maxLength("address", address, maxAddressLength)
+}
+
 func modelToProto(user *models.User) *pb.User {
 	return &pb.User{
 		Id:        user.ID,
@@ -165,8 +463,16 @@ func modelToProto(user *models.User) *pb.User {
 		Email:     user.Email,
 		Phone:     user.Phone,
 		Address:   user.Address,
+		Role:      roleToProto(user.Role),
 		CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt: user.UpdatedAt.Format("2006-01-02 15:04:05"),
+		Etag:      etag(user.Version),
 	}
 }
 
+// etag renders a version as an opaque entity tag, quoted as in HTTP so
+// that the gateway can pass it through as an ETag header.
+func etag(version int32) string {
+	return strconv.Quote(strconv.Itoa(int(version)))
+}
+
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service/auth"
+	"user-service/models"
+	pb "user-service/proto/user"
+	"user-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// fakeUserRepository holds a single user and records updates to it. err,
+// if set, is returned by Create, Restore and Purge.
+type fakeUserRepository struct {
+	models.UserRepository
+	user    *models.User
+	updated *models.User
+	err     error
+}
+
+func (r *fakeUserRepository) GetByID(ctx context.Context, id int32) (*models.User, error) {
+	user := *r.user
+	return &user, nil
+}
+
+func (r *fakeUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.updated = user
+	return nil
+}
+
+func (r *fakeUserRepository) Create(ctx context.Context, user *models.User, passwordHash string) error {
+	return r.err
+}
+
+func (r *fakeUserRepository) HasRole(ctx context.Context, role string) (bool, error) {
+	return false, nil
+}
+
+func (r *fakeUserRepository) Restore(ctx context.Context, id int32) (*models.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	user := *r.user
+	return &user, nil
+}
+
+func (r *fakeUserRepository) Purge(ctx context.Context, id int32, retention time.Duration) error {
+	return r.err
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	s := &UserServiceServer{repo: &fakeUserRepository{err: models.ErrEmailTaken}, events: newUserEventBroker()}
+
+	_, err := s.CreateUser(context.Background(), &pb.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+	if status.Code(err) != codes.AlreadyExists || rpcerror.Reason(err) != reasonEmailTaken {
+		t.Errorf("CreateUser with a taken email = %v, want AlreadyExists with reason %s", err, reasonEmailTaken)
+	}
+}
+
+func TestBootstrapAdminDoesNotPromoteExistingUser(t *testing.T) {
+	t.Setenv("INITIAL_ADMIN_EMAIL", "alice@example.com")
+	t.Setenv("INITIAL_ADMIN_PASSWORD", "correct horse")
+
+	err := BootstrapAdmin(context.Background(), &fakeUserRepository{err: models.ErrEmailTaken})
+	if err == nil || !strings.Contains(err.Error(), "existing non-admin user") {
+		t.Errorf("BootstrapAdmin with a taken email = %v", err)
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	repo := &fakeUserRepository{user: &models.User{ID: 7, Name: "Alice", Email: "alice@example.com"}}
+	s := &UserServiceServer{repo: repo, events: newUserEventBroker()}
+	events := s.events.subscribe()
+
+	resp, err := s.RestoreUser(context.Background(), &pb.RestoreUserRequest{Id: 7})
+	if err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if resp.User.Id != 7 || resp.User.Email != "alice@example.com" {
+		t.Errorf("restored user = %v", resp.User)
+	}
+	if event := <-events; event.Type != pb.UserEventType_USER_RESTORED || event.UserId != 7 {
+		t.Errorf("event = %v, want RESTORED for user 7", event)
+	}
+
+	repo.err = sql.ErrNoRows
+	if _, err := s.RestoreUser(context.Background(), &pb.RestoreUserRequest{Id: 7}); status.Code(err) != codes.NotFound {
+		t.Errorf("restoring a user that is not deleted = %v, want NotFound", err)
+	}
+}
+
+func TestPurgeUser(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"purged", nil, codes.OK},
+		{"missing user", sql.ErrNoRows, codes.NotFound},
+		{"not deleted", models.ErrUserNotDeleted, codes.FailedPrecondition},
+		{"retention pending", models.ErrRetentionPending, codes.FailedPrecondition},
+		{"database failure", errors.New("connection refused"), codes.Internal},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &UserServiceServer{repo: &fakeUserRepository{err: tc.err}, purgeRetention: time.Hour}
+
+			_, err := s.PurgeUser(context.Background(), &pb.PurgeUserRequest{Id: 7})
+			if got := status.Code(err); got != tc.code {
+				t.Errorf("PurgeUser code = %v, want %v (%v)", got, tc.code, err)
+			}
+		})
+	}
+}
+
+func TestPurgeRetentionFromEnv(t *testing.T) {
+	t.Setenv("USER_PURGE_RETENTION", "")
+	if got := purgeRetentionFromEnv(); got != 30*24*time.Hour {
+		t.Errorf("default retention = %v, want 720h", got)
+	}
+	t.Setenv("USER_PURGE_RETENTION", "48h")
+	if got := purgeRetentionFromEnv(); got != 48*time.Hour {
+		t.Errorf("retention = %v, want 48h", got)
+	}
+	t.Setenv("USER_PURGE_RETENTION", "-1h")
+	if got := purgeRetentionFromEnv(); got != 30*24*time.Hour {
+		t.Errorf("negative retention = %v, want the default", got)
+	}
+}
+
+func TestUpdateUserValidatesOnlyMaskedFields(t *testing.T) {
+	stored := &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Phone: "+14155550100", Role: models.RoleCustomer}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+	for _, tc := range []struct {
+		name  string
+		req   *pb.UpdateUserRequest
+		field string // the rejected field, if any
+		want  models.User
+	}{
+		{
+			name: "invalid email outside the mask",
+			req: &pb.UpdateUserRequest{Id: 1, Email: "not-an-email", Phone: "+14155550123",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}}},
+			want: models.User{Name: "Alice", Email: "alice@example.com", Phone: "+14155550123"},
+		},
+		{
+			name: "empty name outside the mask",
+			req: &pb.UpdateUserRequest{Id: 1, Address: "1 Main Street",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"address"}}},
+			want: models.User{Name: "Alice", Email: "alice@example.com", Phone: "+14155550100", Address: "1 Main Street"},
+		},
+		{
+			name: "phone cleared by the mask",
+			req:  &pb.UpdateUserRequest{Id: 1, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}}},
+			want: models.User{Name: "Alice", Email: "alice@example.com"},
+		},
+		{
+			name: "invalid email in the mask",
+			req: &pb.UpdateUserRequest{Id: 1, Email: "not-an-email",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}}},
+			field: "email",
+		},
+		{
+			name:  "masked name is required",
+			req:   &pb.UpdateUserRequest{Id: 1, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "phone"}}},
+			field: "name",
+		},
+		{
+			name:  "invalid email without a mask",
+			req:   &pb.UpdateUserRequest{Id: 1, Email: "not-an-email"},
+			field: "email",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeUserRepository{user: stored}
+			s := &UserServiceServer{repo: repo, events: newUserEventBroker()}
+
+			_, err := s.UpdateUser(ctx, tc.req)
+			if tc.field != "" {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("UpdateUser = %v, want InvalidArgument", err)
+				}
+				violations := rpcerror.Decode(err).FieldViolations
+				if len(violations) != 1 || violations[0].Field != tc.field {
+					t.Errorf("violations = %v, want one for %s", violations, tc.field)
+				}
+				if repo.updated != nil {
+					t.Error("invalid update was saved")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := repo.updated
+			if got.Name != tc.want.Name || got.Email != tc.want.Email || got.Phone != tc.want.Phone || got.Address != tc.want.Address {
+				t.Errorf("saved %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateUserEtag(t *testing.T) {
+	stored := &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Role: models.RoleCustomer, Version: 2}
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{UserID: 1, Role: auth.RoleCustomer})
+
+	repo := &fakeUserRepository{user: stored}
+	s := &UserServiceServer{repo: repo, events: newUserEventBroker()}
+	_, err := s.UpdateUser(ctx, &pb.UpdateUserRequest{Id: 1, Name: "Alicia", Etag: `"1"`})
+	if status.Code(err) != codes.Aborted || rpcerror.Reason(err) != reasonVersionConflict {
+		t.Fatalf("UpdateUser with a stale etag = %v, want Aborted with reason %s", err, reasonVersionConflict)
+	}
+	if repo.updated != nil {
+		t.Error("update with a stale etag was saved")
+	}
+
+	resp, err := s.UpdateUser(ctx, &pb.UpdateUserRequest{Id: 1, Name: "Alicia", Etag: `"2"`})
+	if err != nil {
+		t.Fatalf("UpdateUser with the current etag: %v", err)
+	}
+	if repo.updated.Version != 2 || resp.User.Etag != `"2"` {
+		t.Errorf("saved version %d, returned etag %s; want the version read, 2", repo.updated.Version, resp.User.Etag)
+	}
+}
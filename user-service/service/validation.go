@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"unicode/utf8"
+
+	"user-service/rpcerror"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// Field limits. Names and emails must fit their VARCHAR(255) columns; 254
+// is the longest address SMTP can carry.
+const (
+	maxNameLength    = 255
+	maxEmailLength   = 254
+	maxAddressLength = 500
+
+	minPasswordLength = 8
+	maxPasswordLength = 128
+)
+
+// e164Pattern matches an E.164 phone number: a plus sign and up to 15
+// digits, the first of which is not zero.
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// validator collects every problem with a request, so that clients can
+// report them all at once rather than one per round trip.
+type validator struct {
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (v *validator) add(field, description string) {
+	v.violations = append(v.violations, rpcerror.FieldViolation(field, description))
+}
+
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) maxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.add(field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+// email checks that value is a bare RFC 5322 address, without a display
+// name. Empty values are left to required.
+func (v *validator) email(field, value string) {
+	if value == "" {
+		return
+	}
+	if len(value) > maxEmailLength {
+		v.add(field, fmt.Sprintf("must be at most %d characters", maxEmailLength))
+		return
+	}
+	if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+		v.add(field, "must be a valid email address")
+	}
+}
+
+// phone checks that value is an E.164 number such as +14155550123. Empty
+// values are allowed, as phone numbers are optional.
+func (v *validator) phone(field, value string) {
+	if value != "" && !e164Pattern.MatchString(value) {
+		v.add(field, "must be an E.164 phone number, e.g. +14155550123")
+	}
+}
+
+func (v *validator) password(field, value string) {
+	switch {
+	case len(value) < minPasswordLength:
+		v.add(field, fmt.Sprintf("must be at least %d characters", minPasswordLength))
+	case len(value) > maxPasswordLength:
+		v.add(field, fmt.Sprintf("must be at most %d characters", maxPasswordLength))
+	}
+}
+
+// err returns an InvalidArgument error carrying the violations as
+// errdetails.BadRequest, or nil if there are none.
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	first := v.violations[0]
+	message := first.Field + " " + first.Description
+	if len(v.violations) > 1 {
+		message += fmt.Sprintf(" (and %d more)", len(v.violations)-1)
+	}
+	return rpcerror.InvalidArgument(reasonInvalidFields, message, v.violations...)
+}
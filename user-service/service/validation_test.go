@@ -0,0 +1,116 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"user-service/rpcerror"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidatorEmail(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"alice@example.com", true},
+		{"alice+orders@mail.example.co.uk", true},
+		{"alice", false},
+		{"alice@", false},
+		{"@example.com", false},
+		{"Alice <alice@example.com>", false},
+		{" alice@example.com", false},
+		{strings.Repeat("a", maxEmailLength-len("@example.com")) + "@example.com", true},
+		{strings.Repeat("a", maxEmailLength-len("@example.com")+1) + "@example.com", false},
+	} {
+		v := &validator{}
+		v.email("email", tc.value)
+		if valid := v.err() == nil; valid != tc.valid {
+			t.Errorf("email(%q) valid = %v, want %v", tc.value, valid, tc.valid)
+		}
+	}
+}
+
+func TestValidatorPhone(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"+14155550123", true},
+		{"+442071838750", true},
+		{"+123456789012345", true},
+		{"+1234567890123456", false},
+		{"14155550123", false},
+		{"+04155550123", false},
+		{"+1 415 555 0123", false},
+		{"+1-415-555-0123", false},
+		{"+1", false},
+	} {
+		v := &validator{}
+		v.phone("phone", tc.value)
+		if valid := v.err() == nil; valid != tc.valid {
+			t.Errorf("phone(%q) valid = %v, want %v", tc.value, valid, tc.valid)
+		}
+	}
+}
+
+func TestValidatorPassword(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{"", false},
+		{strings.Repeat("x", minPasswordLength-1), false},
+		{strings.Repeat("x", minPasswordLength), true},
+		{strings.Repeat("x", maxPasswordLength), true},
+		{strings.Repeat("x", maxPasswordLength+1), false},
+	} {
+		v := &validator{}
+		v.password("password", tc.value)
+		if valid := v.err() == nil; valid != tc.valid {
+			t.Errorf("password of %d characters valid = %v, want %v", len(tc.value), valid, tc.valid)
+		}
+	}
+}
+
+func TestValidatorMaxLengthCountsCharacters(t *testing.T) {
+	v := &validator{}
+	v.maxLength("name", strings.Repeat("é", maxNameLength), maxNameLength)
+	if err := v.err(); err != nil {
+		t.Errorf("%d two-byte characters rejected: %v", maxNameLength, err)
+	}
+
+	v.maxLength("name", strings.Repeat("é", maxNameLength+1), maxNameLength)
+	if v.err() == nil {
+		t.Errorf("%d characters accepted", maxNameLength+1)
+	}
+}
+
+func TestValidatorReportsEveryViolation(t *testing.T) {
+	v := &validator{}
+	v.required("name", "")
+	validateUserFields(v, "", "not-an-email", "555-0100", strings.Repeat("a", maxAddressLength+1))
+
+	err := v.err()
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("code = %v, want InvalidArgument", status.Code(err))
+	}
+	details := rpcerror.Decode(err)
+	if details.Reason != reasonInvalidFields {
+		t.Errorf("reason = %q, want %q", details.Reason, reasonInvalidFields)
+	}
+	var fields []string
+	for _, violation := range details.FieldViolations {
+		fields = append(fields, violation.Field)
+	}
+	if got, want := strings.Join(fields, ","), "name,email,phone,address"; got != want {
+		t.Errorf("violations for %s, want %s", got, want)
+	}
+	if want := "name is required (and 3 more)"; details.Message != want {
+		t.Errorf("message = %q, want %q", details.Message, want)
+	}
+}
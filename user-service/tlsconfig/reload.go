@@ -0,0 +1,112 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// reloader caches a value parsed from files and parses them again when
+// their modification times change. The files are checked on use, at most
+// once per interval. If parsing fails, for example because only one of a
+// certificate and its key has been replaced so far, the previous value is
+// kept and the files are tried again at the next check.
+type reloader[T any] struct {
+	files    []string
+	parse    func() (T, error)
+	interval time.Duration
+
+	mu      sync.Mutex
+	value   T
+	mtimes  []time.Time
+	checked time.Time
+}
+
+func newReloader[T any](interval time.Duration, parse func() (T, error), files ...string) (*reloader[T], error) {
+	r := &reloader[T]{files: files, parse: parse, interval: interval}
+	mtimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	r.value, r.mtimes, r.checked = value, mtimes, time.Now()
+	return r, nil
+}
+
+func (r *reloader[T]) get() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < r.interval {
+		return r.value
+	}
+	r.checked = time.Now()
+
+	mtimes, err := r.stat()
+	if err != nil {
+		slog.Warn("Error checking TLS files", "files", r.files, "error", err)
+		return r.value
+	}
+	if slices.EqualFunc(mtimes, r.mtimes, time.Time.Equal) {
+		return r.value
+	}
+
+	value, err := r.parse()
+	if err != nil {
+		slog.Error("Error reloading TLS files, keeping previous version", "files", r.files, "error", err)
+		return r.value
+	}
+	r.value, r.mtimes = value, mtimes
+	slog.Info("Reloaded TLS files", "files", r.files)
+	return r.value
+}
+
+// stat follows symlinks, so a Kubernetes-style secret update that swaps a
+// symlink to a new directory is noticed too.
+func (r *reloader[T]) stat() ([]time.Time, error) {
+	mtimes := make([]time.Time, len(r.files))
+	for i, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		mtimes[i] = info.ModTime()
+	}
+	return mtimes, nil
+}
+
+func newKeyPairReloader(cfg Config) (*reloader[*tls.Certificate], error) {
+	return newReloader(cfg.ReloadInterval, func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
+	}, cfg.CertFile, cfg.KeyFile)
+}
+
+func newCertPoolReloader(cfg Config) (*reloader[*x509.CertPool], error) {
+	return newReloader(cfg.ReloadInterval, func() (*x509.CertPool, error) {
+		return loadCertPool(cfg.CAFile)
+	}, cfg.CAFile)
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return pool, nil
+}
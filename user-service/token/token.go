@@ -0,0 +1,330 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"user-service/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const algorithm = "ES256"
+
+// reloadInterval is how often the key set is re-read from the database, so
+// that keys rotated by another replica are picked up.
+const reloadInterval = time.Minute
+
+// Config controls token lifetimes and signing-key rotation.
+type Config struct {
+	Issuer   string
+	Audience string
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// KeyRotationInterval is how long a signing key is used before a new
+	// one replaces it.
+	KeyRotationInterval time.Duration
+}
+
+// ConfigFromEnv reads the token configuration from TOKEN_* variables.
+func ConfigFromEnv() Config {
+	return Config{
+		Issuer:              getEnv("TOKEN_ISSUER", "user-service"),
+		Audience:            getEnv("TOKEN_AUDIENCE", "grpc-microservices"),
+		AccessTokenTTL:      getEnvDuration("TOKEN_ACCESS_TTL", 15*time.Minute),
+		RefreshTokenTTL:     getEnvDuration("TOKEN_REFRESH_TTL", 30*24*time.Hour),
+		KeyRotationInterval: getEnvDuration("TOKEN_KEY_ROTATION_INTERVAL", 24*time.Hour),
+	}
+}
+
+// Claims are the claims carried by an access token. The subject is the
+// user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+}
+
+// UserID returns the user ID named by the subject claim.
+func (c *Claims) UserID() (int32, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid subject %q", c.Subject)
+	}
+	return int32(id), nil
+}
+
+// JWK is the public half of a signing key in JSON Web Key form.
+type JWK struct {
+	Kty string
+	Kid string
+	Use string
+	Alg string
+	Crv string
+	X   string
+	Y   string
+}
+
+type signingKey struct {
+	kid     string
+	private *ecdsa.PrivateKey
+}
+
+// Manager signs and verifies access tokens. Signing keys live in the
+// database so that every replica signs with, and publishes, the same keys.
+type Manager struct {
+	cfg  Config
+	repo models.SigningKeyRepository
+
+	mu        sync.RWMutex
+	signing   *signingKey
+	published []*signingKey // newest first
+}
+
+// NewManager loads the signing keys, creating the first one if needed.
+func NewManager(ctx context.Context, cfg Config, repo models.SigningKeyRepository) (*Manager, error) {
+	m := &Manager{cfg: cfg, repo: repo}
+	if err := m.reload(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %v", err)
+	}
+	return m, nil
+}
+
+// Config returns the configuration the manager was created with.
+func (m *Manager) Config() Config {
+	return m.cfg
+}
+
+// Run reloads and rotates the signing keys until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.reload(ctx); err != nil {
+				slog.ErrorContext(ctx, "Error reloading signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// reload reads the key set, first rotating the active key if it is due.
+// Retired keys stay published for as long as tokens they signed are valid,
+// plus one reload interval for verifiers that cache the key set.
+func (m *Manager) reload(ctx context.Context) error {
+	retention := m.cfg.AccessTokenTTL + reloadInterval
+
+	keys, err := m.repo.List(ctx, retention)
+	if err != nil {
+		return err
+	}
+
+	active := activeKey(keys)
+	if active == nil || time.Since(active.CreatedAt) >= m.cfg.KeyRotationInterval {
+		if err := m.rotate(ctx); err != nil {
+			return err
+		}
+		if keys, err = m.repo.List(ctx, retention); err != nil {
+			return err
+		}
+		active = activeKey(keys)
+	}
+
+	var signing *signingKey
+	published := make([]*signingKey, 0, len(keys))
+	for _, key := range keys {
+		private, err := decodePrivateKey(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %v", key.KID, err)
+		}
+		k := &signingKey{kid: key.KID, private: private}
+		if key == active {
+			signing = k
+		}
+		published = append(published, k)
+	}
+	if signing == nil {
+		return errors.New("no active signing key")
+	}
+
+	m.mu.Lock()
+	m.signing = signing
+	m.published = published
+	m.mu.Unlock()
+	return nil
+}
+
+// rotate creates a new signing key and retires the others.
+func (m *Manager) rotate(ctx context.Context) error {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return err
+	}
+
+	key := &models.SigningKey{
+		KID:        hex.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+	if err := m.repo.Create(ctx, key); err != nil {
+		return err
+	}
+	if err := m.repo.RetireAllExcept(ctx, key.KID); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Rotated token signing key", "kid", key.KID)
+	return nil
+}
+
+// Issue returns a signed access token for userID with the given role, and
+// its expiry time.
+func (m *Manager) Issue(userID int32, role string) (string, time.Time, error) {
+	m.mu.RLock()
+	key := m.signing
+	m.mu.RUnlock()
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(m.cfg.AccessTokenTTL)
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(id),
+			Issuer:    m.cfg.Issuer,
+			Subject:   strconv.Itoa(int(userID)),
+			Audience:  jwt.ClaimStrings{m.cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Role: role,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = key.kid
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Verify checks an access token's signature, issuer, audience and expiry
+// and returns its claims.
+func (m *Manager) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, m.publicKey,
+		jwt.WithValidMethods([]string{algorithm}),
+		jwt.WithIssuer(m.cfg.Issuer),
+		jwt.WithAudience(m.cfg.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (m *Manager) publicKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, key := range m.published {
+		if key.kid == kid {
+			return &key.private.PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns the public keys that tokens may currently be signed with,
+// newest first.
+func (m *Manager) JWKS() []JWK {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]JWK, len(m.published))
+	for i, key := range m.published {
+		public := key.private.PublicKey
+		keys[i] = JWK{
+			Kty: "EC",
+			Kid: key.kid,
+			Use: "sig",
+			Alg: algorithm,
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+		}
+	}
+	return keys
+}
+
+func activeKey(keys []*models.SigningKey) *models.SigningKey {
+	for _, key := range keys {
+		if !key.Retired {
+			return key
+		}
+	}
+	return nil
+}
+
+func decodePrivateKey(data string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA key")
+	}
+	return private, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
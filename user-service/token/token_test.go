@@ -0,0 +1,180 @@
+package token
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service/models"
+)
+
+// fakeKeyRepository keeps signing keys in memory, newest first.
+type fakeKeyRepository struct {
+	keys      []*models.SigningKey
+	retiredAt map[string]time.Time
+}
+
+func newFakeKeyRepository() *fakeKeyRepository {
+	return &fakeKeyRepository{retiredAt: map[string]time.Time{}}
+}
+
+func (r *fakeKeyRepository) Create(ctx context.Context, key *models.SigningKey) error {
+	key.CreatedAt = time.Now()
+	stored := *key
+	r.keys = append([]*models.SigningKey{&stored}, r.keys...)
+	return nil
+}
+
+func (r *fakeKeyRepository) List(ctx context.Context, retention time.Duration) ([]*models.SigningKey, error) {
+	var keys []*models.SigningKey
+	for _, key := range r.keys {
+		retiredAt, retired := r.retiredAt[key.KID]
+		if retired && time.Since(retiredAt) >= retention {
+			continue
+		}
+		listed := *key
+		listed.Retired = retired
+		keys = append(keys, &listed)
+	}
+	return keys, nil
+}
+
+func (r *fakeKeyRepository) RetireAllExcept(ctx context.Context, kid string) error {
+	for _, key := range r.keys {
+		if _, retired := r.retiredAt[key.KID]; !retired && key.KID != kid {
+			r.retiredAt[key.KID] = time.Now()
+		}
+	}
+	return nil
+}
+
+func testConfig() Config {
+	return Config{
+		Issuer:              "user-service",
+		Audience:            "grpc-microservices",
+		AccessTokenTTL:      15 * time.Minute,
+		RefreshTokenTTL:     24 * time.Hour,
+		KeyRotationInterval: 24 * time.Hour,
+	}
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	m, err := NewManager(context.Background(), testConfig(), newFakeKeyRepository())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, expiresAt, err := m.Issue(7, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d <= 14*time.Minute || d > 15*time.Minute {
+		t.Errorf("token expires in %v, want 15m", d)
+	}
+
+	claims, err := m.Verify(signed)
+	if err != nil {
+		t.Fatalf("Verify = %v", err)
+	}
+	if id, err := claims.UserID(); err != nil || id != 7 || claims.Role != "admin" {
+		t.Errorf("claims = user %d (%v), role %q", id, err, claims.Role)
+	}
+}
+
+func TestVerifyRejectsForeignTokens(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeKeyRepository()
+	m, err := NewManager(ctx, testConfig(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(cfg Config, repo models.SigningKeyRepository) string {
+		other, err := NewManager(ctx, cfg, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, _, err := other.Issue(7, "customer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	otherIssuer, otherAudience, expired := testConfig(), testConfig(), testConfig()
+	otherIssuer.Issuer = "someone-else"
+	otherAudience.Audience = "other-audience"
+	expired.AccessTokenTTL = -time.Minute
+	valid := issue(testConfig(), repo)
+
+	for name, signed := range map[string]string{
+		"other issuer":   issue(otherIssuer, repo),
+		"other audience": issue(otherAudience, repo),
+		"expired":        issue(expired, repo),
+		"unknown key":    issue(testConfig(), newFakeKeyRepository()),
+		"tampered":       valid[:len(valid)-4] + strings.Repeat("A", 4),
+		"not a token":    "not-a-token",
+	} {
+		if _, err := m.Verify(signed); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeKeyRepository()
+	m, err := NewManager(ctx, testConfig(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _, err := m.Issue(7, "customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKID := m.JWKS()[0].Kid
+
+	// The key is due for rotation at the next reload
+	repo.keys[0].CreatedAt = time.Now().Add(-25 * time.Hour)
+	if err := m.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := m.JWKS()
+	if len(jwks) != 2 || jwks[0].Kid == oldKID || jwks[1].Kid != oldKID {
+		t.Fatalf("JWKS = %+v, want the new key followed by %s", jwks, oldKID)
+	}
+	newToken, _, err := m.Issue(7, "customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, signed := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := m.Verify(signed); err != nil {
+			t.Errorf("%s token rejected after rotation: %v", name, err)
+		}
+	}
+
+	// Another replica picks up the same keys
+	replica, err := NewManager(ctx, testConfig(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.Verify(oldToken); err != nil {
+		t.Errorf("replica rejected the old token: %v", err)
+	}
+	if got := replica.JWKS()[0].Kid; got != jwks[0].Kid {
+		t.Errorf("replica signs with %s, want %s", got, jwks[0].Kid)
+	}
+
+	// Once tokens it signed have expired, the old key is no longer published
+	repo.retiredAt[oldKID] = time.Now().Add(-testConfig().AccessTokenTTL - reloadInterval)
+	if err := m.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if jwks := m.JWKS(); len(jwks) != 1 {
+		t.Errorf("JWKS has %d keys after the retention period, want 1", len(jwks))
+	}
+	if _, err := m.Verify(oldToken); err == nil {
+		t.Error("token signed by a dropped key accepted")
+	}
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestInitFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	t.Setenv("OTEL_TRACES_EXPORTER", "file")
+	t.Setenv("OTEL_TRACES_FILE", path)
+
+	shutdown, err := Init(context.Background(), "test-service")
+	if err != nil {
+		t.Fatalf("Init = %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"test-span"`) || !strings.Contains(string(data), "test-service") {
+		t.Errorf("trace file does not hold the span and service name:\n%s", data)
+	}
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+
+	if _, err := Init(context.Background(), "test-service"); err == nil {
+		t.Error("Init with an unknown exporter succeeded, want an error")
+	}
+}